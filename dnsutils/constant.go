@@ -16,8 +16,92 @@ const (
 	DNSTapClientResponse = "CLIENT_RESPONSE"
 	DNSTapClientQuery    = "CLIENT_QUERY"
 
+	DNSTapResolverQuery     = "RESOLVER_QUERY"
+	DNSTapResolverResponse  = "RESOLVER_RESPONSE"
+	DNSTapForwarderQuery    = "FORWARDER_QUERY"
+	DNSTapForwarderResponse = "FORWARDER_RESPONSE"
+
 	DNSTapIdentityTest = "test_id"
 
+	CorrelationAnswered   = "answered"
+	CorrelationUnanswered = "unanswered"
+	CorrelationUnmatched  = "unmatched"
+
+	UpstreamCacheHit  = "hit"
+	UpstreamCacheMiss = "miss"
+
+	ThreatIntelFormatRPZ     = "rpz"
+	ThreatIntelFormatDomains = "domains"
+	ThreatIntelFormatIPs     = "ips"
+	ThreatIntelFieldQname    = "qname"
+	ThreatIntelFieldCNAME    = "cname"
+	ThreatIntelFieldRdata    = "rdata"
+
+	ThreatIntelActionNXDomain  = "nxdomain"
+	ThreatIntelActionNoData    = "nodata"
+	ThreatIntelActionPassthru  = "passthru"
+	ThreatIntelActionDrop      = "drop"
+	ThreatIntelActionTCPOnly   = "tcp-only"
+	ThreatIntelActionLocalData = "local-data"
+
+	AnomalyReasonQueries      = "queries"
+	AnomalyReasonNXDomain     = "nxdomain-ratio"
+	AnomalyReasonUniqueQnames = "unique-qnames"
+	DNSTapOperationAnomaly    = "ANOMALY_ALERT"
+
+	DNSTapOperationRollup = "ROLLUP_SUMMARY"
+
+	PseudonymizeModeHMAC      = "hmac"
+	PseudonymizeModeCryptoPAn = "cryptopan"
+
+	NewDomainStoreLRU   = "lru"
+	NewDomainStoreBloom = "bloom"
+
+	ScriptOnErrorKeep = "keep"
+	ScriptOnErrorDrop = "drop"
+
+	LookupFormatCSV        = "csv"
+	LookupFormatJSON       = "json"
+	LookupTypeCIDR         = "cidr"
+	LookupTypeDomain       = "domain"
+	LookupTypeDomainSuffix = "domain-suffix"
+
+	SuspiciousCheckMalformedPacket  = "malformed-pkt"
+	SuspiciousCheckLargePacket      = "large-pkt"
+	SuspiciousCheckLongDomain       = "long-domain"
+	SuspiciousCheckSlowDomain       = "slow-domain"
+	SuspiciousCheckUnallowedChars   = "unallowed-chars"
+	SuspiciousCheckUncommonQtypes   = "uncommon-qtypes"
+	SuspiciousCheckExcessiveLabels  = "excessive-number-labels"
+	SuspiciousCheckHighEntropy      = "high-entropy"
+	SuspiciousCheckNumericLabels    = "numeric-labels"
+	SuspiciousCheckEncodedLabels    = "encoded-labels"
+	SuspiciousCheckNonASCII         = "non-ascii"
+	SuspiciousCheckTTLAnomaly       = "ttl-anomaly"
+	SuspiciousCheckAnyQuery         = "any-query"
+	SuspiciousCheckNullPrivateQtype = "null-private-qtypes"
+
+	SuspiciousActionKeep           = "keep"
+	SuspiciousActionDrop           = "drop"
+	SuspiciousActionOnlySuspicious = "forward-only-suspicious"
+
+	SampleFieldQueryIP      = "query-ip"
+	SampleFieldQueryPort    = "query-port"
+	SampleFieldResponseIP   = "response-ip"
+	SampleFieldResponsePort = "response-port"
+	SampleFieldQname        = "qname"
+	SampleFieldID           = "id"
+
+	DGAActionNone = "none"
+	DGAActionTag  = "tag"
+	DGAActionDrop = "drop"
+	DGATag        = "dga"
+
+	TunnelingReasonUniqueSubdomains = "unique-subdomains"
+	TunnelingReasonEntropy          = "high-entropy"
+	TunnelingReasonLargeAnswers     = "large-answers"
+	TunnelingReasonVolume           = "high-volume"
+
 	MatchingModeInclude   = "include"
 	MatchingOpGreaterThan = "greater-than"
 	MatchingOpLowerThan   = "lower-than"
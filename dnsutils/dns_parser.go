@@ -565,7 +565,7 @@ func ParseRdata(rdatatype string, rdata []byte, payload []byte, rdataOffset int)
 		ret, err = ParseIP(rdata, net.IPv4len)
 	case "AAAA":
 		ret, err = ParseIP(rdata, net.IPv6len)
-	case "CNAME":
+	case "CNAME", "DNAME":
 		ret, err = ParseCNAME(rdataOffset, payload)
 	case "MX":
 		ret, err = ParseMX(rdataOffset, payload)
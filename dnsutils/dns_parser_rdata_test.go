@@ -235,6 +235,26 @@ func TestDecodeRdataCNAME(t *testing.T) {
 	}
 }
 
+func TestDecodeRdataDNAME(t *testing.T) {
+	fqdn := TestQName
+
+	dm := new(dns.Msg)
+	dm.SetQuestion(fqdn, dns.TypeA)
+
+	rdata := "collector.org"
+	rr1, _ := dns.NewRR(fmt.Sprintf("%s DNAME %s", fqdn, rdata))
+	dm.Answer = append(dm.Answer, rr1)
+
+	payload, _ := dm.Pack()
+
+	_, _, _, offsetRR, _ := DecodeQuestion(1, payload)
+	answer, _, _ := DecodeAnswer(len(dm.Answer), offsetRR, payload)
+
+	if answer[0].Rdata != rdata {
+		t.Errorf("invalid decode for rdata DNAME, want %s, got: %s", rdata, answer[0].Rdata)
+	}
+}
+
 func TestDecodeRdataMX(t *testing.T) {
 	fqdn := TestQName
 
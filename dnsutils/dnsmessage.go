@@ -127,7 +127,8 @@ type LoggerOpenTelemetry struct {
 	TraceID string `json:"trace-id"`
 }
 
-type TransformDNSGeo struct {
+type GeoLocation struct {
+	IP                     string `json:"ip"`
 	City                   string `json:"city"`
 	Continent              string `json:"continent"`
 	CountryIsoCode         string `json:"country-isocode"`
@@ -135,16 +136,91 @@ type TransformDNSGeo struct {
 	AutonomousSystemOrg    string `json:"as-owner"`
 }
 
+type TransformDNSGeo struct {
+	City                   string        `json:"city"`
+	Continent              string        `json:"continent"`
+	CountryIsoCode         string        `json:"country-isocode"`
+	AutonomousSystemNumber string        `json:"as-number"`
+	AutonomousSystemOrg    string        `json:"as-owner"`
+	Subdivision            string        `json:"subdivision"`
+	PostalCode             string        `json:"postal-code"`
+	Latitude               float64       `json:"latitude"`
+	Longitude              float64       `json:"longitude"`
+	TimeZone               string        `json:"timezone"`
+	ISP                    string        `json:"isp"`
+	Organization           string        `json:"organization"`
+	Anonymous              bool          `json:"anonymous"`
+	AnonymousVPN           bool          `json:"anonymous-vpn"`
+	HostingProvider        bool          `json:"hosting-provider"`
+	PublicProxy            bool          `json:"public-proxy"`
+	TorExitNode            bool          `json:"tor-exit-node"`
+	ResponseIP             *GeoLocation  `json:"response-ip,omitempty"`
+	Answers                []GeoLocation `json:"answers,omitempty"`
+}
+
 type TransformSuspicious struct {
-	Score                 float64 `json:"score"`
-	MalformedPacket       bool    `json:"malformed-pkt"`
-	LargePacket           bool    `json:"large-pkt"`
-	LongDomain            bool    `json:"long-domain"`
-	SlowDomain            bool    `json:"slow-domain"`
-	UnallowedChars        bool    `json:"unallowed-chars"`
-	UncommonQtypes        bool    `json:"uncommon-qtypes"`
-	ExcessiveNumberLabels bool    `json:"excessive-number-labels"`
-	Domain                string  `json:"domain,omitempty"`
+	Score                 float64  `json:"score"`
+	MalformedPacket       bool     `json:"malformed-pkt"`
+	LargePacket           bool     `json:"large-pkt"`
+	LongDomain            bool     `json:"long-domain"`
+	SlowDomain            bool     `json:"slow-domain"`
+	UnallowedChars        bool     `json:"unallowed-chars"`
+	UncommonQtypes        bool     `json:"uncommon-qtypes"`
+	ExcessiveNumberLabels bool     `json:"excessive-number-labels"`
+	Reasons               []string `json:"reasons,omitempty"`
+	Domain                string   `json:"domain,omitempty"`
+}
+
+type TransformTunneling struct {
+	Score            float64  `json:"score"`
+	Reasons          []string `json:"reasons"`
+	Domain           string   `json:"domain"`
+	UniqueSubdomains int      `json:"unique-subdomains"`
+	Entropy          float64  `json:"entropy"`
+	Bytes            int      `json:"bytes"`
+}
+
+type TransformAnomaly struct {
+	Anomalous             bool     `json:"anomalous"`
+	Reasons               []string `json:"reasons"`
+	QueriesDeviation      float64  `json:"queries-deviation"`
+	NXDomainDeviation     float64  `json:"nxdomain-deviation"`
+	UniqueQnamesDeviation float64  `json:"unique-qnames-deviation"`
+}
+
+type TransformRollup struct {
+	WindowStart    int64             `json:"window-start"`
+	WindowEnd      int64             `json:"window-end"`
+	Group          map[string]string `json:"group"`
+	Count          int               `json:"count"`
+	LengthSum      int               `json:"length-sum"`
+	LengthMin      int               `json:"length-min"`
+	LengthMax      int               `json:"length-max"`
+	LengthAvg      float64           `json:"length-avg"`
+	Latencies      int               `json:"latencies"`
+	LatencySum     float64           `json:"latency-sum"`
+	LatencyMin     float64           `json:"latency-min"`
+	LatencyMax     float64           `json:"latency-max"`
+	LatencyAvg     float64           `json:"latency-avg"`
+	DistinctQnames uint64            `json:"distinct-qnames"`
+}
+
+type TransformNewDomain struct {
+	NewQname             bool   `json:"new-qname"`
+	QnameFirstSeen       string `json:"qname-first-seen"`
+	NewForClient         bool   `json:"new-for-client"`
+	ClientFirstSeen      string `json:"client-first-seen"`
+	NewETLDPlusOne       bool   `json:"new-etld-plus-one"`
+	ETLDPlusOneFirstSeen string `json:"etld-plus-one-first-seen"`
+}
+
+type TransformResolution struct {
+	FinalName   string   `json:"final-name"`
+	CNAMEChain  []string `json:"cname-chain"`
+	ResolvedIPs []string `json:"resolved-ips"`
+	MinTTL      int      `json:"min-ttl"`
+	MaxTTL      int      `json:"max-ttl"`
+	Broken      bool     `json:"broken"`
 }
 
 type TransformPublicSuffix struct {
@@ -153,6 +229,13 @@ type TransformPublicSuffix struct {
 	ManagedByICANN           bool   `json:"managed-icann"`
 }
 
+type TransformIDN struct {
+	QnameUnicode string `json:"qname-unicode"`
+	MixedScript  bool   `json:"mixed-script"`
+	Confusable   bool   `json:"confusable"`
+	Brand        string `json:"brand"`
+}
+
 type TransformExtracted struct {
 	Base64Payload []byte `json:"dns_payload"`
 }
@@ -163,7 +246,8 @@ type TransformReducer struct {
 }
 
 type TransformFiltering struct {
-	SampleRate int `json:"sample-rate"`
+	SampleRate     int     `json:"sample-rate"`
+	SampleFraction float64 `json:"sample-fraction"`
 }
 
 type TransformML struct {
@@ -186,12 +270,47 @@ type TransformML struct {
 	Size                  int     `json:"size"`
 	Occurrences           int     `json:"occurrences"`
 	UncommonQtypes        int     `json:"uncommon-qtypes"`
+	BigramScore           float64 `json:"bigram-score"`    // Average log10 probability of the bigrams
+	DGAProbability        float64 `json:"dga-probability"` // Probability of a generated domain according to the model
 }
 
 type TransformATags struct {
 	Tags []string `json:"tags"`
 }
 
+type TransformCorrelation struct {
+	Status         string      `json:"status"`
+	QueryTimestamp string      `json:"query-timestamp-rfc3339ns"`
+	ReplyTimestamp string      `json:"reply-timestamp-rfc3339ns"`
+	QueryLength    int         `json:"query-length"`
+	ReplyLength    int         `json:"reply-length"`
+	QueryFlags     DNSFlags    `json:"query-flags"`
+	ReplyFlags     DNSFlags    `json:"reply-flags"`
+	QueryEDNS      DNSExtended `json:"query-edns"`
+	ReplyEDNS      DNSExtended `json:"reply-edns"`
+}
+
+type TransformUpstream struct {
+	Queries    int     `json:"queries"`
+	RoundTrips int     `json:"round-trips"`
+	Latency    float64 `json:"latency"`
+	LatencyMs  int     `json:"latency_ms"`
+	Cache      string  `json:"cache"`
+}
+
+type ThreatIntelMatch struct {
+	List      string `json:"list"`
+	Category  string `json:"category"`
+	Severity  string `json:"severity"`
+	Field     string `json:"field"`
+	Indicator string `json:"indicator"`
+	Action    string `json:"action,omitempty"`
+}
+
+type TransformThreatIntel struct {
+	Matches []ThreatIntelMatch `json:"matches"`
+}
+
 type TransformRest struct {
 	Failed   bool   `json:"failed"`
 	Response string `json:"response"`
@@ -217,12 +336,22 @@ type DNSMessage struct {
 	Geo             *TransformDNSGeo       `json:"geoip,omitempty"`
 	Suspicious      *TransformSuspicious   `json:"suspicious,omitempty"`
 	PublicSuffix    *TransformPublicSuffix `json:"publicsuffix,omitempty"`
+	IDN             *TransformIDN          `json:"idn,omitempty"`
 	Extracted       *TransformExtracted    `json:"extracted,omitempty"`
 	Reducer         *TransformReducer      `json:"reducer,omitempty"`
 	MachineLearning *TransformML           `json:"ml,omitempty"`
 	Filtering       *TransformFiltering    `json:"filtering,omitempty"`
 	ATags           *TransformATags        `json:"atags,omitempty"`
 	Rest            *TransformRest         `json:"rest,omitempty"`
+	Correlation     *TransformCorrelation  `json:"correlation,omitempty"`
+	Upstream        *TransformUpstream     `json:"upstream,omitempty"`
+	ThreatIntel     *TransformThreatIntel  `json:"threatintel,omitempty"`
+	Tunneling       *TransformTunneling    `json:"tunneling,omitempty"`
+	Anomaly         *TransformAnomaly      `json:"anomaly,omitempty"`
+	Rollup          *TransformRollup       `json:"rollup,omitempty"`
+	NewDomain       *TransformNewDomain    `json:"new-domain,omitempty"`
+	Resolution      *TransformResolution   `json:"resolution,omitempty"`
+	Enrichment      map[string]string      `json:"enrichment,omitempty"`
 	Relabeling      *TransformRelabeling   `json:"-"`
 }
 
@@ -278,9 +407,20 @@ func (dm *DNSMessage) InitTransforms() {
 	dm.Reducer = &TransformReducer{}
 	dm.Extracted = &TransformExtracted{}
 	dm.PublicSuffix = &TransformPublicSuffix{}
-	dm.Suspicious = &TransformSuspicious{}
+	dm.IDN = &TransformIDN{QnameUnicode: "-", Brand: "-"}
+	dm.Suspicious = &TransformSuspicious{Reasons: []string{}}
 	dm.Geo = &TransformDNSGeo{}
 	dm.Relabeling = &TransformRelabeling{}
+	dm.Correlation = &TransformCorrelation{Status: "-", QueryTimestamp: "-", ReplyTimestamp: "-",
+		QueryEDNS: DNSExtended{Options: []DNSOption{}}, ReplyEDNS: DNSExtended{Options: []DNSOption{}}}
+	dm.Upstream = &TransformUpstream{Cache: "-"}
+	dm.ThreatIntel = &TransformThreatIntel{Matches: []ThreatIntelMatch{}}
+	dm.Tunneling = &TransformTunneling{Reasons: []string{}, Domain: "-"}
+	dm.Anomaly = &TransformAnomaly{Reasons: []string{}}
+	dm.Rollup = &TransformRollup{Group: map[string]string{}}
+	dm.NewDomain = &TransformNewDomain{QnameFirstSeen: "-", ClientFirstSeen: "-", ETLDPlusOneFirstSeen: "-"}
+	dm.Resolution = &TransformResolution{FinalName: "-", CNAMEChain: []string{}, ResolvedIPs: []string{}}
+	dm.Enrichment = map[string]string{}
 	// init collectors & loggers
 	dm.PowerDNS = &CollectorPowerDNS{}
 	dm.OpenTelemetry = &LoggerOpenTelemetry{}
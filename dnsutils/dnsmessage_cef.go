@@ -0,0 +1,144 @@
+package dnsutils
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+	leefValueEscaper    = strings.NewReplacer("\t", `\t`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+)
+
+// SIEMSeverity converts the suspicious score to the 0-10 severity scale used by CEF and LEEF
+func (dm *DNSMessage) SIEMSeverity() int {
+	if dm.Suspicious == nil {
+		return 0
+	}
+	severity := int(dm.Suspicious.Score)
+	if severity < 0 {
+		return 0
+	}
+	if severity > 10 {
+		return 10
+	}
+	return severity
+}
+
+type siemField struct {
+	key, value string
+}
+
+func (dm *DNSMessage) siemTimestamp() string {
+	if dm.DNSTap.Timestamp == 0 {
+		return ""
+	}
+	return strconv.FormatInt(dm.DNSTap.Timestamp/1000000, 10)
+}
+
+func (dm *DNSMessage) siemEventName() string {
+	if dm.DNS.Type == DNSQuery || dm.DNS.Type == DNSReply {
+		return "DNS " + strings.ToLower(dm.DNS.Type)
+	}
+	return "DNS message"
+}
+
+// ToCEF encodes the dns message in ArcSight Common Event Format
+// CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+func (dm *DNSMessage) ToCEF(vendor, product, version string, s *bytes.Buffer) {
+	s.WriteString("CEF:0|")
+	s.WriteString(cefHeaderEscaper.Replace(vendor))
+	s.WriteByte('|')
+	s.WriteString(cefHeaderEscaper.Replace(product))
+	s.WriteByte('|')
+	s.WriteString(cefHeaderEscaper.Replace(version))
+	s.WriteByte('|')
+	s.WriteString(cefHeaderEscaper.Replace(dm.DNS.Type))
+	s.WriteByte('|')
+	s.WriteString(cefHeaderEscaper.Replace(dm.siemEventName()))
+	s.WriteByte('|')
+	s.WriteString(strconv.Itoa(dm.SIEMSeverity()))
+	s.WriteByte('|')
+
+	ext := []siemField{
+		{"rt", dm.siemTimestamp()},
+		{"src", dm.NetworkInfo.QueryIP},
+		{"spt", dm.NetworkInfo.QueryPort},
+		{"dst", dm.NetworkInfo.ResponseIP},
+		{"dpt", dm.NetworkInfo.ResponsePort},
+		{"proto", dm.NetworkInfo.Protocol},
+		{"dvchost", dm.DNSTap.Identity},
+		{"request", dm.DNS.Qname},
+		{"outcome", dm.DNS.Rcode},
+		{"cs1Label", "qtype"},
+		{"cs1", dm.DNS.Qtype},
+		{"cs2Label", "operation"},
+		{"cs2", dm.DNSTap.Operation},
+	}
+	if dm.DNS.Type == DNSReply {
+		ext = append(ext, siemField{"cn1Label", "latencyMs"}, siemField{"cn1", strconv.Itoa(dm.DNSTap.LatencyMs)})
+	}
+
+	first := true
+	for _, kv := range ext {
+		// skip unknown values, CEF expects typed fields (ip, port)
+		if len(kv.value) == 0 || kv.value == "-" {
+			continue
+		}
+		if !first {
+			s.WriteByte(' ')
+		}
+		first = false
+		s.WriteString(kv.key)
+		s.WriteByte('=')
+		s.WriteString(cefExtensionEscaper.Replace(kv.value))
+	}
+}
+
+// ToLEEF encodes the dns message in IBM QRadar Log Event Extended Format (1.0)
+// LEEF:Version|Vendor|Product|Version|EventID|Extension (tab separated)
+func (dm *DNSMessage) ToLEEF(vendor, product, version string, s *bytes.Buffer) {
+	s.WriteString("LEEF:1.0|")
+	s.WriteString(cefHeaderEscaper.Replace(vendor))
+	s.WriteByte('|')
+	s.WriteString(cefHeaderEscaper.Replace(product))
+	s.WriteByte('|')
+	s.WriteString(cefHeaderEscaper.Replace(version))
+	s.WriteByte('|')
+	s.WriteString(cefHeaderEscaper.Replace(dm.DNS.Type))
+	s.WriteByte('|')
+
+	ext := []siemField{
+		{"devTime", dm.siemTimestamp()},
+		{"src", dm.NetworkInfo.QueryIP},
+		{"srcPort", dm.NetworkInfo.QueryPort},
+		{"dst", dm.NetworkInfo.ResponseIP},
+		{"dstPort", dm.NetworkInfo.ResponsePort},
+		{"proto", dm.NetworkInfo.Protocol},
+		{"sev", strconv.Itoa(dm.SIEMSeverity())},
+		{"identHostName", dm.DNSTap.Identity},
+		{"qname", dm.DNS.Qname},
+		{"qtype", dm.DNS.Qtype},
+		{"rcode", dm.DNS.Rcode},
+		{"operation", dm.DNSTap.Operation},
+	}
+	if dm.DNS.Type == DNSReply {
+		ext = append(ext, siemField{"latencyMs", strconv.Itoa(dm.DNSTap.LatencyMs)})
+	}
+
+	first := true
+	for _, kv := range ext {
+		if len(kv.value) == 0 || kv.value == "-" {
+			continue
+		}
+		if !first {
+			s.WriteByte('\t')
+		}
+		first = false
+		s.WriteString(kv.key)
+		s.WriteByte('=')
+		s.WriteString(leefValueEscaper.Replace(kv.value))
+	}
+}
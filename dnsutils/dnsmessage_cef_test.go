@@ -0,0 +1,76 @@
+package dnsutils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDnsMessage_ToCEF(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.DNSTap.Timestamp = 1700000000123000000
+
+	var buf bytes.Buffer
+	dm.ToCEF("dmachard", "DNScollector", "1.0", &buf)
+
+	want := "CEF:0|dmachard|DNScollector|1.0|QUERY|DNS query|0|rt=1700000000123 src=1.2.3.4 spt=1234 dst=4.3.2.1 dpt=4321 " +
+		"proto=UDP dvchost=collector request=dns.collector outcome=NOERROR cs1Label=qtype cs1=A cs2Label=operation cs2=CLIENT_QUERY"
+	if buf.String() != want {
+		t.Errorf("cef mismatch\nwant: %s\ngot:  %s", want, buf.String())
+	}
+}
+
+func TestDnsMessage_ToCEF_Escaping(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.DNS.Qname = "a=b\\c\nd|e"
+
+	var buf bytes.Buffer
+	dm.ToCEF("ven|dor", "pro\\duct", "1.0", &buf)
+
+	wantHeader := `CEF:0|ven\|dor|pro\\duct|1.0|`
+	if !bytes.HasPrefix(buf.Bytes(), []byte(wantHeader)) {
+		t.Errorf("cef header not escaped: %s", buf.String())
+	}
+	wantRequest := `request=a\=b\\c\nd|e`
+	if !bytes.Contains(buf.Bytes(), []byte(wantRequest)) {
+		t.Errorf("cef extension not escaped, want %s in: %s", wantRequest, buf.String())
+	}
+}
+
+func TestDnsMessage_ToCEF_Severity(t *testing.T) {
+	testcases := []struct {
+		name  string
+		score float64
+		want  string
+	}{
+		{name: "low", score: 3, want: "|DNS query|3|"},
+		{name: "capped", score: 25, want: "|DNS query|10|"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := GetFakeDNSMessage()
+			dm.Suspicious = &TransformSuspicious{Score: tc.score}
+
+			var buf bytes.Buffer
+			dm.ToCEF("v", "p", "1", &buf)
+			if !bytes.Contains(buf.Bytes(), []byte(tc.want)) {
+				t.Errorf("severity mismatch, want %s in: %s", tc.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestDnsMessage_ToLEEF(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.DNS.Type = DNSReply
+	dm.DNSTap.LatencyMs = 12
+
+	var buf bytes.Buffer
+	dm.ToLEEF("dmachard", "DNScollector", "1.0", &buf)
+
+	want := "LEEF:1.0|dmachard|DNScollector|1.0|REPLY|src=1.2.3.4\tsrcPort=1234\tdst=4.3.2.1\tdstPort=4321\t" +
+		"proto=UDP\tsev=0\tidentHostName=collector\tqname=dns.collector\tqtype=A\trcode=NOERROR\toperation=CLIENT_QUERY\tlatencyMs=12"
+	if buf.String() != want {
+		t.Errorf("leef mismatch\nwant: %q\ngot:  %q", want, buf.String())
+	}
+}
@@ -0,0 +1,81 @@
+package dnsutils
+
+import (
+	"reflect"
+)
+
+// Copy returns a deep copy of the message, the pointers of the transforms, the slices
+// and the maps are cloned to use the copy in another goroutine
+func (dm *DNSMessage) Copy() DNSMessage {
+	var cp DNSMessage
+	deepCopyValue(reflect.ValueOf(&cp).Elem(), reflect.ValueOf(dm).Elem())
+	return cp
+}
+
+func deepCopyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		// the structs with private fields (regexp...) are read only and shared
+		if src.Elem().Kind() == reflect.Struct && !exportedOnly(src.Elem().Type()) {
+			dst.Set(src)
+			return
+		}
+		ptr := reflect.New(src.Elem().Type())
+		deepCopyValue(ptr.Elem(), src.Elem())
+		dst.Set(ptr)
+
+	case reflect.Struct:
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				deepCopyValue(dst.Field(i), src.Field(i))
+			}
+		}
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		slice := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			deepCopyValue(slice.Index(i), src.Index(i))
+		}
+		dst.Set(slice)
+
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		m := reflect.MakeMapWithSize(src.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			value := reflect.New(iter.Value().Type()).Elem()
+			deepCopyValue(value, iter.Value())
+			m.SetMapIndex(iter.Key(), value)
+		}
+		dst.Set(m)
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		deepCopyValue(value, src.Elem())
+		dst.Set(value)
+
+	default:
+		dst.Set(src)
+	}
+}
+
+func exportedOnly(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			return false
+		}
+	}
+	return true
+}
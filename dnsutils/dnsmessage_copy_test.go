@@ -0,0 +1,40 @@
+package dnsutils
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestDnsMessage_Copy(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.InitTransforms()
+	dm.ATags.Tags = []string{"tag1"}
+	dm.Suspicious.Score = 1
+	dm.DNS.DNSRRs.Answers = append(dm.DNS.DNSRRs.Answers, DNSAnswer{Name: "dns.collector", Rdatatype: "A", Rdata: "192.0.2.1"})
+	dm.EDNS.Options = append(dm.EDNS.Options, DNSOption{Code: 8, Name: "CSUBNET", Data: "192.0.2.0/24"})
+	dm.Enrichment["owner"] = "team1"
+	dm.Relabeling.Rules = []RelabelingRule{{Regex: regexp.MustCompile("^dns"), Action: "remove"}}
+
+	cp := dm.Copy()
+	if !reflect.DeepEqual(dm, cp) {
+		t.Fatalf("copy different from the message")
+	}
+
+	// update the copy, the message must not change
+	cp.ATags.Tags[0] = "tag2"
+	cp.Suspicious.Score = 2
+	cp.DNS.DNSRRs.Answers[0].Rdata = "192.0.2.2"
+	cp.EDNS.Options[0].Data = "198.51.100.0/24"
+	cp.Enrichment["owner"] = "team2"
+
+	if dm.ATags.Tags[0] != "tag1" || dm.Suspicious.Score != 1 || dm.DNS.DNSRRs.Answers[0].Rdata != "192.0.2.1" ||
+		dm.EDNS.Options[0].Data != "192.0.2.0/24" || dm.Enrichment["owner"] != "team1" {
+		t.Errorf("message updated by the copy")
+	}
+
+	// the compiled regexps are shared
+	if cp.Relabeling.Rules[0].Regex != dm.Relabeling.Rules[0].Regex {
+		t.Errorf("regexp should be shared")
+	}
+}
@@ -119,7 +119,8 @@ func (dm *DNSMessage) ToDNSTap(extended bool) ([]byte, error) {
 		// add filtering
 		if dm.Filtering != nil {
 			ednstap.Filtering = &ExtendedFiltering{
-				SampleRate: uint32(dm.Filtering.SampleRate),
+				SampleRate:     uint32(dm.Filtering.SampleRate),
+				SampleFraction: dm.Filtering.SampleFraction,
 			}
 		}
 
@@ -140,6 +140,24 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields["geoip.country-isocode"] = dm.Geo.CountryIsoCode
 		dnsFields["geoip.as-number"] = dm.Geo.AutonomousSystemNumber
 		dnsFields["geoip.as-owner"] = dm.Geo.AutonomousSystemOrg
+		dnsFields["geoip.subdivision"] = dm.Geo.Subdivision
+		dnsFields["geoip.postal-code"] = dm.Geo.PostalCode
+		dnsFields["geoip.latitude"] = dm.Geo.Latitude
+		dnsFields["geoip.longitude"] = dm.Geo.Longitude
+		dnsFields["geoip.timezone"] = dm.Geo.TimeZone
+		dnsFields["geoip.isp"] = dm.Geo.ISP
+		dnsFields["geoip.organization"] = dm.Geo.Organization
+		dnsFields["geoip.anonymous"] = dm.Geo.Anonymous
+		dnsFields["geoip.anonymous-vpn"] = dm.Geo.AnonymousVPN
+		dnsFields["geoip.hosting-provider"] = dm.Geo.HostingProvider
+		dnsFields["geoip.public-proxy"] = dm.Geo.PublicProxy
+		dnsFields["geoip.tor-exit-node"] = dm.Geo.TorExitNode
+		if dm.Geo.ResponseIP != nil {
+			flattenGeoLocation(dnsFields, "geoip.response-ip", dm.Geo.ResponseIP)
+		}
+		for i := range dm.Geo.Answers {
+			flattenGeoLocation(dnsFields, "geoip.answers."+strconv.Itoa(i), &dm.Geo.Answers[i])
+		}
 	}
 
 	// Add TransformSuspicious fields
@@ -153,6 +171,12 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields["suspicious.uncommon-qtypes"] = dm.Suspicious.UncommonQtypes
 		dnsFields["suspicious.excessive-number-labels"] = dm.Suspicious.ExcessiveNumberLabels
 		dnsFields["suspicious.domain"] = dm.Suspicious.Domain
+		if len(dm.Suspicious.Reasons) == 0 {
+			dnsFields["suspicious.reasons"] = "-"
+		}
+		for i, reason := range dm.Suspicious.Reasons {
+			dnsFields["suspicious.reasons."+strconv.Itoa(i)] = reason
+		}
 	}
 
 	// Add TransformPublicSuffix fields
@@ -162,6 +186,14 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields["publicsuffix.managed-icann"] = dm.PublicSuffix.ManagedByICANN
 	}
 
+	// Add TransformIDN fields
+	if dm.IDN != nil {
+		dnsFields["idn.qname-unicode"] = dm.IDN.QnameUnicode
+		dnsFields["idn.mixed-script"] = dm.IDN.MixedScript
+		dnsFields["idn.confusable"] = dm.IDN.Confusable
+		dnsFields["idn.brand"] = dm.IDN.Brand
+	}
+
 	// Add TransformExtracted fields
 	if dm.Extracted != nil {
 		dnsFields["extracted.dns_payload"] = dm.Extracted.Base64Payload
@@ -176,6 +208,7 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 	// Add TransformFiltering fields
 	if dm.Filtering != nil {
 		dnsFields["filtering.sample-rate"] = dm.Filtering.SampleRate
+		dnsFields["filtering.sample-fraction"] = dm.Filtering.SampleFraction
 	}
 
 	// Add TransformML fields
@@ -199,6 +232,8 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields["ml.size"] = dm.MachineLearning.Size
 		dnsFields["ml.occurrences"] = dm.MachineLearning.Occurrences
 		dnsFields["ml.uncommon-qtypes"] = dm.MachineLearning.UncommonQtypes
+		dnsFields["ml.bigram-score"] = dm.MachineLearning.BigramScore
+		dnsFields["ml.dga-probability"] = dm.MachineLearning.DGAProbability
 	}
 
 	// Add TransformATags fields
@@ -211,6 +246,149 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		}
 	}
 
+	// Add TransformCorrelation fields, edns options are not flattened
+	if dm.Correlation != nil {
+		dnsFields["correlation.status"] = dm.Correlation.Status
+		dnsFields["correlation.query-timestamp-rfc3339ns"] = dm.Correlation.QueryTimestamp
+		dnsFields["correlation.reply-timestamp-rfc3339ns"] = dm.Correlation.ReplyTimestamp
+		dnsFields["correlation.query-length"] = dm.Correlation.QueryLength
+		dnsFields["correlation.reply-length"] = dm.Correlation.ReplyLength
+		for prefix, flags := range map[string]DNSFlags{"query-flags": dm.Correlation.QueryFlags, "reply-flags": dm.Correlation.ReplyFlags} {
+			dnsFields["correlation."+prefix+".qr"] = flags.QR
+			dnsFields["correlation."+prefix+".tc"] = flags.TC
+			dnsFields["correlation."+prefix+".aa"] = flags.AA
+			dnsFields["correlation."+prefix+".ra"] = flags.RA
+			dnsFields["correlation."+prefix+".ad"] = flags.AD
+			dnsFields["correlation."+prefix+".rd"] = flags.RD
+			dnsFields["correlation."+prefix+".cd"] = flags.CD
+		}
+		for prefix, edns := range map[string]DNSExtended{"query-edns": dm.Correlation.QueryEDNS, "reply-edns": dm.Correlation.ReplyEDNS} {
+			dnsFields["correlation."+prefix+".dnssec-ok"] = edns.Do
+			dnsFields["correlation."+prefix+".rcode"] = edns.ExtendedRcode
+			dnsFields["correlation."+prefix+".udp-size"] = edns.UDPSize
+			dnsFields["correlation."+prefix+".version"] = edns.Version
+		}
+	}
+
+	// Add TransformUpstream fields
+	if dm.Upstream != nil {
+		dnsFields["upstream.queries"] = dm.Upstream.Queries
+		dnsFields["upstream.round-trips"] = dm.Upstream.RoundTrips
+		dnsFields["upstream.latency"] = dm.Upstream.Latency
+		dnsFields["upstream.latency_ms"] = dm.Upstream.LatencyMs
+		dnsFields["upstream.cache"] = dm.Upstream.Cache
+	}
+
+	// Add TransformTunneling fields
+	if dm.Tunneling != nil {
+		dnsFields["tunneling.score"] = dm.Tunneling.Score
+		dnsFields["tunneling.domain"] = dm.Tunneling.Domain
+		dnsFields["tunneling.unique-subdomains"] = dm.Tunneling.UniqueSubdomains
+		dnsFields["tunneling.entropy"] = dm.Tunneling.Entropy
+		dnsFields["tunneling.bytes"] = dm.Tunneling.Bytes
+		if len(dm.Tunneling.Reasons) == 0 {
+			dnsFields["tunneling.reasons"] = "-"
+		}
+		for i, reason := range dm.Tunneling.Reasons {
+			dnsFields["tunneling.reasons."+strconv.Itoa(i)] = reason
+		}
+	}
+
+	// Add TransformAnomaly fields
+	if dm.Anomaly != nil {
+		dnsFields["anomaly.anomalous"] = dm.Anomaly.Anomalous
+		dnsFields["anomaly.queries-deviation"] = dm.Anomaly.QueriesDeviation
+		dnsFields["anomaly.nxdomain-deviation"] = dm.Anomaly.NXDomainDeviation
+		dnsFields["anomaly.unique-qnames-deviation"] = dm.Anomaly.UniqueQnamesDeviation
+		if len(dm.Anomaly.Reasons) == 0 {
+			dnsFields["anomaly.reasons"] = "-"
+		}
+		for i, reason := range dm.Anomaly.Reasons {
+			dnsFields["anomaly.reasons."+strconv.Itoa(i)] = reason
+		}
+	}
+
+	// Add TransformRollup fields
+	if dm.Rollup != nil {
+		dnsFields["rollup.window-start"] = dm.Rollup.WindowStart
+		dnsFields["rollup.window-end"] = dm.Rollup.WindowEnd
+		dnsFields["rollup.count"] = dm.Rollup.Count
+		dnsFields["rollup.length-sum"] = dm.Rollup.LengthSum
+		dnsFields["rollup.length-min"] = dm.Rollup.LengthMin
+		dnsFields["rollup.length-max"] = dm.Rollup.LengthMax
+		dnsFields["rollup.length-avg"] = dm.Rollup.LengthAvg
+		dnsFields["rollup.latencies"] = dm.Rollup.Latencies
+		dnsFields["rollup.latency-sum"] = dm.Rollup.LatencySum
+		dnsFields["rollup.latency-min"] = dm.Rollup.LatencyMin
+		dnsFields["rollup.latency-max"] = dm.Rollup.LatencyMax
+		dnsFields["rollup.latency-avg"] = dm.Rollup.LatencyAvg
+		dnsFields["rollup.distinct-qnames"] = dm.Rollup.DistinctQnames
+		if len(dm.Rollup.Group) == 0 {
+			dnsFields["rollup.group"] = "-"
+		}
+		for key, value := range dm.Rollup.Group {
+			dnsFields["rollup.group."+key] = value
+		}
+	}
+
+	// Add TransformResolution fields
+	if dm.Resolution != nil {
+		dnsFields["resolution.final-name"] = dm.Resolution.FinalName
+		dnsFields["resolution.min-ttl"] = dm.Resolution.MinTTL
+		dnsFields["resolution.max-ttl"] = dm.Resolution.MaxTTL
+		dnsFields["resolution.broken"] = dm.Resolution.Broken
+		if len(dm.Resolution.CNAMEChain) == 0 {
+			dnsFields["resolution.cname-chain"] = "-"
+		}
+		for i, name := range dm.Resolution.CNAMEChain {
+			dnsFields["resolution.cname-chain."+strconv.Itoa(i)] = name
+		}
+		if len(dm.Resolution.ResolvedIPs) == 0 {
+			dnsFields["resolution.resolved-ips"] = "-"
+		}
+		for i, ip := range dm.Resolution.ResolvedIPs {
+			dnsFields["resolution.resolved-ips."+strconv.Itoa(i)] = ip
+		}
+	}
+
+	// Add TransformNewDomain fields
+	if dm.NewDomain != nil {
+		dnsFields["new-domain.new-qname"] = dm.NewDomain.NewQname
+		dnsFields["new-domain.qname-first-seen"] = dm.NewDomain.QnameFirstSeen
+		dnsFields["new-domain.new-for-client"] = dm.NewDomain.NewForClient
+		dnsFields["new-domain.client-first-seen"] = dm.NewDomain.ClientFirstSeen
+		dnsFields["new-domain.new-etld-plus-one"] = dm.NewDomain.NewETLDPlusOne
+		dnsFields["new-domain.etld-plus-one-first-seen"] = dm.NewDomain.ETLDPlusOneFirstSeen
+	}
+
+	// Add lookup enrichment fields
+	if dm.Enrichment != nil {
+		if len(dm.Enrichment) == 0 {
+			dnsFields["enrichment"] = "-"
+		}
+		for key, value := range dm.Enrichment {
+			dnsFields["enrichment."+key] = value
+		}
+	}
+
+	// Add TransformThreatIntel fields
+	if dm.ThreatIntel != nil {
+		if len(dm.ThreatIntel.Matches) == 0 {
+			dnsFields["threatintel.matches"] = "-"
+		}
+		for i, match := range dm.ThreatIntel.Matches {
+			prefix := "threatintel.matches." + strconv.Itoa(i)
+			dnsFields[prefix+".list"] = match.List
+			dnsFields[prefix+".category"] = match.Category
+			dnsFields[prefix+".severity"] = match.Severity
+			dnsFields[prefix+".field"] = match.Field
+			dnsFields[prefix+".indicator"] = match.Indicator
+			if len(match.Action) > 0 {
+				dnsFields[prefix+".action"] = match.Action
+			}
+		}
+	}
+
 	// Add PowerDNS collectors fields
 	if dm.PowerDNS != nil {
 		if len(dm.PowerDNS.Tags) == 0 {
@@ -248,3 +426,202 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 
 	return dnsFields, nil
 }
+
+// Unflatten decodes a message produced by Flatten, resource records and edns options
+// are rebuilt from the values joined with the pipe separator. Relabeled keys are ignored.
+func (dm *DNSMessage) Unflatten(flat map[string]interface{}) error {
+	nested := map[string]interface{}{}
+	rrs := map[string]map[string]string{"an": {}, "ns": {}, "ar": {}}
+	threatMatches := map[int]map[string]interface{}{}
+	geoAnswers := map[int]map[string]interface{}{}
+	ednsOptions := map[string]string{}
+
+	for key, value := range flat {
+		path := strings.Split(key, ".")
+		switch {
+		case strings.HasPrefix(key, "dns.resource-records.") && len(path) == 4:
+			if fields, ok := rrs[path[2]]; ok {
+				fields[path[3]], _ = value.(string)
+			}
+			continue
+		case strings.HasPrefix(key, "edns.options.") && len(path) == 3:
+			ednsOptions[path[2]], _ = value.(string)
+			continue
+		case key == "edns.optionscount":
+			continue
+		case key == "threatintel.matches":
+			unflattenSet(nested, path, []interface{}{})
+			continue
+		case strings.HasPrefix(key, "threatintel.matches.") && len(path) == 4:
+			index, err := strconv.Atoi(path[2])
+			if err != nil {
+				continue
+			}
+			if _, ok := threatMatches[index]; !ok {
+				threatMatches[index] = map[string]interface{}{}
+			}
+			threatMatches[index][path[3]] = value
+			continue
+		case strings.HasPrefix(key, "geoip.answers.") && len(path) == 4:
+			index, err := strconv.Atoi(path[2])
+			if err != nil {
+				continue
+			}
+			if _, ok := geoAnswers[index]; !ok {
+				geoAnswers[index] = map[string]interface{}{}
+			}
+			geoAnswers[index][path[3]] = value
+			continue
+		case key == "atags.tags" || key == "powerdns.tags" || key == "tunneling.reasons" || key == "anomaly.reasons" || key == "suspicious.reasons" ||
+			key == "resolution.cname-chain" || key == "resolution.resolved-ips":
+			// "-" is used when the list is empty
+			unflattenSet(nested, path, []interface{}{})
+			continue
+		case (strings.HasPrefix(key, "atags.tags.") || strings.HasPrefix(key, "powerdns.tags.") || strings.HasPrefix(key, "tunneling.reasons.") ||
+			strings.HasPrefix(key, "anomaly.reasons.") || strings.HasPrefix(key, "suspicious.reasons.") ||
+			strings.HasPrefix(key, "resolution.cname-chain.") || strings.HasPrefix(key, "resolution.resolved-ips.")) && len(path) == 3:
+			index, err := strconv.Atoi(path[2])
+			if err != nil {
+				continue
+			}
+			parent := unflattenParent(nested, path[:1])
+			tags, _ := parent[path[1]].([]interface{})
+			for len(tags) <= index {
+				tags = append(tags, "")
+			}
+			tags[index] = value
+			parent[path[1]] = tags
+			continue
+		case strings.HasPrefix(key, "powerdns.metadata."):
+			// metadata keys can contain dots
+			path = []string{"powerdns", "metadata", strings.TrimPrefix(key, "powerdns.metadata.")}
+		case key == "enrichment":
+			unflattenSet(nested, path, map[string]interface{}{})
+			continue
+		case strings.HasPrefix(key, "enrichment."):
+			// column names can contain dots
+			path = []string{"enrichment", strings.TrimPrefix(key, "enrichment.")}
+		case key == "rollup.group":
+			unflattenSet(nested, path, map[string]interface{}{})
+			continue
+		case strings.HasPrefix(key, "rollup.group."):
+			// group keys are field names with dots
+			path = []string{"rollup", "group", strings.TrimPrefix(key, "rollup.group.")}
+		}
+		unflattenSet(nested, path, value)
+	}
+
+	if len(threatMatches) > 0 {
+		matches := make([]interface{}, len(threatMatches))
+		for index, match := range threatMatches {
+			if index < len(matches) {
+				matches[index] = match
+			}
+		}
+		unflattenSet(nested, []string{"threatintel", "matches"}, matches)
+	}
+
+	if len(geoAnswers) > 0 {
+		answers := make([]interface{}, len(geoAnswers))
+		for index, answer := range geoAnswers {
+			if index < len(answers) {
+				answers[index] = answer
+			}
+		}
+		unflattenSet(nested, []string{"geoip", "answers"}, answers)
+	}
+
+	data, err := json.Marshal(nested)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dm); err != nil {
+		return err
+	}
+
+	dm.DNS.DNSRRs.Answers = unflattenRRs(rrs["an"])
+	dm.DNS.DNSRRs.Nameservers = unflattenRRs(rrs["ns"])
+	dm.DNS.DNSRRs.Records = unflattenRRs(rrs["ar"])
+
+	if dm.Correlation != nil {
+		dm.Correlation.QueryEDNS.Options = []DNSOption{}
+		dm.Correlation.ReplyEDNS.Options = []DNSOption{}
+	}
+
+	dm.EDNS.Options = []DNSOption{}
+	codes := splitOrEmpty(ednsOptions["codes"])
+	names := splitOrEmpty(ednsOptions["names"])
+	datas := splitOrEmpty(ednsOptions["datas"])
+	for i := range codes {
+		opt := DNSOption{}
+		opt.Code, _ = strconv.Atoi(codes[i])
+		if i < len(names) {
+			opt.Name = names[i]
+		}
+		if i < len(datas) {
+			opt.Data = datas[i]
+		}
+		dm.EDNS.Options = append(dm.EDNS.Options, opt)
+	}
+	return nil
+}
+
+func flattenGeoLocation(dnsFields map[string]interface{}, prefix string, location *GeoLocation) {
+	dnsFields[prefix+".ip"] = location.IP
+	dnsFields[prefix+".city"] = location.City
+	dnsFields[prefix+".continent"] = location.Continent
+	dnsFields[prefix+".country-isocode"] = location.CountryIsoCode
+	dnsFields[prefix+".as-number"] = location.AutonomousSystemNumber
+	dnsFields[prefix+".as-owner"] = location.AutonomousSystemOrg
+}
+
+func unflattenParent(nested map[string]interface{}, path []string) map[string]interface{} {
+	current := nested
+	for _, p := range path {
+		next, ok := current[p].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[p] = next
+		}
+		current = next
+	}
+	return current
+}
+
+func unflattenSet(nested map[string]interface{}, path []string, value interface{}) {
+	parent := unflattenParent(nested, path[:len(path)-1])
+	parent[path[len(path)-1]] = value
+}
+
+func splitOrEmpty(s string) []string {
+	if len(s) == 0 || s == "-" {
+		return nil
+	}
+	return strings.Split(s, "|")
+}
+
+func unflattenRRs(fields map[string]string) []DNSAnswer {
+	rrs := []DNSAnswer{}
+	names := splitOrEmpty(fields["names"])
+	types := splitOrEmpty(fields["rdatatypes"])
+	datas := splitOrEmpty(fields["rdatas"])
+	ttls := splitOrEmpty(fields["ttls"])
+	classes := splitOrEmpty(fields["classes"])
+	for i, name := range names {
+		rr := DNSAnswer{Name: name}
+		if i < len(types) {
+			rr.Rdatatype = types[i]
+		}
+		if i < len(datas) {
+			rr.Rdata = datas[i]
+		}
+		if i < len(ttls) {
+			rr.TTL, _ = strconv.Atoi(ttls[i])
+		}
+		if i < len(classes) {
+			rr.Class = classes[i]
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
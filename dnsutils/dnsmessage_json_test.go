@@ -222,10 +222,11 @@ func TestDnsMessage_Json_Transforms_Reference(t *testing.T) {
 	}{
 		{
 			transform: "filtering",
-			dmRef:     DNSMessage{Filtering: &TransformFiltering{SampleRate: 22}},
+			dmRef:     DNSMessage{Filtering: &TransformFiltering{SampleRate: 22, SampleFraction: 0.25}},
 			jsonRef: `{
 						"filtering": {
-						"sample-rate": 22
+						"sample-rate": 22,
+						"sample-fraction": 0.25
 						}
 					}`,
 		},
@@ -265,6 +266,15 @@ func TestDnsMessage_Json_Transforms_Reference(t *testing.T) {
 					CountryIsoCode:         "FR",
 					AutonomousSystemNumber: "1234",
 					AutonomousSystemOrg:    "Internet",
+					Subdivision:            "IDF",
+					PostalCode:             "75001",
+					Latitude:               48.8,
+					Longitude:              2.3,
+					TimeZone:               "Europe/Paris",
+					ISP:                    "Orange",
+					Organization:           "Orange",
+					HostingProvider:        true,
+					ResponseIP:             &GeoLocation{IP: "1.2.3.4", CountryIsoCode: "US"},
 				},
 			},
 			jsonRef: `{
@@ -273,7 +283,27 @@ func TestDnsMessage_Json_Transforms_Reference(t *testing.T) {
 							"continent": "Europe",
 							"country-isocode": "FR",
 							"as-number": "1234",
-							"as-owner": "Internet"
+							"as-owner": "Internet",
+							"subdivision": "IDF",
+							"postal-code": "75001",
+							"latitude": 48.8,
+							"longitude": 2.3,
+							"timezone": "Europe/Paris",
+							"isp": "Orange",
+							"organization": "Orange",
+							"anonymous": false,
+							"anonymous-vpn": false,
+							"hosting-provider": true,
+							"public-proxy": false,
+							"tor-exit-node": false,
+							"response-ip": {
+								"ip": "1.2.3.4",
+								"city": "",
+								"continent": "",
+								"country-isocode": "US",
+								"as-number": "",
+								"as-owner": ""
+							}
 						}
 					}`,
 		},
@@ -535,9 +565,10 @@ func TestDnsMessage_JsonFlatten_Transforms_Reference(t *testing.T) {
 	}{
 		{
 			transform: "filtering",
-			dm:        DNSMessage{Filtering: &TransformFiltering{SampleRate: 22}},
+			dm:        DNSMessage{Filtering: &TransformFiltering{SampleRate: 22, SampleFraction: 0.25}},
 			jsonRef: `{
-						"filtering.sample-rate": 22
+						"filtering.sample-rate": 22,
+						"filtering.sample-fraction": 0.25
 					  }`,
 		},
 		{
@@ -570,6 +601,9 @@ func TestDnsMessage_JsonFlatten_Transforms_Reference(t *testing.T) {
 					CountryIsoCode:         "FR",
 					AutonomousSystemNumber: "1234",
 					AutonomousSystemOrg:    "Internet",
+					TimeZone:               "Europe/Paris",
+					TorExitNode:            true,
+					Answers:                []GeoLocation{{IP: "1.2.3.4", CountryIsoCode: "US"}},
 				},
 			},
 			jsonRef: `{
@@ -577,7 +611,11 @@ func TestDnsMessage_JsonFlatten_Transforms_Reference(t *testing.T) {
 						"geoip.continent": "Europe",
 						"geoip.country-isocode": "FR",
 						"geoip.as-number": "1234",
-						"geoip.as-owner": "Internet"
+						"geoip.as-owner": "Internet",
+						"geoip.timezone": "Europe/Paris",
+						"geoip.tor-exit-node": true,
+						"geoip.answers.0.ip": "1.2.3.4",
+						"geoip.answers.0.country-isocode": "US"
 					}`,
 		},
 		{
@@ -591,6 +629,7 @@ func TestDnsMessage_JsonFlatten_Transforms_Reference(t *testing.T) {
 				UncommonQtypes:        false,
 				ExcessiveNumberLabels: true,
 				Domain:                "gogle.co",
+				Reasons:               []string{"long-domain", "large-pkt"},
 			}},
 			jsonRef: `{
 						"suspicious.score": 1.0,
@@ -601,7 +640,9 @@ func TestDnsMessage_JsonFlatten_Transforms_Reference(t *testing.T) {
 						"suspicious.unallowed-chars": true,
 						"suspicious.uncommon-qtypes": false,
 						"suspicious.excessive-number-labels": true,
-						"suspicious.domain": "gogle.co"
+						"suspicious.domain": "gogle.co",
+						"suspicious.reasons.0": "long-domain",
+						"suspicious.reasons.1": "large-pkt"
 					  }`,
 		},
 		{
@@ -664,6 +705,19 @@ func TestDnsMessage_JsonFlatten_Transforms_Reference(t *testing.T) {
 						"atags.tags.1": "test1"
 					  }`,
 		},
+		{
+			transform: "threatintel",
+			dm: DNSMessage{ThreatIntel: &TransformThreatIntel{Matches: []ThreatIntelMatch{
+				{List: "rpz", Category: "malware", Severity: "high", Field: "qname", Indicator: "bad.example", Action: "nxdomain"}}}},
+			jsonRef: `{
+						"threatintel.matches.0.list": "rpz",
+						"threatintel.matches.0.category": "malware",
+						"threatintel.matches.0.severity": "high",
+						"threatintel.matches.0.field": "qname",
+						"threatintel.matches.0.indicator": "bad.example",
+						"threatintel.matches.0.action": "nxdomain"
+					  }`,
+		},
 	}
 
 	for _, tc := range testcases {
@@ -784,3 +838,64 @@ func BenchmarkDnsMessage_ToFlatJSON(b *testing.B) {
 		}
 	}
 }
+
+func TestDnsMessage_Unflatten(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.DNSTap.LatencyMs = 12
+	dm.DNS.DNSRRs.Answers = []DNSAnswer{
+		{Name: "dns.collector", Rdatatype: "CNAME", Class: "IN", TTL: 300, Rdata: "edge.collector"},
+		{Name: "edge.collector", Rdatatype: "A", Class: "IN", TTL: 60, Rdata: "1.2.3.4"},
+	}
+	dm.EDNS.Options = []DNSOption{{Code: 10, Name: "COOKIE", Data: "aaaa"}}
+	dm.ATags = &TransformATags{Tags: []string{"tag1", "tag2"}}
+	dm.PublicSuffix = &TransformPublicSuffix{QnamePublicSuffix: "collector", QnameEffectiveTLDPlusOne: "dns.collector"}
+	dm.ThreatIntel = &TransformThreatIntel{Matches: []ThreatIntelMatch{
+		{List: "rpz", Category: "malware", Severity: "high", Field: "qname", Indicator: "dns.collector"},
+		{List: "c2", Category: "c2", Severity: "critical", Field: "rdata", Indicator: "1.2.3.0/24"},
+	}}
+
+	flat, err := dm.Flatten()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// decode from json to get the same types as a consumer
+	data, _ := json.Marshal(flat)
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+
+	dmOut := DNSMessage{}
+	dmOut.Init()
+	if err := dmOut.Unflatten(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(dmOut.DNS.DNSRRs.Answers, dm.DNS.DNSRRs.Answers) {
+		t.Errorf("answers mismatch: %v", dmOut.DNS.DNSRRs.Answers)
+	}
+	if !reflect.DeepEqual(dmOut.EDNS.Options, dm.EDNS.Options) {
+		t.Errorf("edns options mismatch: %v", dmOut.EDNS.Options)
+	}
+	if dmOut.DNS.Qname != dm.DNS.Qname || dmOut.NetworkInfo.QueryIP != dm.NetworkInfo.QueryIP || dmOut.DNSTap.LatencyMs != 12 {
+		t.Errorf("fields mismatch: %v", dmOut)
+	}
+	if dmOut.ATags == nil || !reflect.DeepEqual(dmOut.ATags.Tags, dm.ATags.Tags) {
+		t.Errorf("atags mismatch: %v", dmOut.ATags)
+	}
+	if dmOut.ThreatIntel == nil || !reflect.DeepEqual(dmOut.ThreatIntel.Matches, dm.ThreatIntel.Matches) {
+		t.Errorf("threatintel mismatch: %v", dmOut.ThreatIntel)
+	}
+	if dmOut.PublicSuffix == nil || dmOut.PublicSuffix.QnameEffectiveTLDPlusOne != "dns.collector" {
+		t.Errorf("public suffix mismatch: %v", dmOut.PublicSuffix)
+	}
+
+	// flatten again must give the same result
+	flatOut, err := dmOut.Flatten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataOut, _ := json.Marshal(flatOut)
+	if string(dataOut) != string(data) {
+		t.Errorf("flat round trip mismatch\nwant: %s\ngot:  %s", data, dataOut)
+	}
+}
@@ -1,6 +1,12 @@
 package dnsutils
 
-import "github.com/flosch/pongo2"
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
 
 func (dm *DNSMessage) ToTextTemplate(template string) (string, error) {
 	context := pongo2.Context{"dm": dm}
@@ -17,3 +23,73 @@ func (dm *DNSMessage) ToTextTemplate(template string) (string, error) {
 	}
 	return result, nil
 }
+
+// FieldTemplate is a string with placeholders referencing dns message fields by their json path,
+// for example "dns.{dnstap.identity}.{dns.rcode}", the double braces "{{dns.rcode}}" are also accepted.
+// The template is parsed once and resolved per message.
+type FieldTemplate struct {
+	parts  []string
+	fields []bool
+}
+
+func NewFieldTemplate(template string) (*FieldTemplate, error) {
+	t := &FieldTemplate{}
+	for len(template) > 0 {
+		start := strings.IndexByte(template, '{')
+		if start == -1 {
+			t.parts = append(t.parts, template)
+			t.fields = append(t.fields, false)
+			break
+		}
+		openDelim, closeDelim := "{", "}"
+		if strings.HasPrefix(template[start:], "{{") {
+			openDelim, closeDelim = "{{", "}}"
+		}
+		end := strings.Index(template[start:], closeDelim)
+		if end == -1 {
+			return nil, errors.New("field template: missing closing brace in " + template)
+		}
+		end += start
+
+		field := strings.TrimSpace(template[start+len(openDelim) : end])
+		if len(field) == 0 {
+			return nil, errors.New("field template: empty placeholder")
+		}
+		if start > 0 {
+			t.parts = append(t.parts, template[:start])
+			t.fields = append(t.fields, false)
+		}
+		t.parts = append(t.parts, field)
+		t.fields = append(t.fields, true)
+		template = template[end+len(closeDelim):]
+	}
+	return t, nil
+}
+
+// IsStatic returns true if the template does not contain any placeholder
+func (t *FieldTemplate) IsStatic() bool {
+	for _, isField := range t.fields {
+		if isField {
+			return false
+		}
+	}
+	return true
+}
+
+// Execute resolves the placeholders, unknown or unset fields are replaced by "-"
+func (t *FieldTemplate) Execute(dm *DNSMessage) string {
+	var b strings.Builder
+	for i, part := range t.parts {
+		if !t.fields[i] {
+			b.WriteString(part)
+			continue
+		}
+		value, found := GetFieldByJSONTag(reflect.ValueOf(dm).Elem(), part)
+		if !found || !value.CanInterface() {
+			b.WriteString("-")
+			continue
+		}
+		b.WriteString(ConvertToString(value.Interface()))
+	}
+	return b.String()
+}
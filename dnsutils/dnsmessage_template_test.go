@@ -63,3 +63,38 @@ func BenchmarkDnsMessage_ToJinjaFormat(b *testing.B) {
 		}
 	}
 }
+
+func TestDnsMessage_FieldTemplate(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.DNS.ID = 42
+
+	testcases := []struct {
+		template string
+		want     string
+	}{
+		{template: "dnscollector", want: "dnscollector"},
+		{template: "dns.{dnstap.identity}.{dns.rcode}", want: "dns.collector.NOERROR"},
+		{template: "{network.query-ip}#{dns.id}", want: "1.2.3.4#42"},
+		{template: "{geoip.country-isocode}", want: "-"},
+		{template: "{ dns.qtype }-suffix", want: "A-suffix"},
+		{template: "rcode:{{dns.rcode}}", want: "rcode:NOERROR"},
+		{template: "{{ dns.id }}/{dns.qtype}", want: "42/A"},
+	}
+
+	for _, tc := range testcases {
+		tmpl, err := NewFieldTemplate(tc.template)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", tc.template, err)
+		}
+		if got := tmpl.Execute(&dm); got != tc.want {
+			t.Errorf("template %s: want %s, got %s", tc.template, tc.want, got)
+		}
+	}
+
+	if _, err := NewFieldTemplate("dns.{dns.rcode"); err == nil {
+		t.Errorf("expected error with missing closing brace")
+	}
+	if _, err := NewFieldTemplate("dns.{{dns.rcode}"); err == nil {
+		t.Errorf("expected error with missing closing double brace")
+	}
+}
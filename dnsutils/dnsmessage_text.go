@@ -18,12 +18,21 @@ var (
 	GeoIPDirectives           = regexp.MustCompile(`^geoip-*`)
 	SuspiciousDirectives      = regexp.MustCompile(`^suspicious-*`)
 	PublicSuffixDirectives    = regexp.MustCompile(`^publicsuffix-*`)
+	IDNDirectives             = regexp.MustCompile(`^idn-*`)
 	ExtractedDirectives       = regexp.MustCompile(`^extracted-*`)
 	ReducerDirectives         = regexp.MustCompile(`^reducer-*`)
 	MachineLearningDirectives = regexp.MustCompile(`^ml-*`)
 	FilteringDirectives       = regexp.MustCompile(`^filtering-*`)
 	RawTextDirective          = regexp.MustCompile(`^ *\{.*\}`)
 	ATagsDirectives           = regexp.MustCompile(`^atags*`)
+	UpstreamDirectives        = regexp.MustCompile(`^upstream-*`)
+	ThreatIntelDirectives     = regexp.MustCompile(`^threatintel-*`)
+	TunnelingDirectives       = regexp.MustCompile(`^tunneling-*`)
+	AnomalyDirectives         = regexp.MustCompile(`^anomaly-*`)
+	RollupDirectives          = regexp.MustCompile(`^rollup-*`)
+	NewDomainDirectives       = regexp.MustCompile(`^new-domain-*`)
+	ResolutionDirectives      = regexp.MustCompile(`^resolution-*`)
+	EnrichmentDirectives      = regexp.MustCompile(`^enrichment*`)
 )
 
 func (dm *DNSMessage) handleOpenTelemetryDirectives(directive string, s *bytes.Buffer) error {
@@ -55,6 +64,34 @@ func (dm *DNSMessage) handleGeoIPDirectives(directive string, s *bytes.Buffer) e
 			s.WriteString(dm.Geo.AutonomousSystemNumber)
 		case "geoip-as-owner":
 			s.WriteString(dm.Geo.AutonomousSystemOrg)
+		case "geoip-subdivision":
+			s.WriteString(dm.Geo.Subdivision)
+		case "geoip-postal-code":
+			s.WriteString(dm.Geo.PostalCode)
+		case "geoip-latitude":
+			s.WriteString(strconv.FormatFloat(dm.Geo.Latitude, 'f', -1, 64))
+		case "geoip-longitude":
+			s.WriteString(strconv.FormatFloat(dm.Geo.Longitude, 'f', -1, 64))
+		case "geoip-timezone":
+			s.WriteString(dm.Geo.TimeZone)
+		case "geoip-isp":
+			s.WriteString(strings.ReplaceAll(dm.Geo.ISP, " ", "_"))
+		case "geoip-organization":
+			s.WriteString(strings.ReplaceAll(dm.Geo.Organization, " ", "_"))
+		case "geoip-anonymous":
+			s.WriteString(strconv.FormatBool(dm.Geo.Anonymous))
+		case "geoip-response-country":
+			if dm.Geo.ResponseIP == nil {
+				s.WriteString("-")
+			} else {
+				s.WriteString(dm.Geo.ResponseIP.CountryIsoCode)
+			}
+		case "geoip-response-as-number":
+			if dm.Geo.ResponseIP == nil {
+				s.WriteString("-")
+			} else {
+				s.WriteString(dm.Geo.ResponseIP.AutonomousSystemNumber)
+			}
 		default:
 			return errors.New(ErrorUnexpectedDirective + directive)
 		}
@@ -263,6 +300,12 @@ func (dm *DNSMessage) handleSuspiciousDirectives(directive string, s *bytes.Buff
 		switch directive {
 		case "suspicious-score":
 			s.WriteString(strconv.Itoa(int(dm.Suspicious.Score)))
+		case "suspicious-reasons":
+			if len(dm.Suspicious.Reasons) == 0 {
+				s.WriteString("-")
+			} else {
+				s.WriteString(strings.Join(dm.Suspicious.Reasons, ","))
+			}
 		default:
 			return errors.New(ErrorUnexpectedDirective + directive)
 		}
@@ -292,6 +335,24 @@ func (dm *DNSMessage) handlePublicSuffixDirectives(directive string, s *bytes.Bu
 	return nil
 }
 
+func (dm *DNSMessage) handleIDNDirectives(directive string, s *bytes.Buffer) error {
+	if dm.IDN == nil {
+		s.WriteString("-")
+	} else {
+		switch directive {
+		case "idn-mixed-script":
+			s.WriteString(strconv.FormatBool(dm.IDN.MixedScript))
+		case "idn-confusable":
+			s.WriteString(strconv.FormatBool(dm.IDN.Confusable))
+		case "idn-brand":
+			s.WriteString(dm.IDN.Brand)
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
 func (dm *DNSMessage) handleExtractedDirectives(directive string, s *bytes.Buffer) error {
 	if dm.Extracted == nil {
 		s.WriteString("-")
@@ -319,6 +380,8 @@ func (dm *DNSMessage) handleFilteringDirectives(directive string, s *bytes.Buffe
 		switch directive {
 		case "filtering-sample-rate":
 			s.WriteString(strconv.Itoa(dm.Filtering.SampleRate))
+		case "filtering-sample-fraction":
+			s.WriteString(strconv.FormatFloat(dm.Filtering.SampleFraction, 'f', -1, 64))
 		default:
 			return errors.New(ErrorUnexpectedDirective + directive)
 		}
@@ -342,6 +405,182 @@ func (dm *DNSMessage) handleReducerDirectives(directive string, s *bytes.Buffer)
 	return nil
 }
 
+func (dm *DNSMessage) handleUpstreamDirectives(directive string, s *bytes.Buffer) error {
+	if dm.Upstream == nil {
+		s.WriteString("-")
+	} else {
+		switch directive {
+		case "upstream-queries":
+			s.WriteString(strconv.Itoa(dm.Upstream.Queries))
+		case "upstream-round-trips":
+			s.WriteString(strconv.Itoa(dm.Upstream.RoundTrips))
+		case "upstream-latency":
+			fmt.Fprintf(s, "%.9f", dm.Upstream.Latency)
+		case "upstream-cache":
+			s.WriteString(dm.Upstream.Cache)
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleThreatIntelDirectives(directive string, s *bytes.Buffer) error {
+	if dm.ThreatIntel == nil || len(dm.ThreatIntel.Matches) == 0 {
+		s.WriteString("-")
+	} else {
+		// first match only
+		match := dm.ThreatIntel.Matches[0]
+		switch directive {
+		case "threatintel-list":
+			s.WriteString(match.List)
+		case "threatintel-category":
+			s.WriteString(match.Category)
+		case "threatintel-severity":
+			s.WriteString(match.Severity)
+		case "threatintel-indicator":
+			s.WriteString(match.Indicator)
+		case "threatintel-action":
+			if len(match.Action) == 0 {
+				s.WriteString("-")
+			} else {
+				s.WriteString(match.Action)
+			}
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleTunnelingDirectives(directive string, s *bytes.Buffer) error {
+	if dm.Tunneling == nil {
+		s.WriteString("-")
+	} else {
+		switch directive {
+		case "tunneling-score":
+			s.WriteString(strconv.FormatFloat(dm.Tunneling.Score, 'f', -1, 64))
+		case "tunneling-reasons":
+			if len(dm.Tunneling.Reasons) == 0 {
+				s.WriteString("-")
+			} else {
+				s.WriteString(strings.Join(dm.Tunneling.Reasons, ","))
+			}
+		case "tunneling-domain":
+			s.WriteString(dm.Tunneling.Domain)
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleAnomalyDirectives(directive string, s *bytes.Buffer) error {
+	if dm.Anomaly == nil {
+		s.WriteString("-")
+	} else {
+		switch directive {
+		case "anomaly-anomalous":
+			s.WriteString(strconv.FormatBool(dm.Anomaly.Anomalous))
+		case "anomaly-reasons":
+			if len(dm.Anomaly.Reasons) == 0 {
+				s.WriteString("-")
+			} else {
+				s.WriteString(strings.Join(dm.Anomaly.Reasons, ","))
+			}
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleRollupDirectives(directive string, s *bytes.Buffer) error {
+	if dm.Rollup == nil {
+		s.WriteString("-")
+	} else {
+		switch directive {
+		case "rollup-count":
+			s.WriteString(strconv.Itoa(dm.Rollup.Count))
+		case "rollup-length-avg":
+			s.WriteString(strconv.FormatFloat(dm.Rollup.LengthAvg, 'f', -1, 64))
+		case "rollup-latency-avg":
+			s.WriteString(strconv.FormatFloat(dm.Rollup.LatencyAvg, 'f', -1, 64))
+		case "rollup-distinct-qnames":
+			s.WriteString(strconv.FormatUint(dm.Rollup.DistinctQnames, 10))
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleResolutionDirectives(directive string, s *bytes.Buffer) error {
+	if dm.Resolution == nil {
+		s.WriteString("-")
+	} else {
+		switch directive {
+		case "resolution-final-name":
+			s.WriteString(dm.Resolution.FinalName)
+		case "resolution-cname-chain":
+			if len(dm.Resolution.CNAMEChain) == 0 {
+				s.WriteString("-")
+			} else {
+				s.WriteString(strings.Join(dm.Resolution.CNAMEChain, ","))
+			}
+		case "resolution-resolved-ips":
+			if len(dm.Resolution.ResolvedIPs) == 0 {
+				s.WriteString("-")
+			} else {
+				s.WriteString(strings.Join(dm.Resolution.ResolvedIPs, ","))
+			}
+		case "resolution-min-ttl":
+			s.WriteString(strconv.Itoa(dm.Resolution.MinTTL))
+		case "resolution-max-ttl":
+			s.WriteString(strconv.Itoa(dm.Resolution.MaxTTL))
+		case "resolution-broken":
+			s.WriteString(strconv.FormatBool(dm.Resolution.Broken))
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleNewDomainDirectives(directive string, s *bytes.Buffer) error {
+	if dm.NewDomain == nil {
+		s.WriteString("-")
+	} else {
+		switch directive {
+		case "new-domain-qname":
+			s.WriteString(strconv.FormatBool(dm.NewDomain.NewQname))
+		case "new-domain-client":
+			s.WriteString(strconv.FormatBool(dm.NewDomain.NewForClient))
+		case "new-domain-etld-plus-one":
+			s.WriteString(strconv.FormatBool(dm.NewDomain.NewETLDPlusOne))
+		case "new-domain-first-seen":
+			s.WriteString(dm.NewDomain.QnameFirstSeen)
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+// handleEnrichmentDirectives writes the value of the column provided with enrichment:<column>
+func (dm *DNSMessage) handleEnrichmentDirectives(directive string, s *bytes.Buffer) error {
+	name, column, found := strings.Cut(directive, ":")
+	if name != "enrichment" {
+		return errors.New(ErrorUnexpectedDirective + directive)
+	}
+	if value, ok := dm.Enrichment[column]; found && ok && len(value) > 0 {
+		s.WriteString(strings.ReplaceAll(value, " ", "_"))
+	} else {
+		s.WriteString("-")
+	}
+	return nil
+}
+
 func (dm *DNSMessage) handleMachineLearningDirectives(directive string, s *bytes.Buffer) error {
 	if dm.MachineLearning == nil {
 		s.WriteString("-")
@@ -385,6 +624,10 @@ func (dm *DNSMessage) handleMachineLearningDirectives(directive string, s *bytes
 			s.WriteString(strconv.Itoa(dm.MachineLearning.Occurrences))
 		case "ml-uncommon-qtypes":
 			s.WriteString(strconv.Itoa(dm.MachineLearning.UncommonQtypes))
+		case "ml-bigram-score":
+			s.WriteString(strconv.FormatFloat(dm.MachineLearning.BigramScore, 'f', -1, 64))
+		case "ml-dga-probability":
+			s.WriteString(strconv.FormatFloat(dm.MachineLearning.DGAProbability, 'f', -1, 64))
 		default:
 			return errors.New(ErrorUnexpectedDirective + directive)
 		}
@@ -416,6 +659,12 @@ func (dm *DNSMessage) ToTextLine(format []string, fieldDelimiter string, fieldBo
 			} else {
 				QuoteStringAndWrite(s, qname, fieldDelimiter, fieldBoundary)
 			}
+		case directive == "qname-unicode":
+			if dm.IDN == nil {
+				s.WriteString("-")
+			} else {
+				QuoteStringAndWrite(s, dm.IDN.QnameUnicode, fieldDelimiter, fieldBoundary)
+			}
 		case directive == "identity":
 			if len(dm.DNSTap.Identity) == 0 {
 				s.WriteString("-")
@@ -686,6 +935,11 @@ func (dm *DNSMessage) ToTextLine(format []string, fieldDelimiter string, fieldBo
 			if err != nil {
 				return err
 			}
+		case IDNDirectives.MatchString(directive):
+			err := dm.handleIDNDirectives(directive, s)
+			if err != nil {
+				return err
+			}
 		case ExtractedDirectives.MatchString(directive):
 			err := dm.handleExtractedDirectives(directive, s)
 			if err != nil {
@@ -706,6 +960,46 @@ func (dm *DNSMessage) ToTextLine(format []string, fieldDelimiter string, fieldBo
 			if err != nil {
 				return err
 			}
+		case UpstreamDirectives.MatchString(directive):
+			err := dm.handleUpstreamDirectives(directive, s)
+			if err != nil {
+				return err
+			}
+		case ThreatIntelDirectives.MatchString(directive):
+			err := dm.handleThreatIntelDirectives(directive, s)
+			if err != nil {
+				return err
+			}
+		case TunnelingDirectives.MatchString(directive):
+			err := dm.handleTunnelingDirectives(directive, s)
+			if err != nil {
+				return err
+			}
+		case AnomalyDirectives.MatchString(directive):
+			err := dm.handleAnomalyDirectives(directive, s)
+			if err != nil {
+				return err
+			}
+		case RollupDirectives.MatchString(directive):
+			err := dm.handleRollupDirectives(directive, s)
+			if err != nil {
+				return err
+			}
+		case NewDomainDirectives.MatchString(directive):
+			err := dm.handleNewDomainDirectives(directive, s)
+			if err != nil {
+				return err
+			}
+		case ResolutionDirectives.MatchString(directive):
+			err := dm.handleResolutionDirectives(directive, s)
+			if err != nil {
+				return err
+			}
+		case EnrichmentDirectives.MatchString(directive):
+			err := dm.handleEnrichmentDirectives(directive, s)
+			if err != nil {
+				return err
+			}
 		case RawTextDirective.MatchString(directive):
 			directive = strings.ReplaceAll(directive, "{", "")
 			directive = strings.ReplaceAll(directive, "}", "")
@@ -944,6 +944,12 @@ func TestDnsMessage_TextFormat_Directives_Filtering(t *testing.T) {
 			dm:       DNSMessage{Filtering: &TransformFiltering{SampleRate: 22}},
 			expected: "22",
 		},
+		{
+			name:     "fraction",
+			format:   "filtering-sample-fraction",
+			dm:       DNSMessage{Filtering: &TransformFiltering{SampleFraction: 0.4}},
+			expected: "0.4",
+		},
 	}
 
 	for _, tc := range testcases {
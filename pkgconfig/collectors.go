@@ -102,6 +102,52 @@ type ConfigCollectors struct {
 		NumThreads        int    `yaml:"num-threads" default:"1"`
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"webhook"`
+	NATS struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		Servers           string `yaml:"servers" default:"nats://127.0.0.1:4222"`
+		Subject           string `yaml:"subject" default:"dnscollector.>"`
+		QueueGroup        string `yaml:"queue-group" default:""`
+		Username          string `yaml:"username" default:""`
+		Password          string `yaml:"password" default:""`
+		Token             string `yaml:"token" default:""`
+		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
+		ReconnectWait     int    `yaml:"reconnect-wait" default:"2"`
+		TLSSupport        bool   `yaml:"tls-support" default:"false"`
+		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string `yaml:"ca-file" default:""`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		JetStream         bool   `yaml:"jetstream" default:"false"`
+		Stream            string `yaml:"stream" default:"dnscollector"`
+		Consumer          string `yaml:"consumer" default:"dnscollector"`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"nats"`
+	KafkaConsumer struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		ClientID          string `yaml:"client-id" default:""`
+		RemoteAddress     string `yaml:"remote-address" default:"127.0.0.1"`
+		RemotePort        int    `yaml:"remote-port" default:"9092"`
+		TLSSupport        bool   `yaml:"tls-support" default:"false"`
+		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string `yaml:"ca-file" default:""`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		SaslSupport       bool   `yaml:"sasl-support" default:"false"`
+		SaslUsername      string `yaml:"sasl-username" default:""`
+		SaslPassword      string `yaml:"sasl-password" default:""`
+		SaslMechanism     string `yaml:"sasl-mechanism" default:"PLAIN"`
+		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
+		Topics            string `yaml:"topics" default:"dnscollector"`
+		GroupID           string `yaml:"group-id" default:"dnscollector"`
+		StartOffset       string `yaml:"start-offset" default:"latest"`
+		CommitInterval    int    `yaml:"commit-interval" default:"1"`
+		Mode              string `yaml:"mode" default:"flat-json"`
+		ExtendedSupport   bool   `yaml:"extended-support" default:"false"`
+		DisableDNSParser  bool   `yaml:"disable-dnsparser" default:"false"`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"kafkaconsumer"`
 }
 
 func (c *ConfigCollectors) SetDefault() {
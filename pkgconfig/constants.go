@@ -33,6 +33,7 @@ const (
 	CompressSnappy = "snappy"
 	CompressLz4    = "lz4"
 	CompressZstd   = "zstd"
+	CompressZlib   = "zlib"
 	CompressNone   = "none"
 )
 
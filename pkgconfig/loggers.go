@@ -153,6 +153,9 @@ type ConfigLoggers struct {
 		ReplaceNullChar   string `yaml:"replace-null-char" default:"�"`
 		FlushInterval     int    `yaml:"flush-interval" default:"30"`
 		BufferSize        int    `yaml:"buffer-size" default:"100"`
+		Vendor            string `yaml:"vendor" default:"dmachard"`
+		Product           string `yaml:"product" default:"DNScollector"`
+		ProductVersion    string `yaml:"product-version" default:""`
 	} `yaml:"syslog"`
 	Fluentd struct {
 		Enable            bool   `yaml:"enable" default:"false"`
@@ -353,6 +356,78 @@ type ConfigLoggers struct {
 		KeyFile           string `yaml:"key-file" default:""`
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"mqtt"`
+	GELF struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		RemoteAddress     string `yaml:"remote-address" default:"127.0.0.1"`
+		RemotePort        int    `yaml:"remote-port" default:"12201"`
+		Transport         string `yaml:"transport" default:"udp"`
+		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
+		RetryInterval     int    `yaml:"retry-interval" default:"10"`
+		FlushInterval     int    `yaml:"flush-interval" default:"30"`
+		BufferSize        int    `yaml:"buffer-size" default:"100"`
+		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string `yaml:"ca-file" default:""`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		Compression       string `yaml:"compression" default:"gzip"`
+		ChunkSize         int    `yaml:"chunk-size" default:"1420"`
+		Hostname          string `yaml:"hostname" default:""`
+		TextFormat        string `yaml:"text-format" default:""`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"gelf"`
+	AMQP struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		RemoteAddress     string `yaml:"remote-address" default:"127.0.0.1"`
+		RemotePort        int    `yaml:"remote-port" default:"5672"`
+		Username          string `yaml:"username" default:"guest"`
+		Password          string `yaml:"password" default:"guest"`
+		VHost             string `yaml:"vhost" default:"/"`
+		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
+		RetryInterval     int    `yaml:"retry-interval" default:"1"`
+		RetryMaxInterval  int    `yaml:"retry-max-interval" default:"60"`
+		TLSSupport        bool   `yaml:"tls-support" default:"false"`
+		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string `yaml:"ca-file" default:""`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		Exchange          string `yaml:"exchange" default:"dnscollector"`
+		ExchangeType      string `yaml:"exchange-type" default:"topic"`
+		ExchangeDeclare   bool   `yaml:"exchange-declare" default:"true"`
+		RoutingKey        string `yaml:"routing-key" default:"dns.{dnstap.identity}.{dns.rcode}"`
+		PublisherConfirms bool   `yaml:"publisher-confirms" default:"true"`
+		ConfirmTimeout    int    `yaml:"confirm-timeout" default:"5"`
+		Persistent        bool   `yaml:"persistent" default:"true"`
+		Mode              string `yaml:"mode" default:"flat-json"`
+		TextFormat        string `yaml:"text-format" default:""`
+		BufferSize        int    `yaml:"buffer-size" default:"100"`
+		FlushInterval     int    `yaml:"flush-interval" default:"10"`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"amqp"`
+	NATS struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		Servers           string `yaml:"servers" default:"nats://127.0.0.1:4222"`
+		Subject           string `yaml:"subject" default:"dnscollector.{dnstap.identity}"`
+		Username          string `yaml:"username" default:""`
+		Password          string `yaml:"password" default:""`
+		Token             string `yaml:"token" default:""`
+		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
+		ReconnectWait     int    `yaml:"reconnect-wait" default:"2"`
+		TLSSupport        bool   `yaml:"tls-support" default:"false"`
+		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string `yaml:"ca-file" default:""`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		JetStream         bool   `yaml:"jetstream" default:"false"`
+		AckTimeout        int    `yaml:"ack-timeout" default:"5"`
+		Mode              string `yaml:"mode" default:"json"`
+		TextFormat        string `yaml:"text-format" default:""`
+		BufferSize        int    `yaml:"buffer-size" default:"100"`
+		FlushInterval     int    `yaml:"flush-interval" default:"10"`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"nats"`
 }
 
 func (c *ConfigLoggers) SetDefault() {
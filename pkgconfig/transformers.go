@@ -11,32 +11,84 @@ type RelabelingConfig struct {
 	Replacement string `yaml:"replacement"`
 }
 
+type ThreatIntelSource struct {
+	Name     string `yaml:"name"`
+	Category string `yaml:"category"`
+	Severity string `yaml:"severity"`
+	Format   string `yaml:"format"`
+	File     string `yaml:"file"`
+	URL      string `yaml:"url"`
+}
+
+type LookupTable struct {
+	Name    string   `yaml:"name"`
+	File    string   `yaml:"file"`
+	Format  string   `yaml:"format"`
+	Type    string   `yaml:"type"`
+	Key     string   `yaml:"key"`
+	Field   string   `yaml:"field"`
+	Columns []string `yaml:"columns,flow"`
+}
+
+type RewriteRule struct {
+	Match       map[string]interface{} `yaml:"match"`
+	Identifiers map[string]interface{} `yaml:"identifiers,flow"`
+}
+
+type ATagsRule struct {
+	Match struct {
+		Include map[string]interface{} `yaml:"include"`
+		Exclude map[string]interface{} `yaml:"exclude"`
+	} `yaml:"match"`
+	Tags []string `yaml:"tags,flow"`
+}
+
 type ConfigTransformers struct {
 	UserPrivacy struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		AnonymizeIP       bool   `yaml:"anonymize-ip" default:"false"`
-		AnonymizeIPV4Bits string `yaml:"anonymize-v4bits" default:"0.0.0.0/16"`
-		AnonymizeIPV6Bits string `yaml:"anonymize-v6bits" default:"::/64"`
-		MinimizeQname     bool   `yaml:"minimize-qname" default:"false"`
-		HashQueryIP       bool   `yaml:"hash-query-ip" default:"false"`
-		HashReplyIP       bool   `yaml:"hash-reply-ip" default:"false"`
-		HashIPAlgo        string `yaml:"hash-ip-algo" default:"sha1"`
+		Enable              bool   `yaml:"enable" default:"false"`
+		AnonymizeIP         bool   `yaml:"anonymize-ip" default:"false"`
+		AnonymizeIPV4Bits   string `yaml:"anonymize-v4bits" default:"0.0.0.0/16"`
+		AnonymizeIPV6Bits   string `yaml:"anonymize-v6bits" default:"::/64"`
+		MinimizeQname       bool   `yaml:"minimize-qname" default:"false"`
+		HashQueryIP         bool   `yaml:"hash-query-ip" default:"false"`
+		HashReplyIP         bool   `yaml:"hash-reply-ip" default:"false"`
+		HashIPAlgo          string `yaml:"hash-ip-algo" default:"sha1"`
+		AnonymizeECS        bool   `yaml:"anonymize-ecs" default:"false"`
+		HashECS             bool   `yaml:"hash-ecs" default:"false"`
+		RemoveCookie        bool   `yaml:"remove-cookie" default:"false"`
+		RemovePadding       bool   `yaml:"remove-padding" default:"false"`
+		AnonymizePTRQname   bool   `yaml:"anonymize-ptr-qname" default:"false"`
+		PseudonymizeQueryIP bool   `yaml:"pseudonymize-query-ip" default:"false"`
+		PseudonymizeReplyIP bool   `yaml:"pseudonymize-reply-ip" default:"false"`
+		PseudonymizeECS     bool   `yaml:"pseudonymize-ecs" default:"false"`
+		PseudonymizeAnswers bool   `yaml:"pseudonymize-answers" default:"false"`
+		PseudonymizeMode    string `yaml:"pseudonymize-mode" default:"cryptopan"`
+		KeyFile             string `yaml:"key-file" default:""`
 	} `yaml:"user-privacy"`
 	Normalize struct {
-		Enable              bool `yaml:"enable" default:"false"`
-		QnameLowerCase      bool `yaml:"qname-lowercase" default:"false"`
-		RRLowerCase         bool `yaml:"rr-lowercase" default:"false"`
-		QuietText           bool `yaml:"quiet-text" default:"false"`
-		AddTld              bool `yaml:"add-tld" default:"false"`
-		AddTldPlusOne       bool `yaml:"add-tld-plus-one" default:"false"`
-		ReplaceNonPrintable bool `yaml:"qname-replace-nonprintable" default:"false"`
+		Enable              bool     `yaml:"enable" default:"false"`
+		QnameLowerCase      bool     `yaml:"qname-lowercase" default:"false"`
+		RRLowerCase         bool     `yaml:"rr-lowercase" default:"false"`
+		QuietText           bool     `yaml:"quiet-text" default:"false"`
+		AddTld              bool     `yaml:"add-tld" default:"false"`
+		AddTldPlusOne       bool     `yaml:"add-tld-plus-one" default:"false"`
+		ReplaceNonPrintable bool     `yaml:"qname-replace-nonprintable" default:"false"`
+		QnameUnicode        bool     `yaml:"qname-unicode" default:"false"`
+		CheckHomoglyphs     bool     `yaml:"check-homoglyphs" default:"false"`
+		ProtectedBrands     []string `yaml:"protected-brands,flow" default:"[]"`
 	} `yaml:"normalize"`
 	Latency struct {
 		Enable            bool `yaml:"enable" default:"false"`
 		MeasureLatency    bool `yaml:"measure-latency" default:"false"`
 		UnansweredQueries bool `yaml:"unanswered-queries" default:"false"`
 		QueriesTimeout    int  `yaml:"queries-timeout" default:"2"`
+		UpstreamQueries   bool `yaml:"upstream-queries" default:"false"`
 	} `yaml:"latency"`
+	Correlate struct {
+		Enable            bool `yaml:"enable" default:"false"`
+		QueriesTimeout    int  `yaml:"queries-timeout" default:"2"`
+		UnansweredQueries bool `yaml:"unanswered-queries" default:"true"`
+	} `yaml:"correlate"`
 	Reducer struct {
 		Enable                    bool     `yaml:"enable" default:"false"`
 		RepetitiveTrafficDetector bool     `yaml:"repetitive-traffic-detector" default:"false"`
@@ -44,6 +96,16 @@ type ConfigTransformers struct {
 		WatchInterval             int      `yaml:"watch-interval" default:"2"`
 		UniqueFields              []string `yaml:"unique-fields" default:"[\"dnstap.identity\", \"dnstap.operation\", \"network.query-ip\", \"network.response-ip\",  \"dns.qname\", \"dns.qtype\"]"`
 	} `yaml:"reducer"`
+	Rollup struct {
+		Enable         bool     `yaml:"enable" default:"false"`
+		Window         int      `yaml:"window" default:"60"`
+		GroupBy        []string `yaml:"group-by" default:"[\"dnstap.identity\", \"network.query-ip\", \"dns.qtype\", \"dns.rcode\"]"`
+		ClientPrefixV4 int      `yaml:"client-prefix-v4" default:"32"`
+		ClientPrefixV6 int      `yaml:"client-prefix-v6" default:"128"`
+		HLLPrecision   int      `yaml:"hll-precision" default:"10"`
+		MaxGroups      int      `yaml:"max-groups" default:"100000"`
+		KeepRaw        bool     `yaml:"keep-raw" default:"true"`
+	} `yaml:"rollup"`
 	Filtering struct {
 		Enable          bool     `yaml:"enable" default:"false"`
 		DropFqdnFile    string   `yaml:"drop-fqdn-file" default:""`
@@ -53,39 +115,85 @@ type ConfigTransformers struct {
 		DropQueryIPFile string   `yaml:"drop-queryip-file" default:""`
 		KeepQueryIPFile string   `yaml:"keep-queryip-file" default:""`
 		KeepRdataFile   string   `yaml:"keep-rdata-file" default:""`
+		WatchFiles      bool     `yaml:"watch-files" default:"true"`
 		DropRcodes      []string `yaml:"drop-rcodes,flow" default:"[]"`
 		LogQueries      bool     `yaml:"log-queries" default:"true"`
 		LogReplies      bool     `yaml:"log-replies" default:"true"`
 		Downsample      int      `yaml:"downsample" default:"0"`
+		SampleFraction  float64  `yaml:"sample-fraction" default:"0"`
+		SampleFields    []string `yaml:"sample-fields,flow" default:"[\"query-ip\", \"query-port\", \"response-ip\", \"response-port\", \"id\"]"`
 	} `yaml:"filtering"`
 	GeoIP struct {
-		Enable        bool   `yaml:"enable" default:"false"`
-		LookupECS     bool   `yaml:"lookup-ecs" default:"false"`
-		DBCountryFile string `yaml:"mmdb-country-file" default:""`
-		DBCityFile    string `yaml:"mmdb-city-file" default:""`
-		DBASNFile     string `yaml:"mmdb-asn-file" default:""`
+		Enable            bool   `yaml:"enable" default:"false"`
+		LookupECS         bool   `yaml:"lookup-ecs" default:"false"`
+		DBCountryFile     string `yaml:"mmdb-country-file" default:""`
+		DBCityFile        string `yaml:"mmdb-city-file" default:""`
+		DBASNFile         string `yaml:"mmdb-asn-file" default:""`
+		DBAnonymousIPFile string `yaml:"mmdb-anonymous-ip-file" default:""`
+		DBISPFile         string `yaml:"mmdb-isp-file" default:""`
+		LookupResponseIP  bool   `yaml:"lookup-response-ip" default:"false"`
+		LookupAnswers     bool   `yaml:"lookup-answers" default:"false"`
+		WatchFiles        bool   `yaml:"watch-files" default:"true"`
 	} `yaml:"geoip"`
 	Suspicious struct {
-		Enable             bool     `yaml:"enable" default:"false"`
-		ThresholdQnameLen  int      `yaml:"threshold-qname-len" default:"100"`
-		ThresholdPacketLen int      `yaml:"threshold-packet-len" default:"1000"`
-		ThresholdSlow      float64  `yaml:"threshold-slow" default:"1.0"`
-		CommonQtypes       []string `yaml:"common-qtypes,flow" default:"[\"A\", \"AAAA\", \"TXT\", \"CNAME\", \"PTR\", \"NAPTR\", \"DNSKEY\", \"SRV\", \"SOA\", \"NS\", \"MX\", \"DS\", \"HTTPS\"]"`
-		UnallowedChars     []string `yaml:"unallowed-chars,flow" default:"[\"\\\"\", \"==\", \"/\", \":\"]"`
-		ThresholdMaxLabels int      `yaml:"threshold-max-labels" default:"10"`
-		WhitelistDomains   []string `yaml:"whitelist-domains,flow" default:"[\"\\\\.ip6\\\\.arpa\"]"`
+		Enable               bool               `yaml:"enable" default:"false"`
+		ThresholdQnameLen    int                `yaml:"threshold-qname-len" default:"100"`
+		ThresholdPacketLen   int                `yaml:"threshold-packet-len" default:"1000"`
+		ThresholdSlow        float64            `yaml:"threshold-slow" default:"1.0"`
+		CommonQtypes         []string           `yaml:"common-qtypes,flow" default:"[\"A\", \"AAAA\", \"TXT\", \"CNAME\", \"PTR\", \"NAPTR\", \"DNSKEY\", \"SRV\", \"SOA\", \"NS\", \"MX\", \"DS\", \"HTTPS\"]"`
+		UnallowedChars       []string           `yaml:"unallowed-chars,flow" default:"[\"\\\"\", \"==\", \"/\", \":\"]"`
+		ThresholdMaxLabels   int                `yaml:"threshold-max-labels" default:"10"`
+		WhitelistDomains     []string           `yaml:"whitelist-domains,flow" default:"[\"\\\\.ip6\\\\.arpa\"]"`
+		Checks               []string           `yaml:"checks,flow" default:"[\"malformed-pkt\", \"large-pkt\", \"long-domain\", \"slow-domain\", \"unallowed-chars\", \"uncommon-qtypes\", \"excessive-number-labels\"]"`
+		Weights              map[string]float64 `yaml:"weights,flow"`
+		ThresholdEntropy     float64            `yaml:"threshold-entropy" default:"4.0"`
+		ThresholdDigitsRatio float64            `yaml:"threshold-digits-ratio" default:"0.5"`
+		ThresholdMinTTL      int                `yaml:"threshold-min-ttl" default:"1"`
+		ThresholdMaxTTL      int                `yaml:"threshold-max-ttl" default:"604800"`
+		ThresholdScore       float64            `yaml:"threshold-score" default:"1.0"`
+		Action               string             `yaml:"action" default:"keep"`
 	} `yaml:"suspicious"`
+	Tunneling struct {
+		Enable                    bool     `yaml:"enable" default:"false"`
+		Window                    int      `yaml:"window" default:"60"`
+		CacheSize                 int      `yaml:"cache-size" default:"10000"`
+		MinQueries                int      `yaml:"min-queries" default:"10"`
+		ThresholdUniqueSubdomains int      `yaml:"threshold-unique-subdomains" default:"50"`
+		ThresholdEntropy          float64  `yaml:"threshold-entropy" default:"3.5"`
+		ThresholdAnswerSize       int      `yaml:"threshold-answer-size" default:"200"`
+		ThresholdBytes            int      `yaml:"threshold-bytes" default:"20000"`
+		WhitelistDomains          []string `yaml:"whitelist-domains,flow" default:"[]"`
+	} `yaml:"tunneling"`
+	Anomaly struct {
+		Enable          bool    `yaml:"enable" default:"false"`
+		Interval        int     `yaml:"interval" default:"10"`
+		Alpha           float64 `yaml:"alpha" default:"0.1"`
+		WarmupIntervals int     `yaml:"warmup-intervals" default:"6"`
+		Threshold       float64 `yaml:"threshold" default:"3.0"`
+		MinQueries      int     `yaml:"min-queries" default:"10"`
+		CacheSize       int     `yaml:"cache-size" default:"10000"`
+		Alerts          bool    `yaml:"alerts" default:"true"`
+	} `yaml:"anomaly"`
+	Resolution struct {
+		Enable         bool `yaml:"enable" default:"false"`
+		MaxChainLength int  `yaml:"max-chain-length" default:"16"`
+	} `yaml:"resolution"`
 	Extract struct {
 		Enable     bool `yaml:"enable" default:"false"`
 		AddPayload bool `yaml:"add-payload" default:"false"`
 	} `yaml:"extract"`
 	MachineLearning struct {
-		Enable      bool `yaml:"enable" default:"false"`
-		AddFeatures bool `yaml:"add-features" default:"false"`
+		Enable       bool    `yaml:"enable" default:"false"`
+		AddFeatures  bool    `yaml:"add-features" default:"false"`
+		DGA          bool    `yaml:"dga" default:"false"`
+		DGAModelFile string  `yaml:"dga-model-file" default:""`
+		DGAThreshold float64 `yaml:"dga-threshold" default:"0.5"`
+		DGAAction    string  `yaml:"dga-action" default:"none"`
 	} `yaml:"machine-learning"`
 	ATags struct {
-		Enable  bool     `yaml:"enable" default:"false"`
-		AddTags []string `yaml:"add-tags,flow" default:"[]"`
+		Enable  bool        `yaml:"enable" default:"false"`
+		AddTags []string    `yaml:"add-tags,flow" default:"[]"`
+		Rules   []ATagsRule `yaml:"rules,flow"`
 	} `yaml:"atags"`
 	Rest struct {
 		Enable           bool   `yaml:"enable" default:"false"`
@@ -103,14 +211,40 @@ type ConfigTransformers struct {
 	Rewrite struct {
 		Enable      bool                   `yaml:"enable" default:"false"`
 		Identifiers map[string]interface{} `yaml:"identifiers,flow"`
+		Rules       []RewriteRule          `yaml:"rules,flow"`
 	} `yaml:"rewrite"`
 	NewDomainTracker struct {
-		Enable           bool   `yaml:"enable" default:"false"`
-		TTL              int    `yaml:"ttl" default:"3600"`
-		CacheSize        int    `yaml:"cache-size" default:"100000"`
-		WhiteDomainsFile string `yaml:"white-domains-file" default:""`
-		PersistenceFile  string `yaml:"persistence-file" default:""`
+		Enable             bool    `yaml:"enable" default:"false"`
+		TTL                int     `yaml:"ttl" default:"3600"`
+		CacheSize          int     `yaml:"cache-size" default:"100000"`
+		WhiteDomainsFile   string  `yaml:"white-domains-file" default:""`
+		PersistenceFile    string  `yaml:"persistence-file" default:""`
+		Store              string  `yaml:"store" default:"lru"`
+		TrackClients       bool    `yaml:"track-clients" default:"false"`
+		TrackETLDPlusOne   bool    `yaml:"track-etld-plus-one" default:"false"`
+		BloomCapacity      int     `yaml:"bloom-capacity" default:"1000000"`
+		BloomErrorRate     float64 `yaml:"bloom-error-rate" default:"0.001"`
+		CheckpointInterval int     `yaml:"checkpoint-interval" default:"0"`
 	} `yaml:"new-domain-tracker"`
+	ThreatIntel struct {
+		Enable         bool                `yaml:"enable" default:"false"`
+		ReloadInterval int                 `yaml:"reload-interval" default:"0"`
+		HTTPTimeout    int                 `yaml:"http-timeout" default:"10"`
+		Sources        []ThreatIntelSource `yaml:"sources,flow"`
+	} `yaml:"threat-intel"`
+	Script struct {
+		Enable     bool   `yaml:"enable" default:"false"`
+		Source     string `yaml:"source" default:""`
+		File       string `yaml:"file" default:""`
+		TimeBudget int    `yaml:"time-budget" default:"10"`
+		MaxSteps   uint64 `yaml:"max-steps" default:"100000"`
+		OnError    string `yaml:"on-error" default:"keep"`
+	} `yaml:"script"`
+	Lookup struct {
+		Enable     bool          `yaml:"enable" default:"false"`
+		WatchFiles bool          `yaml:"watch-files" default:"true"`
+		Tables     []LookupTable `yaml:"tables,flow"`
+	} `yaml:"lookup"`
 	Reordering struct {
 		Enable        bool `yaml:"enable" default:"false"`
 		FlushInterval int  `yaml:"flush-interval" default:"30"`
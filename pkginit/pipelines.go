@@ -202,6 +202,15 @@ func CreateStanza(stanzaName string, config *pkgconfig.Config, mapCollectors map
 		{config.Loggers.MQTT.Enable, func() workers.Worker {
 			return workers.NewMQTT(config, logger, stanzaName)
 		}},
+		{config.Loggers.GELF.Enable, func() workers.Worker {
+			return workers.NewGELFClient(config, logger, stanzaName)
+		}},
+		{config.Loggers.AMQP.Enable, func() workers.Worker {
+			return workers.NewAMQPPublisher(config, logger, stanzaName)
+		}},
+		{config.Loggers.NATS.Enable, func() workers.Worker {
+			return workers.NewNATSPublisher(config, logger, stanzaName)
+		}},
 	}
 
 	for _, l := range loggers {
@@ -242,6 +251,12 @@ func CreateStanza(stanzaName string, config *pkgconfig.Config, mapCollectors map
 		{config.Collectors.Webhook.Enable, func() workers.Worker {
 			return workers.NewWebhook(nil, config, logger, stanzaName)
 		}},
+		{config.Collectors.NATS.Enable, func() workers.Worker {
+			return workers.NewNATSSubscriber(nil, config, logger, stanzaName)
+		}},
+		{config.Collectors.KafkaConsumer.Enable, func() workers.Worker {
+			return workers.NewKafkaConsumer(nil, config, logger, stanzaName)
+		}},
 	}
 
 	for _, c := range collectors {
@@ -28,6 +28,25 @@ func SanitizeMetricName(metricName string) string {
 	return metricNameRegex.ReplaceAllString(metricName, "_")
 }
 
+// PrefixedCollector is a collector of another package, the names of its metrics
+// start with the prefix of the telemetry
+type PrefixedCollector interface {
+	prometheus.Collector
+	SetPrefix(prefix string)
+}
+
+var (
+	extraCollectors     []PrefixedCollector
+	extraCollectorsLock sync.Mutex
+)
+
+// RegisterCollector adds a collector served by the telemetry server
+func RegisterCollector(collector PrefixedCollector) {
+	extraCollectorsLock.Lock()
+	defer extraCollectorsLock.Unlock()
+	extraCollectors = append(extraCollectors, collector)
+}
+
 type WorkerStats struct {
 	Name                 string
 	TotalIngress         int
@@ -168,6 +187,13 @@ func InitTelemetryServer(config *pkgconfig.Config, logger *logger.Logger) (*http
 	// Prometheus collectors
 	metrics := NewPrometheusCollector(config)
 
+	extraCollectorsLock.Lock()
+	collectors := append([]PrefixedCollector{}, extraCollectors...)
+	extraCollectorsLock.Unlock()
+	for _, collector := range collectors {
+		collector.SetPrefix(metrics.promPrefix)
+	}
+
 	// HTTP server
 	promServer := &http.Server{
 		Addr:              config.Global.Telemetry.WebListen,
@@ -182,6 +208,9 @@ func InitTelemetryServer(config *pkgconfig.Config, logger *logger.Logger) (*http
 			// register metrics
 			prometheus.MustRegister(metrics)
 			prometheus.MustRegister(version.NewCollector(config.Global.Telemetry.PromPrefix))
+			for _, collector := range collectors {
+				prometheus.MustRegister(collector)
+			}
 
 			// handle /metrics
 			http.Handle(config.Global.Telemetry.WebPath, promhttp.Handler())
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -48,3 +50,22 @@ func TestTelemetry_PrometheusCollectorUpdateStats(t *testing.T) {
 	assert.Equal(t, ws.TotalDroppedPolicy, storedWS.TotalDroppedPolicy)
 	assert.Equal(t, ws.TotalDiscarded, storedWS.TotalDiscarded)
 }
+
+type fakePrefixedCollector struct {
+	prefix string
+}
+
+func (c *fakePrefixedCollector) Describe(ch chan<- *prometheus.Desc) {}
+func (c *fakePrefixedCollector) Collect(ch chan<- prometheus.Metric) {}
+func (c *fakePrefixedCollector) SetPrefix(prefix string)             { c.prefix = prefix }
+
+func TestTelemetry_RegisterCollector(t *testing.T) {
+	config := pkgconfig.Config{}
+	config.Global.Telemetry.PromPrefix = "my-prefix"
+
+	collector := &fakePrefixedCollector{}
+	RegisterCollector(collector)
+
+	InitTelemetryServer(&config, logger.New(false))
+	assert.Equal(t, "my_prefix", collector.prefix)
+}
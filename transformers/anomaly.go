@@ -0,0 +1,216 @@
+package transformers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// exponentially weighted moving average and variance of a metric
+type EWMA struct {
+	Mean     float64
+	Variance float64
+}
+
+func (e *EWMA) Update(value, alpha float64) {
+	diff := value - e.Mean
+	incr := alpha * diff
+	e.Mean += incr
+	e.Variance = (1 - alpha) * (e.Variance + diff*incr)
+}
+
+// Deviation returns the number of standard deviations above the mean,
+// the standard deviation is floored to avoid alerts on flat baselines
+func (e *EWMA) Deviation(value, minStdDev float64) float64 {
+	stddev := math.Max(math.Sqrt(e.Variance), math.Max(0.1*e.Mean, minStdDev))
+	return (value - e.Mean) / stddev
+}
+
+// precision of the sketch of the distinct qnames, 1KB per client and 3% of error,
+// the small counts are exact in practice with the linear counting
+const anomalyHLLPrecision = 10
+
+// counters of the current interval and baselines of a client
+type ClientBaseline struct {
+	epoch        int64
+	queries      int
+	replies      int
+	nxdomains    int
+	qnames       *HyperLogLog
+	uniqueQnames int
+	intervals    int
+	incident     bool
+	Queries      EWMA
+	NXDomain     EWMA
+	UniqueQnames EWMA
+}
+
+type AnomalyTransform struct {
+	GenericTransformer
+	clients *lru.Cache[string, *ClientBaseline]
+}
+
+func NewAnomalyTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *AnomalyTransform {
+	t := &AnomalyTransform{GenericTransformer: NewTransformer(config, logger, "anomaly", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *AnomalyTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if !t.config.Anomaly.Enable {
+		return subtransforms, nil
+	}
+
+	if t.config.Anomaly.Interval <= 0 {
+		return nil, fmt.Errorf("invalid interval %d", t.config.Anomaly.Interval)
+	}
+	if t.config.Anomaly.Alpha <= 0 || t.config.Anomaly.Alpha > 1 {
+		return nil, fmt.Errorf("invalid alpha %v, must be in (0,1]", t.config.Anomaly.Alpha)
+	}
+	if t.config.Anomaly.CacheSize <= 0 {
+		return nil, fmt.Errorf("invalid cache size %d", t.config.Anomaly.CacheSize)
+	}
+
+	clients, err := lru.New[string, *ClientBaseline](t.config.Anomaly.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	t.clients = clients
+
+	subtransforms = append(subtransforms, Subtransform{name: "anomaly:detect", processFunc: t.detectAnomaly})
+	return subtransforms, nil
+}
+
+func (t *AnomalyTransform) nxdomainRatio(client *ClientBaseline) float64 {
+	if client.replies == 0 {
+		return 0
+	}
+	return float64(client.nxdomains) / float64(client.replies)
+}
+
+// closeInterval updates the baselines with the counters of the previous interval,
+// the incident is closed when the interval is normal
+func (t *AnomalyTransform) closeInterval(client *ClientBaseline, epoch int64) {
+	if client.queries > 0 || client.replies > 0 {
+		anomalous := len(t.evaluate(client, nil)) > 0
+		if !anomalous || client.intervals < t.config.Anomaly.WarmupIntervals {
+			alpha := t.config.Anomaly.Alpha
+			client.Queries.Update(float64(client.queries), alpha)
+			client.NXDomain.Update(t.nxdomainRatio(client), alpha)
+			client.UniqueQnames.Update(float64(client.uniqueQnames), alpha)
+			client.intervals++
+		}
+		client.incident = client.incident && anomalous
+	}
+
+	client.epoch = epoch
+	client.queries = 0
+	client.replies = 0
+	client.nxdomains = 0
+	client.qnames.Reset()
+	client.uniqueQnames = 0
+}
+
+// evaluate returns the reasons of the anomaly for the counters of the current interval
+func (t *AnomalyTransform) evaluate(client *ClientBaseline, anomaly *dnsutils.TransformAnomaly) []string {
+	reasons := []string{}
+	if client.intervals < t.config.Anomaly.WarmupIntervals {
+		return reasons
+	}
+
+	threshold := t.config.Anomaly.Threshold
+	queriesDeviation := client.Queries.Deviation(float64(client.queries), 1.0)
+	uniqueDeviation := client.UniqueQnames.Deviation(float64(client.uniqueQnames), 1.0)
+	nxdomainDeviation := 0.0
+	if client.replies >= t.config.Anomaly.MinQueries {
+		nxdomainDeviation = client.NXDomain.Deviation(t.nxdomainRatio(client), 0.05)
+	}
+
+	if client.queries >= t.config.Anomaly.MinQueries && queriesDeviation > threshold {
+		reasons = append(reasons, dnsutils.AnomalyReasonQueries)
+	}
+	if nxdomainDeviation > threshold {
+		reasons = append(reasons, dnsutils.AnomalyReasonNXDomain)
+	}
+	if client.uniqueQnames >= t.config.Anomaly.MinQueries && uniqueDeviation > threshold {
+		reasons = append(reasons, dnsutils.AnomalyReasonUniqueQnames)
+	}
+
+	if anomaly != nil {
+		anomaly.QueriesDeviation = queriesDeviation
+		anomaly.NXDomainDeviation = nxdomainDeviation
+		anomaly.UniqueQnamesDeviation = uniqueDeviation
+	}
+	return reasons
+}
+
+// sendAlert forwards a copy of the message which started the incident,
+// the message continues in the pipeline and can be updated by the next transforms
+func (t *AnomalyTransform) sendAlert(dm *dnsutils.DNSMessage) {
+	alert := dm.Copy()
+	alert.DNSTap.Operation = dnsutils.DNSTapOperationAnomaly
+
+	for i := range t.nextWorkers {
+		t.nextWorkers[i] <- alert
+	}
+}
+
+func (t *AnomalyTransform) detectAnomaly(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.Anomaly == nil {
+		dm.Anomaly = &dnsutils.TransformAnomaly{Reasons: []string{}}
+	}
+	if len(dm.NetworkInfo.QueryIP) == 0 {
+		return ReturnKeep, nil
+	}
+
+	timestamp := dm.DNSTap.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano()
+	}
+	epoch := timestamp / int64(time.Duration(t.config.Anomaly.Interval)*time.Second)
+
+	client, ok := t.clients.Get(dm.NetworkInfo.QueryIP)
+	if !ok {
+		client = &ClientBaseline{epoch: epoch, qnames: NewHyperLogLog(anomalyHLLPrecision)}
+		t.clients.Add(dm.NetworkInfo.QueryIP, client)
+	}
+	if epoch > client.epoch {
+		t.closeInterval(client, epoch)
+	}
+
+	// update the counters of the current interval
+	if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
+		client.queries++
+		// the estimate is only computed again when the sketch changes
+		if client.qnames.Add(dm.DNS.Qname) {
+			client.uniqueQnames = int(client.qnames.Count())
+		}
+	} else {
+		client.replies++
+		if dm.DNS.Rcode == dnsutils.DNSRcodeNXDomain {
+			client.nxdomains++
+		}
+	}
+
+	reasons := t.evaluate(client, dm.Anomaly)
+	if len(reasons) == 0 && !client.incident {
+		return ReturnKeep, nil
+	}
+
+	dm.Anomaly.Anomalous = true
+	dm.Anomaly.Reasons = append(dm.Anomaly.Reasons, reasons...)
+
+	// one alert per incident
+	if !client.incident {
+		client.incident = true
+		if t.config.Anomaly.Alerts {
+			t.sendAlert(dm)
+		}
+	}
+	return ReturnKeep, nil
+}
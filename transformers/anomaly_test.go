@@ -0,0 +1,229 @@
+package transformers
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+const anomalyTestStart = int64(1704486840000000000)
+
+// sendTraffic generates the queries and replies of a client during one interval of 10s
+func sendTraffic(anomaly *AnomalyTransform, clientIP string, interval, queries, nxdomains int) []dnsutils.DNSMessage {
+	messages := []dnsutils.DNSMessage{}
+	for i := 0; i < queries; i++ {
+		ts := anomalyTestStart + int64(interval)*10000000000 + int64(i)*1000000
+
+		query := dnsutils.GetFakeDNSMessage()
+		query.NetworkInfo.QueryIP = clientIP
+		query.DNS.Qname = "www" + strconv.Itoa(i%5) + ".example.com"
+		query.DNSTap.Timestamp = ts
+		anomaly.detectAnomaly(&query)
+
+		reply := dnsutils.GetFakeDNSMessage()
+		reply.NetworkInfo.QueryIP = clientIP
+		reply.DNS.Type = dnsutils.DNSReply
+		reply.DNS.Qname = query.DNS.Qname
+		// NXDOMAIN replies are spread over the interval
+		if (i*nxdomains)%queries < nxdomains {
+			reply.DNS.Rcode = dnsutils.DNSRcodeNXDomain
+		}
+		reply.DNSTap.Timestamp = ts + 1000
+		anomaly.detectAnomaly(&reply)
+
+		messages = append(messages, query, reply)
+	}
+	return messages
+}
+
+func newAnomalyForTest(t *testing.T) (*AnomalyTransform, chan dnsutils.DNSMessage) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Anomaly.Enable = true
+
+	alerts := make(chan dnsutils.DNSMessage, 10)
+	anomaly := NewAnomalyTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{alerts})
+	if _, err := anomaly.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	return anomaly, alerts
+}
+
+func anomalousCount(messages []dnsutils.DNSMessage) int {
+	n := 0
+	for _, dm := range messages {
+		if dm.Anomaly.Anomalous {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAnomaly_QueriesSpike(t *testing.T) {
+	anomaly, alerts := newAnomalyForTest(t)
+
+	// baseline of 20 queries per interval
+	for interval := 0; interval < 10; interval++ {
+		if n := anomalousCount(sendTraffic(anomaly, "10.0.0.1", interval, 20, 1)); n != 0 {
+			t.Fatalf("interval %d: unexpected anomalies %d", interval, n)
+		}
+	}
+
+	// spike
+	messages := sendTraffic(anomaly, "10.0.0.1", 10, 200, 10)
+	if anomalousCount(messages) == 0 {
+		t.Fatal("spike not detected")
+	}
+	last := messages[len(messages)-1]
+	if last.Anomaly.QueriesDeviation <= 3 {
+		t.Errorf("invalid deviation %f", last.Anomaly.QueriesDeviation)
+	}
+
+	// one alert for the incident
+	if len(alerts) != 1 {
+		t.Fatalf("want 1 alert, got %d", len(alerts))
+	}
+	alert := <-alerts
+	if alert.DNSTap.Operation != dnsutils.DNSTapOperationAnomaly || alert.NetworkInfo.QueryIP != "10.0.0.1" {
+		t.Errorf("invalid alert: %s %s", alert.DNSTap.Operation, alert.NetworkInfo.QueryIP)
+	}
+	if len(alert.Anomaly.Reasons) == 0 || alert.Anomaly.Reasons[0] != dnsutils.AnomalyReasonQueries {
+		t.Errorf("invalid alert reasons: %v", alert.Anomaly.Reasons)
+	}
+
+	// the incident is closed after a normal interval
+	sendTraffic(anomaly, "10.0.0.1", 11, 20, 1)
+	if n := anomalousCount(sendTraffic(anomaly, "10.0.0.1", 12, 20, 1)); n != 0 {
+		t.Errorf("incident not closed, %d anomalies", n)
+	}
+}
+
+func TestAnomaly_NXDomainRatio(t *testing.T) {
+	anomaly, alerts := newAnomalyForTest(t)
+
+	for interval := 0; interval < 10; interval++ {
+		sendTraffic(anomaly, "10.0.0.1", interval, 20, 1)
+	}
+
+	// same volume but most replies are NXDOMAIN
+	messages := sendTraffic(anomaly, "10.0.0.1", 10, 20, 18)
+	last := messages[len(messages)-1]
+	if !last.Anomaly.Anomalous {
+		t.Fatal("nxdomain ratio not detected")
+	}
+	found := false
+	for _, reason := range last.Anomaly.Reasons {
+		if reason == dnsutils.AnomalyReasonNXDomain {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want %s reason, got %v", dnsutils.AnomalyReasonNXDomain, last.Anomaly.Reasons)
+	}
+	if len(alerts) != 1 {
+		t.Errorf("want 1 alert, got %d", len(alerts))
+	}
+}
+
+func TestAnomaly_PerClientBaseline(t *testing.T) {
+	anomaly, alerts := newAnomalyForTest(t)
+
+	// a busy client and a quiet client
+	for interval := 0; interval < 10; interval++ {
+		sendTraffic(anomaly, "10.0.0.1", interval, 200, 5)
+		sendTraffic(anomaly, "10.0.0.2", interval, 10, 0)
+	}
+
+	// normal for the busy client
+	if n := anomalousCount(sendTraffic(anomaly, "10.0.0.1", 10, 200, 5)); n != 0 {
+		t.Errorf("busy client: unexpected anomalies %d", n)
+	}
+	// spike for the quiet client
+	if n := anomalousCount(sendTraffic(anomaly, "10.0.0.2", 10, 200, 5)); n == 0 {
+		t.Error("quiet client: spike not detected")
+	}
+	if len(alerts) != 1 {
+		t.Errorf("want 1 alert, got %d", len(alerts))
+	}
+}
+
+func TestAnomaly_Warmup(t *testing.T) {
+	anomaly, alerts := newAnomalyForTest(t)
+
+	// no alert before the baseline is learned
+	sendTraffic(anomaly, "10.0.0.1", 0, 10, 0)
+	if n := anomalousCount(sendTraffic(anomaly, "10.0.0.1", 1, 500, 400)); n != 0 {
+		t.Errorf("unexpected anomalies during warmup %d", n)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("unexpected alerts during warmup")
+	}
+}
+
+func TestAnomaly_UniqueQnamesBounded(t *testing.T) {
+	anomaly, _ := newAnomalyForTest(t)
+
+	// a tunnel with a new qname in each query
+	for i := 0; i < 100000; i++ {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.NetworkInfo.QueryIP = "10.0.0.1"
+		dm.DNS.Qname = strconv.Itoa(i) + ".tunnel.example.com"
+		dm.DNSTap.Timestamp = anomalyTestStart + int64(i)*1000
+		anomaly.detectAnomaly(&dm)
+	}
+
+	client, _ := anomaly.clients.Get("10.0.0.1")
+	if len(client.qnames.registers) != 1<<anomalyHLLPrecision {
+		t.Errorf("the sketch must have a fixed size, got %d registers", len(client.qnames.registers))
+	}
+	// the seed of the sketch is random, the tolerance is 5 times the standard error
+	if client.uniqueQnames < 85000 || client.uniqueQnames > 115000 {
+		t.Errorf("want around 100000 distinct qnames, got %d", client.uniqueQnames)
+	}
+}
+
+func TestAnomaly_EWMA(t *testing.T) {
+	e := EWMA{}
+	for i := 0; i < 100; i++ {
+		e.Update(10, 0.1)
+	}
+	if e.Mean < 9.99 || e.Mean > 10.01 {
+		t.Errorf("want mean 10, got %f", e.Mean)
+	}
+	// the standard deviation is floored to 10% of the mean
+	if d := e.Deviation(12, 0); d < 1.99 || d > 2.01 {
+		t.Errorf("want deviation 2, got %f", d)
+	}
+}
+
+func TestAnomaly_InvalidConfig(t *testing.T) {
+	testcases := []struct {
+		name      string
+		interval  int
+		alpha     float64
+		cacheSize int
+	}{
+		{name: "zero interval", interval: 0, alpha: 0.1, cacheSize: 10},
+		{name: "negative interval", interval: -10, alpha: 0.1, cacheSize: 10},
+		{name: "zero alpha", interval: 10, alpha: 0, cacheSize: 10},
+		{name: "alpha above one", interval: 10, alpha: 1.5, cacheSize: 10},
+		{name: "zero cache size", interval: 10, alpha: 0.1, cacheSize: 0},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := pkgconfig.GetFakeConfigTransformers()
+			config.Anomaly.Enable = true
+			config.Anomaly.Interval = tc.interval
+			config.Anomaly.Alpha = tc.alpha
+			config.Anomaly.CacheSize = tc.cacheSize
+
+			anomaly := NewAnomalyTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+			if _, err := anomaly.GetTransforms(); err == nil {
+				t.Errorf("error expected")
+			}
+		})
+	}
+}
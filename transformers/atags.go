@@ -1,13 +1,22 @@
 package transformers
 
 import (
+	"fmt"
+
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
 )
 
+type atagsRule struct {
+	include map[string]interface{}
+	exclude map[string]interface{}
+	tags    []*dnsutils.FieldTemplate
+}
+
 type ATagsTransform struct {
 	GenericTransformer
+	rules []atagsRule
 }
 
 func NewATagsTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *ATagsTransform {
@@ -20,6 +29,26 @@ func (t *ATagsTransform) GetTransforms() ([]Subtransform, error) {
 	if len(t.config.ATags.AddTags) > 0 {
 		subtransforms = append(subtransforms, Subtransform{name: "atags:add", processFunc: t.addTags})
 	}
+
+	t.rules = []atagsRule{}
+	for i, cfg := range t.config.ATags.Rules {
+		if len(cfg.Tags) == 0 {
+			return nil, fmt.Errorf("rule %d: no tags", i+1)
+		}
+		rule := atagsRule{include: cfg.Match.Include, exclude: cfg.Match.Exclude}
+		// the placeholders of the tags are flat json keys, e.g. rcode:{{dns.rcode}}
+		for _, tag := range cfg.Tags {
+			tmpl, err := dnsutils.NewFieldTemplate(tag)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			rule.tags = append(rule.tags, tmpl)
+		}
+		t.rules = append(t.rules, rule)
+	}
+	if len(t.rules) > 0 {
+		subtransforms = append(subtransforms, Subtransform{name: "atags:rules", processFunc: t.addRuleTags})
+	}
 	return subtransforms, nil
 }
 
@@ -31,3 +60,36 @@ func (t *ATagsTransform) addTags(dm *dnsutils.DNSMessage) (int, error) {
 	dm.ATags.Tags = append(dm.ATags.Tags, t.config.ATags.AddTags...)
 	return ReturnKeep, nil
 }
+
+// addRuleTags adds the tags of the matching rules, a rule without include and exclude matches all messages
+func (t *ATagsTransform) addRuleTags(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.ATags == nil {
+		dm.ATags = &dnsutils.TransformATags{Tags: []string{}}
+	}
+
+	for _, rule := range t.rules {
+		if len(rule.include) > 0 {
+			err, matched := dm.Matching(rule.include)
+			if err != nil {
+				return ReturnError, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		if len(rule.exclude) > 0 {
+			err, matched := dm.Matching(rule.exclude)
+			if err != nil {
+				return ReturnError, err
+			}
+			if matched {
+				continue
+			}
+		}
+
+		for _, tag := range rule.tags {
+			dm.ATags.Tags = append(dm.ATags.Tags, tag.Execute(dm))
+		}
+	}
+	return ReturnKeep, nil
+}
@@ -1,6 +1,7 @@
 package transformers
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
@@ -31,3 +32,74 @@ func TestATags_AddTag(t *testing.T) {
 		t.Errorf("incorrect number of tag in DNSMessage")
 	}
 }
+
+func TestATags_Rules(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ATags.Enable = true
+
+	internal := pkgconfig.ATagsRule{Tags: []string{"internal"}}
+	internal.Match.Include = map[string]interface{}{"network.query-ip": "^10\\."}
+
+	failures := pkgconfig.ATagsRule{Tags: []string{"rcode:{{dns.rcode}}", "{{ dns.qtype }}:{{dns.qname}}"}}
+	failures.Match.Exclude = map[string]interface{}{"dns.rcode": "NOERROR"}
+
+	all := pkgconfig.ATagsRule{Tags: []string{"country:{{geoip.country-isocode}}"}}
+
+	config.ATags.Rules = []pkgconfig.ATagsRule{internal, failures, all}
+
+	// init the processor
+	outChans := []chan dnsutils.DNSMessage{}
+	atags := NewATagsTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := atags.GetTransforms(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testcases := []struct {
+		name    string
+		queryIP string
+		rcode   string
+		want    []string
+	}{
+		{name: "internal", queryIP: "10.0.0.1", rcode: "NOERROR", want: []string{"internal", "country:-"}},
+		{name: "external error", queryIP: "1.2.3.4", rcode: "NXDOMAIN", want: []string{"rcode:NXDOMAIN", "A:" + pkgconfig.ProgQname, "country:-"}},
+		{name: "external", queryIP: "1.2.3.4", rcode: "NOERROR", want: []string{"country:-"}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.NetworkInfo.QueryIP = tc.queryIP
+			dm.DNS.Rcode = tc.rcode
+
+			if _, err := atags.addRuleTags(&dm); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(dm.ATags.Tags, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, dm.ATags.Tags)
+			}
+		})
+	}
+}
+
+func TestATags_RuleWithoutTags(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ATags.Enable = true
+	config.ATags.Rules = []pkgconfig.ATagsRule{{}}
+
+	atags := NewATagsTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := atags.GetTransforms(); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestATags_RuleInvalidPlaceholder(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ATags.Enable = true
+	config.ATags.Rules = []pkgconfig.ATagsRule{{Tags: []string{"rcode:{{dns.rcode"}}}
+
+	atags := NewATagsTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := atags.GetTransforms(); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
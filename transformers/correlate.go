@@ -0,0 +1,102 @@
+package transformers
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+// correlate transformer, queries are held until the reply and a single merged record is emitted
+type CorrelateTransform struct {
+	GenericTransformer
+	mapQueries MapQueries
+}
+
+func NewCorrelateTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *CorrelateTransform {
+	t := &CorrelateTransform{GenericTransformer: NewTransformer(config, logger, "correlate", name, instance, nextWorkers)}
+	t.mapQueries = NewMapQueries(time.Duration(config.Correlate.QueriesTimeout)*time.Second, t.sendUnanswered)
+	return t
+}
+
+func (t *CorrelateTransform) GetTransforms() ([]Subtransform, error) {
+	t.mapQueries.SetTTL(time.Duration(t.config.Correlate.QueriesTimeout) * time.Second)
+
+	subtransforms := []Subtransform{}
+	if t.config.Correlate.Enable {
+		subtransforms = append(subtransforms, Subtransform{name: "correlate:merge", processFunc: t.correlate})
+	}
+	return subtransforms, nil
+}
+
+// sendUnanswered forwards the evicted query as an unanswered record
+func (t *CorrelateTransform) sendUnanswered(dm dnsutils.DNSMessage) {
+	if !t.config.Correlate.UnansweredQueries {
+		return
+	}
+
+	t.initCorrelation(&dm)
+	dm.Correlation.Status = dnsutils.CorrelationUnanswered
+	dm.Correlation.QueryTimestamp = dm.DNSTap.TimestampRFC3339
+	dm.Correlation.QueryLength = dm.DNS.Length
+	dm.Correlation.QueryFlags = dm.DNS.Flags
+	dm.Correlation.QueryEDNS = dm.EDNS
+	dm.DNS.Rcode = dnsutils.DNSRcodeTimeout
+
+	for i := range t.nextWorkers {
+		t.nextWorkers[i] <- dm
+	}
+}
+
+func (t *CorrelateTransform) initCorrelation(dm *dnsutils.DNSMessage) {
+	if dm.Correlation == nil {
+		dm.Correlation = &dnsutils.TransformCorrelation{Status: "-", QueryTimestamp: "-", ReplyTimestamp: "-",
+			QueryEDNS: dnsutils.DNSExtended{Options: []dnsutils.DNSOption{}}, ReplyEDNS: dnsutils.DNSExtended{Options: []dnsutils.DNSOption{}}}
+	}
+}
+
+func (t *CorrelateTransform) correlate(dm *dnsutils.DNSMessage) (int, error) {
+	queryport, _ := strconv.Atoi(dm.NetworkInfo.QueryPort)
+	if len(dm.NetworkInfo.QueryIP) == 0 || queryport == 0 || dm.DNS.MalformedPacket {
+		return ReturnKeep, nil
+	}
+
+	// compute the hash of the query
+	hashData := []string{dm.NetworkInfo.QueryIP, dm.NetworkInfo.QueryPort, strconv.Itoa(dm.DNS.ID)}
+	hashfnv := fnv.New64a()
+	hashfnv.Write([]byte(strings.Join(hashData, "+")))
+	key := hashfnv.Sum64()
+
+	// queries are held until the reply or the timeout
+	if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
+		t.mapQueries.Set(key, *dm)
+		return ReturnDrop, nil
+	}
+
+	t.initCorrelation(dm)
+	dm.Correlation.ReplyTimestamp = dm.DNSTap.TimestampRFC3339
+	dm.Correlation.ReplyLength = dm.DNS.Length
+	dm.Correlation.ReplyFlags = dm.DNS.Flags
+	dm.Correlation.ReplyEDNS = dm.EDNS
+
+	query, ok := t.mapQueries.Pop(key)
+	if !ok {
+		dm.Correlation.Status = dnsutils.CorrelationUnmatched
+		return ReturnKeep, nil
+	}
+
+	dm.Correlation.Status = dnsutils.CorrelationAnswered
+	dm.Correlation.QueryTimestamp = query.DNSTap.TimestampRFC3339
+	dm.Correlation.QueryLength = query.DNS.Length
+	dm.Correlation.QueryFlags = query.DNS.Flags
+	dm.Correlation.QueryEDNS = query.EDNS
+
+	latency := float64(dm.DNSTap.Timestamp-query.DNSTap.Timestamp) / float64(1000000000)
+	dm.DNSTap.Latency = latency
+	dm.DNSTap.LatencyMs = int(latency * 1000)
+	return ReturnKeep, nil
+}
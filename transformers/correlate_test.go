@@ -0,0 +1,144 @@
+package transformers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestCorrelate_MergeQueryAndReply(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Correlate.Enable = true
+
+	outChannels := []chan dnsutils.DNSMessage{make(chan dnsutils.DNSMessage, 1)}
+
+	// init transformer
+	correlate := NewCorrelateTransform(config, logger.New(false), "test", 0, outChannels)
+	correlate.GetTransforms()
+
+	// the query is held
+	CQ := dnsutils.GetFakeDNSMessage()
+	CQ.DNS.Length = 50
+	CQ.DNS.Flags.RD = true
+	CQ.EDNS.UDPSize = 1232
+	CQ.DNSTap.Timestamp = 1704486841216166066
+	CQ.DNSTap.TimestampRFC3339 = "2024-01-05T20:34:01.216166066Z"
+	if result, _ := correlate.correlate(&CQ); result != ReturnDrop {
+		t.Errorf("query should be held, got %d", result)
+	}
+
+	// the reply is merged with the query
+	CR := dnsutils.GetFakeDNSMessage()
+	CR.DNS.Type = dnsutils.DNSReply
+	CR.DNS.Length = 120
+	CR.DNS.Flags.QR = true
+	CR.DNS.Flags.RA = true
+	CR.EDNS.UDPSize = 4096
+	CR.DNSTap.Timestamp = 1704486841227961611
+	CR.DNSTap.TimestampRFC3339 = "2024-01-05T20:34:01.227961611Z"
+	if result, _ := correlate.correlate(&CR); result != ReturnKeep {
+		t.Errorf("reply should be kept, got %d", result)
+	}
+
+	if CR.Correlation.Status != dnsutils.CorrelationAnswered {
+		t.Errorf("want status %s, got %s", dnsutils.CorrelationAnswered, CR.Correlation.Status)
+	}
+	if CR.Correlation.QueryTimestamp != CQ.DNSTap.TimestampRFC3339 || CR.Correlation.ReplyTimestamp != CR.DNSTap.TimestampRFC3339 {
+		t.Errorf("incorrect timestamps: %s / %s", CR.Correlation.QueryTimestamp, CR.Correlation.ReplyTimestamp)
+	}
+	if CR.Correlation.QueryLength != 50 || CR.Correlation.ReplyLength != 120 {
+		t.Errorf("incorrect lengths: %d / %d", CR.Correlation.QueryLength, CR.Correlation.ReplyLength)
+	}
+	if !CR.Correlation.QueryFlags.RD || CR.Correlation.QueryFlags.QR || !CR.Correlation.ReplyFlags.QR || !CR.Correlation.ReplyFlags.RA {
+		t.Errorf("incorrect flags: %+v / %+v", CR.Correlation.QueryFlags, CR.Correlation.ReplyFlags)
+	}
+	if CR.Correlation.QueryEDNS.UDPSize != 1232 || CR.Correlation.ReplyEDNS.UDPSize != 4096 {
+		t.Errorf("incorrect edns: %d / %d", CR.Correlation.QueryEDNS.UDPSize, CR.Correlation.ReplyEDNS.UDPSize)
+	}
+	if CR.DNSTap.LatencyMs != 11 {
+		t.Errorf("incorrect latency, got %d ms", CR.DNSTap.LatencyMs)
+	}
+
+	// no unanswered record after the timeout
+	select {
+	case dm := <-outChannels[0]:
+		t.Errorf("unexpected unanswered record: %s", dm.Correlation.Status)
+	case <-time.After(time.Duration(config.Correlate.QueriesTimeout+1) * time.Second):
+	}
+}
+
+func TestCorrelate_UnmatchedReply(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Correlate.Enable = true
+
+	correlate := NewCorrelateTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	correlate.GetTransforms()
+
+	CR := dnsutils.GetFakeDNSMessage()
+	CR.DNS.Type = dnsutils.DNSReply
+	if result, _ := correlate.correlate(&CR); result != ReturnKeep {
+		t.Errorf("reply should be kept, got %d", result)
+	}
+	if CR.Correlation.Status != dnsutils.CorrelationUnmatched {
+		t.Errorf("want status %s, got %s", dnsutils.CorrelationUnmatched, CR.Correlation.Status)
+	}
+}
+
+func TestCorrelate_UnansweredQuery(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Correlate.Enable = true
+	config.Correlate.QueriesTimeout = 1
+
+	outChannels := []chan dnsutils.DNSMessage{make(chan dnsutils.DNSMessage, 1)}
+
+	correlate := NewCorrelateTransform(config, logger.New(false), "test", 0, outChannels)
+	correlate.GetTransforms()
+
+	CQ := dnsutils.GetFakeDNSMessage()
+	CQ.DNS.Length = 50
+	correlate.correlate(&CQ)
+
+	select {
+	case dm := <-outChannels[0]:
+		if dm.Correlation.Status != dnsutils.CorrelationUnanswered {
+			t.Errorf("want status %s, got %s", dnsutils.CorrelationUnanswered, dm.Correlation.Status)
+		}
+		if dm.DNS.Rcode != dnsutils.DNSRcodeTimeout {
+			t.Errorf("incorrect rcode, expected=TIMEOUT, got=%s", dm.DNS.Rcode)
+		}
+		if dm.Correlation.QueryLength != 50 {
+			t.Errorf("incorrect query length, got %d", dm.Correlation.QueryLength)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no unanswered record")
+	}
+}
+
+func TestCorrelate_RetransmittedQuery(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Correlate.Enable = true
+	config.Correlate.QueriesTimeout = 1
+
+	outChannels := []chan dnsutils.DNSMessage{make(chan dnsutils.DNSMessage, 2)}
+
+	correlate := NewCorrelateTransform(config, logger.New(false), "test", 0, outChannels)
+	correlate.GetTransforms()
+
+	// the second query replaces the first one, only one unanswered record is emitted
+	CQ := dnsutils.GetFakeDNSMessage()
+	correlate.correlate(&CQ)
+	time.Sleep(500 * time.Millisecond)
+	correlate.correlate(&CQ)
+
+	time.Sleep(2 * time.Second)
+	if n := len(outChannels[0]); n != 1 {
+		t.Errorf("want 1 unanswered record, got %d", n)
+	}
+}
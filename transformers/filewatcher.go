@@ -0,0 +1,103 @@
+package transformers
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// delay before notifying a change, editors and download tools can write a file several times
+const fileWatcherDelay = 500 * time.Millisecond
+
+// FileWatcher calls the handler when a file is created, updated or replaced by a rename,
+// the folders are watched because the files can be replaced
+type FileWatcher struct {
+	watcher *fsnotify.Watcher
+	files   map[string]struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewFileWatcher(files []string, onChange func(file string), onError func(err error)) (*FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch files: %w", err)
+	}
+
+	w := &FileWatcher{
+		watcher: watcher,
+		files:   make(map[string]struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if _, ok := w.files[file]; ok {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("unable to watch %s: %w", file, err)
+		}
+		w.files[file] = struct{}{}
+	}
+
+	go w.run(onChange, onError)
+	return w, nil
+}
+
+// Stop returns when the handler is no more called
+func (w *FileWatcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *FileWatcher) run(onChange func(file string), onError func(err error)) {
+	defer close(w.done)
+	defer w.watcher.Close()
+
+	changed := make(chan string)
+	timers := make(map[string]*time.Timer)
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			file := filepath.Clean(event.Name)
+			if _, ok := w.files[file]; !ok || !event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Rename) {
+				continue
+			}
+			if timer, ok := timers[file]; ok {
+				timer.Reset(fileWatcherDelay)
+			} else {
+				timers[file] = time.AfterFunc(fileWatcherDelay, func() {
+					select {
+					case changed <- file:
+					case <-w.stop:
+					}
+				})
+			}
+
+		case file := <-changed:
+			onChange(file)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			onError(err)
+		}
+	}
+}
@@ -1,53 +1,78 @@
 package transformers
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"os"
-	"regexp"
+	"hash/fnv"
+	"math"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
-	"inet.af/netaddr"
 )
 
+// sampleFields returns the values used in the key of the consistent sampling,
+// the query and the reply of an exchange have the same values
+var sampleFields = map[string]func(dm *dnsutils.DNSMessage) string{
+	dnsutils.SampleFieldQueryIP:      func(dm *dnsutils.DNSMessage) string { return dm.NetworkInfo.QueryIP },
+	dnsutils.SampleFieldQueryPort:    func(dm *dnsutils.DNSMessage) string { return dm.NetworkInfo.QueryPort },
+	dnsutils.SampleFieldResponseIP:   func(dm *dnsutils.DNSMessage) string { return dm.NetworkInfo.ResponseIP },
+	dnsutils.SampleFieldResponsePort: func(dm *dnsutils.DNSMessage) string { return dm.NetworkInfo.ResponsePort },
+	dnsutils.SampleFieldQname: func(dm *dnsutils.DNSMessage) string {
+		return strings.TrimSuffix(strings.ToLower(dm.DNS.Qname), ".")
+	},
+	dnsutils.SampleFieldID: func(dm *dnsutils.DNSMessage) string { return strconv.Itoa(dm.DNS.ID) },
+}
+
+// sampleHash returns a position between 0 and 1, the fnv hash is mixed with
+// the splitmix64 finalizer to spread the similar keys
+func sampleHash(key []byte) float64 {
+	h := fnv.New64a()
+	h.Write(key)
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
+
 type FilteringTransform struct {
 	GenericTransformer
-	mapRcodes                              map[string]bool
-	ipsetDrop, ipsetKeep, rDataIpsetKeep   *netaddr.IPSet
-	listFqdns, listKeepFqdns               map[string]bool
-	listDomainsRegex, listKeepDomainsRegex map[string]*regexp.Regexp
-	downsample, downsampleCount            int
+	workerName                  string
+	instance                    int
+	mapRcodes                   map[string]bool
+	dropFqdns, dropDomains      *FilteringList
+	keepFqdns, keepDomains      *FilteringList
+	dropQueryIPs, keepQueryIPs  *FilteringList
+	keepRdataIPs                *FilteringList
+	lists                       []*FilteringList
+	watcher                     *FileWatcher
+	downsample, downsampleCount int
 }
 
 func NewFilteringTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *FilteringTransform {
 	t := &FilteringTransform{GenericTransformer: NewTransformer(config, logger, "filtering", name, instance, nextWorkers)}
+	t.workerName = name
+	t.instance = instance
 	t.mapRcodes = make(map[string]bool)
-	t.ipsetDrop = &netaddr.IPSet{}
-	t.ipsetKeep = &netaddr.IPSet{}
-	t.rDataIpsetKeep = &netaddr.IPSet{}
-	t.listFqdns = make(map[string]bool)
-	t.listDomainsRegex = make(map[string]*regexp.Regexp)
-	t.listKeepFqdns = make(map[string]bool)
-	t.listKeepDomainsRegex = make(map[string]*regexp.Regexp)
 	return t
 }
 
 func (t *FilteringTransform) GetTransforms() ([]Subtransform, error) {
 	subtransforms := []Subtransform{}
 
+	t.stopWatcher()
+	filteringMetrics.unregister(t)
+
 	if err := t.LoadRcodes(); err != nil {
 		return nil, err
 	}
-	if err := t.LoadDomainsList(); err != nil {
-		return nil, err
-	}
-	if err := t.LoadQueryIPList(); err != nil {
-		return nil, err
-	}
-	if err := t.LoadrDataIPList(); err != nil {
+	if err := t.LoadLists(); err != nil {
 		return nil, err
 	}
 
@@ -60,35 +85,66 @@ func (t *FilteringTransform) GetTransforms() ([]Subtransform, error) {
 	if len(t.mapRcodes) > 0 {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:drop-rcode", processFunc: t.dropRCodeFilter})
 	}
-	if len(t.config.Filtering.KeepQueryIPFile) > 0 {
+	if t.keepQueryIPs != nil {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:keep-queryip", processFunc: t.keepQueryIPFilter})
 	}
-	if len(t.config.Filtering.DropQueryIPFile) > 0 {
+	if t.dropQueryIPs != nil {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:drop-queryip", processFunc: t.dropQueryIPFilter})
 	}
-	if len(t.config.Filtering.KeepRdataFile) > 0 {
+	if t.keepRdataIPs != nil {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:keep-rdata", processFunc: t.keepRdataFilter})
 	}
-	if len(t.listFqdns) > 0 {
+	if t.dropFqdns != nil {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:drop-fqdn", processFunc: t.dropFqdnFilter})
 	}
-	if len(t.listDomainsRegex) > 0 {
+	if t.dropDomains != nil {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:drop-domain", processFunc: t.dropDomainRegexFilter})
 	}
-	if len(t.listKeepFqdns) > 0 {
+	if t.keepFqdns != nil {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:keep-fqdn", processFunc: t.keepFqdnFilter})
 	}
-	if len(t.listKeepDomainsRegex) > 0 {
+	if t.keepDomains != nil {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:keep-domain", processFunc: t.keepDomainRegexFilter})
 	}
+	if t.config.Filtering.SampleFraction > 0 {
+		if t.config.Filtering.Downsample > 0 {
+			return nil, errors.New("downsample and sample-fraction can't be used together")
+		}
+		if t.config.Filtering.SampleFraction > 1 {
+			return nil, fmt.Errorf("invalid sample fraction: %v, a value between 0 and 1 is expected", t.config.Filtering.SampleFraction)
+		}
+		if len(t.config.Filtering.SampleFields) == 0 {
+			return nil, errors.New("at least one sample field is expected")
+		}
+		for _, field := range t.config.Filtering.SampleFields {
+			if _, ok := sampleFields[field]; !ok {
+				return nil, fmt.Errorf("invalid sample field: %s", field)
+			}
+		}
+		subtransforms = append(subtransforms, Subtransform{name: "filtering:sampling", processFunc: t.sampleFilter})
+	}
 	if t.config.Filtering.Downsample > 0 {
 		t.downsample = t.config.Filtering.Downsample
 		t.downsampleCount = 0
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:downsampling", processFunc: t.downsampleFilter})
 	}
+
+	if len(t.lists) > 0 {
+		if t.config.Filtering.WatchFiles {
+			if err := t.startWatcher(); err != nil {
+				return nil, err
+			}
+		}
+		filteringMetrics.register(t)
+	}
 	return subtransforms, nil
 }
 
+func (t *FilteringTransform) Reset() {
+	t.stopWatcher()
+	filteringMetrics.unregister(t)
+}
+
 func (t *FilteringTransform) LoadRcodes() error {
 	// empty
 	for key := range t.mapRcodes {
@@ -102,185 +158,79 @@ func (t *FilteringTransform) LoadRcodes() error {
 	return nil
 }
 
-func (t *FilteringTransform) LoadQueryIPList() error {
-	if len(t.config.Filtering.DropQueryIPFile) > 0 {
-		read, err := t.loadQueryIPList(t.config.Filtering.DropQueryIPFile, true)
-		if err != nil {
-			return fmt.Errorf("unable to open query ip file: %w", err)
+// LoadLists loads the configured files, the lists are replaced by new ones
+func (t *FilteringTransform) LoadLists() error {
+	t.lists = nil
+	t.dropFqdns = t.newList("drop-fqdn-file", t.config.Filtering.DropFqdnFile, filteringListFqdn)
+	t.dropDomains = t.newList("drop-domain-file", t.config.Filtering.DropDomainFile, filteringListDomain)
+	t.keepFqdns = t.newList("keep-fqdn-file", t.config.Filtering.KeepFqdnFile, filteringListFqdn)
+	t.keepDomains = t.newList("keep-domain-file", t.config.Filtering.KeepDomainFile, filteringListDomain)
+	t.dropQueryIPs = t.newList("drop-queryip-file", t.config.Filtering.DropQueryIPFile, filteringListIP)
+	t.keepQueryIPs = t.newList("keep-queryip-file", t.config.Filtering.KeepQueryIPFile, filteringListIP)
+	t.keepRdataIPs = t.newList("keep-rdata-file", t.config.Filtering.KeepRdataFile, filteringListIP)
+
+	for _, list := range t.lists {
+		if err := t.loadList(list); err != nil {
+			return fmt.Errorf("unable to load %s: %w", list.name, err)
 		}
-		t.LogInfo("loaded with %d query ip to the drop list", read)
-	}
-
-	if len(t.config.Filtering.KeepQueryIPFile) > 0 {
-		read, err := t.loadQueryIPList(t.config.Filtering.KeepQueryIPFile, false)
-		if err != nil {
-			return fmt.Errorf("unable to open query ip file: %w", err)
-		}
-		t.LogInfo("loaded with %d query ip to the keep list", read)
 	}
 	return nil
 }
 
-func (t *FilteringTransform) LoadrDataIPList() error {
-	if len(t.config.Filtering.KeepRdataFile) > 0 {
-		read, err := t.loadKeepRdataIPList(t.config.Filtering.KeepRdataFile)
-		if err != nil {
-			return fmt.Errorf("unable to open rdata ip file: %w", err)
-		}
-		t.LogInfo("loaded with %d rdata ip to the keep list", read)
+func (t *FilteringTransform) newList(name, file, kind string) *FilteringList {
+	if len(file) == 0 {
+		return nil
 	}
-	return nil
+	list := NewFilteringList(name, file, kind)
+	t.lists = append(t.lists, list)
+	return list
 }
 
-func (t *FilteringTransform) LoadDomainsList() error {
-	// before to start, reset all maps
-	for key := range t.listFqdns {
-		delete(t.listFqdns, key)
-	}
-	for key := range t.listDomainsRegex {
-		delete(t.listDomainsRegex, key)
-	}
-	for key := range t.listKeepFqdns {
-		delete(t.listKeepFqdns, key)
+func (t *FilteringTransform) loadList(list *FilteringList) error {
+	invalid, err := list.Load()
+	if err != nil {
+		return err
 	}
-	for key := range t.listKeepDomainsRegex {
-		delete(t.listKeepDomainsRegex, key)
+	if invalid > 0 {
+		t.LogError("%d entries of %s are neither an IP address nor a prefix", invalid, list.file)
 	}
+	t.LogInfo("%s loaded with %d entries", list.name, list.Len())
+	return nil
+}
 
-	if len(t.config.Filtering.DropFqdnFile) > 0 {
-		file, err := os.Open(t.config.Filtering.DropFqdnFile)
-		if err != nil {
-			return fmt.Errorf("unable to open fqdn file: %w", err)
-		} else {
-
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				fqdn := strings.ToLower(scanner.Text())
-				t.listFqdns[fqdn] = true
-			}
-			t.LogInfo("loaded with %d fqdn to the drop list", len(t.listFqdns))
-		}
-
-	}
-
-	if len(t.config.Filtering.DropDomainFile) > 0 {
-		file, err := os.Open(t.config.Filtering.DropDomainFile)
-		if err != nil {
-			return fmt.Errorf("unable to open regex list file: %w", err)
-		} else {
-
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				domain := strings.ToLower(scanner.Text())
-				t.listDomainsRegex[domain] = regexp.MustCompile(domain)
-			}
-			t.LogInfo("loaded with %d domains to the drop list", len(t.listDomainsRegex))
-		}
+func (t *FilteringTransform) stopWatcher() {
+	if t.watcher != nil {
+		t.watcher.Stop()
+		t.watcher = nil
 	}
+}
 
-	if len(t.config.Filtering.KeepFqdnFile) > 0 {
-		file, err := os.Open(t.config.Filtering.KeepFqdnFile)
-		if err != nil {
-			return fmt.Errorf("unable to open KeepFqdnFile file: %w", err)
-		} else {
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				keepDomain := strings.ToLower(scanner.Text())
-				t.listKeepFqdns[keepDomain] = true
-			}
-			t.LogInfo("loaded with %d fqdn(s) to the keep list", len(t.listKeepFqdns))
-		}
+func (t *FilteringTransform) startWatcher() error {
+	files := []string{}
+	for _, list := range t.lists {
+		files = append(files, list.file)
 	}
 
-	if len(t.config.Filtering.KeepDomainFile) > 0 {
-		file, err := os.Open(t.config.Filtering.KeepDomainFile)
-		if err != nil {
-			return fmt.Errorf("unable to open KeepDomainFile file: %w", err)
-		} else {
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				keepDomain := strings.ToLower(scanner.Text())
-				t.listKeepDomainsRegex[keepDomain] = regexp.MustCompile(keepDomain)
-			}
-			t.LogInfo("loaded with %d domains to the keep list", len(t.listKeepDomainsRegex))
-		}
+	watcher, err := NewFileWatcher(files, t.reloadLists, func(err error) { t.LogError("watcher error: %v", err) })
+	if err != nil {
+		return err
 	}
+	t.watcher = watcher
 	return nil
 }
 
-func (t *FilteringTransform) loadQueryIPList(fname string, drop bool) (uint64, error) {
-	var emptyIPSet *netaddr.IPSet
-	t.ipsetDrop = emptyIPSet
-	t.ipsetKeep = emptyIPSet
-
-	file, err := os.Open(fname)
-	if err != nil {
-		return 0, err
-	}
-
-	scanner := bufio.NewScanner(file)
-	var read uint64
-	var ipsetbuilder netaddr.IPSetBuilder
-	for scanner.Scan() {
-		read++
-		ipOrPrefix := strings.ToLower(scanner.Text())
-		prefix, err := netaddr.ParseIPPrefix(ipOrPrefix)
-		if err != nil {
-			ip, err := netaddr.ParseIP(ipOrPrefix)
-			if err != nil {
-				t.LogError("%s in in %s is neither an IP address nor a prefix", ipOrPrefix, fname)
-				continue
-			}
-			ipsetbuilder.Add(ip)
+// reloadLists reloads the lists of the file, the previous entries are kept on error
+func (t *FilteringTransform) reloadLists(file string) {
+	for _, list := range t.lists {
+		if filepath.Clean(list.file) != file {
 			continue
 		}
-		ipsetbuilder.AddPrefix(prefix)
-	}
-
-	file.Close()
-
-	if drop {
-		t.ipsetDrop, err = ipsetbuilder.IPSet()
-	} else {
-		t.ipsetKeep, err = ipsetbuilder.IPSet()
-	}
-
-	return read, err
-}
-
-func (t *FilteringTransform) loadKeepRdataIPList(fname string) (uint64, error) {
-	var emptyIPSet *netaddr.IPSet
-	t.rDataIpsetKeep = emptyIPSet
-
-	file, err := os.Open(fname)
-	if err != nil {
-		return 0, err
-	}
-
-	scanner := bufio.NewScanner(file)
-	var read uint64
-	var ipsetbuilder netaddr.IPSetBuilder
-	for scanner.Scan() {
-		read++
-		ipOrPrefix := strings.ToLower(scanner.Text())
-		prefix, err := netaddr.ParseIPPrefix(ipOrPrefix)
-		if err != nil {
-			ip, err := netaddr.ParseIP(ipOrPrefix)
-			if err != nil {
-				t.LogError("%s in in %s is neither an IP address nor a prefix", ipOrPrefix, fname)
-				continue
-			}
-			ipsetbuilder.Add(ip)
+		if err := t.loadList(list); err != nil {
+			t.LogError("unable to reload %s: %v", list.name, err)
 			continue
 		}
-		ipsetbuilder.AddPrefix(prefix)
+		list.reloads.Add(1)
 	}
-
-	file.Close()
-
-	t.rDataIpsetKeep, err = ipsetbuilder.IPSet()
-
-	return read, err
 }
 
 func (t *FilteringTransform) dropQueryFilter(dm *dnsutils.DNSMessage) (int, error) {
@@ -306,30 +256,25 @@ func (t *FilteringTransform) dropRCodeFilter(dm *dnsutils.DNSMessage) (int, erro
 }
 
 func (t *FilteringTransform) keepQueryIPFilter(dm *dnsutils.DNSMessage) (int, error) {
-	ip, _ := netaddr.ParseIP(dm.NetworkInfo.QueryIP)
-	if t.ipsetKeep.Contains(ip) {
+	if t.keepQueryIPs.MatchIP(dm.NetworkInfo.QueryIP) {
 		return ReturnKeep, nil
 	}
 	return ReturnDrop, nil
 }
 
 func (t *FilteringTransform) dropQueryIPFilter(dm *dnsutils.DNSMessage) (int, error) {
-	ip, _ := netaddr.ParseIP(dm.NetworkInfo.QueryIP)
-	if t.ipsetDrop.Contains(ip) {
+	if t.dropQueryIPs.MatchIP(dm.NetworkInfo.QueryIP) {
 		return ReturnDrop, nil
 	}
 	return ReturnKeep, nil
 }
 
 func (t *FilteringTransform) keepRdataFilter(dm *dnsutils.DNSMessage) (int, error) {
-	if len(dm.DNS.DNSRRs.Answers) > 0 {
-		// If even one exists in filter list then pass through filter
-		for _, answer := range dm.DNS.DNSRRs.Answers {
-			if answer.Rdatatype == "A" || answer.Rdatatype == "AAAA" {
-				ip, _ := netaddr.ParseIP(answer.Rdata)
-				if t.rDataIpsetKeep.Contains(ip) {
-					return ReturnKeep, nil
-				}
+	// If even one exists in filter list then pass through filter
+	for _, answer := range dm.DNS.DNSRRs.Answers {
+		if answer.Rdatatype == "A" || answer.Rdatatype == "AAAA" {
+			if t.keepRdataIPs.MatchIP(answer.Rdata) {
+				return ReturnKeep, nil
 			}
 		}
 	}
@@ -337,35 +282,31 @@ func (t *FilteringTransform) keepRdataFilter(dm *dnsutils.DNSMessage) (int, erro
 }
 
 func (t *FilteringTransform) dropFqdnFilter(dm *dnsutils.DNSMessage) (int, error) {
-	if _, ok := t.listFqdns[dm.DNS.Qname]; ok {
+	if t.dropFqdns.MatchDomain(dm.DNS.Qname) {
 		return ReturnDrop, nil
 	}
 	return ReturnKeep, nil
 }
 
+// domains and their subdomains, or regular expressions
 func (t *FilteringTransform) dropDomainRegexFilter(dm *dnsutils.DNSMessage) (int, error) {
-	// partial fqdn with regexp
-	for _, d := range t.listDomainsRegex {
-		if d.MatchString(dm.DNS.Qname) {
-			return ReturnDrop, nil
-		}
+	if t.dropDomains.MatchDomain(dm.DNS.Qname) {
+		return ReturnDrop, nil
 	}
 	return ReturnKeep, nil
 }
 
+// an empty keep list doesn't drop the messages
 func (t *FilteringTransform) keepFqdnFilter(dm *dnsutils.DNSMessage) (int, error) {
-	if _, ok := t.listKeepFqdns[dm.DNS.Qname]; ok {
+	if t.keepFqdns.Len() == 0 || t.keepFqdns.MatchDomain(dm.DNS.Qname) {
 		return ReturnKeep, nil
 	}
 	return ReturnDrop, nil
 }
 
 func (t *FilteringTransform) keepDomainRegexFilter(dm *dnsutils.DNSMessage) (int, error) {
-	// partial fqdn with regexp
-	for _, d := range t.listKeepDomainsRegex {
-		if d.MatchString(dm.DNS.Qname) {
-			return ReturnKeep, nil
-		}
+	if t.keepDomains.Len() == 0 || t.keepDomains.MatchDomain(dm.DNS.Qname) {
+		return ReturnKeep, nil
 	}
 	return ReturnDrop, nil
 }
@@ -383,6 +324,7 @@ func (t *FilteringTransform) downsampleFilter(dm *dnsutils.DNSMessage) (int, err
 	remainder := t.downsampleCount % t.downsample
 	if dm.Filtering != nil {
 		dm.Filtering.SampleRate = t.downsample
+		dm.Filtering.SampleFraction = 1 / float64(t.downsample)
 	}
 
 	switch remainder {
@@ -396,3 +338,26 @@ func (t *FilteringTransform) downsampleFilter(dm *dnsutils.DNSMessage) (int, err
 		return ReturnDrop, nil
 	}
 }
+
+// keep the messages whose key is in the sampled fraction of the hash space,
+// the decision is the same for all messages with the same key
+func (t *FilteringTransform) sampleFilter(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.Filtering == nil {
+		dm.Filtering = &dnsutils.TransformFiltering{}
+	}
+
+	// the rate is the nearest 1:N equivalent for the consumers of the integer field,
+	// the fraction is the exact value to extrapolate the counts
+	dm.Filtering.SampleFraction = t.config.Filtering.SampleFraction
+	dm.Filtering.SampleRate = int(math.Round(1 / t.config.Filtering.SampleFraction))
+
+	key := []byte{}
+	for _, field := range t.config.Filtering.SampleFields {
+		key = append(key, sampleFields[field](dm)...)
+		key = append(key, 0)
+	}
+	if sampleHash(key) < t.config.Filtering.SampleFraction {
+		return ReturnKeep, nil
+	}
+	return ReturnDrop, nil
+}
@@ -0,0 +1,149 @@
+package transformers
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"inet.af/netaddr"
+)
+
+const (
+	filteringListFqdn   = "fqdn"
+	filteringListDomain = "domain"
+	filteringListIP     = "ip"
+)
+
+// the entries of the domain lists are regular expressions matching a part of the qname,
+// the entries with this prefix are domains matched with their subdomains
+const filteringSuffixPrefix = "suffix:"
+
+// filteringListData is the content of a file, replaced on reload
+type filteringListData struct {
+	fqdns   map[string]struct{}
+	domains *DomainSuffixTrie
+	regexes []*regexp.Regexp
+	ips     *IPRadixTree[struct{}]
+	size    int
+}
+
+// FilteringList is a list of fqdns, domains or ips loaded from a file,
+// the hits are counted for the metrics
+type FilteringList struct {
+	sync.RWMutex
+	name    string
+	file    string
+	kind    string
+	data    *filteringListData
+	hits    atomic.Uint64
+	reloads atomic.Uint64
+}
+
+func NewFilteringList(name, file, kind string) *FilteringList {
+	return &FilteringList{name: name, file: file, kind: kind,
+		data: &filteringListData{fqdns: map[string]struct{}{}, domains: NewDomainSuffixTrie(), ips: NewIPRadixTree[struct{}]()}}
+}
+
+// Load reads the file and replaces the content, the previous content is kept on error,
+// returns the number of invalid ips ignored
+func (l *FilteringList) Load() (int, error) {
+	file, err := os.Open(l.file)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	data := &filteringListData{fqdns: map[string]struct{}{}, domains: NewDomainSuffixTrie(), ips: NewIPRadixTree[struct{}]()}
+	invalid := 0
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if len(entry) == 0 || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		switch l.kind {
+		case filteringListFqdn:
+			data.fqdns[strings.TrimSuffix(entry, ".")] = struct{}{}
+		case filteringListDomain:
+			if domain, found := strings.CutPrefix(entry, filteringSuffixPrefix); found {
+				domain = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(domain), "*"), ".")
+				data.domains.Insert(domain)
+			} else {
+				re, err := regexp.Compile(entry)
+				if err != nil {
+					return 0, fmt.Errorf("line %d: %w", line, err)
+				}
+				data.regexes = append(data.regexes, re)
+			}
+		case filteringListIP:
+			prefix, err := parseIPOrPrefix(entry)
+			if err != nil {
+				invalid++
+				continue
+			}
+			data.ips.Insert(prefix, struct{}{})
+		}
+		data.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	l.Lock()
+	l.data = data
+	l.Unlock()
+	return invalid, nil
+}
+
+func (l *FilteringList) Len() int {
+	l.RLock()
+	defer l.RUnlock()
+	return l.data.size
+}
+
+// MatchDomain returns true when the qname is in the fqdn list, or when the qname
+// or a parent domain is in the suffixes of the domain list, the regular expressions
+// are checked last on the qname as received
+func (l *FilteringList) MatchDomain(qname string) bool {
+	domain := strings.TrimSuffix(strings.ToLower(qname), ".")
+
+	l.RLock()
+	defer l.RUnlock()
+
+	found := false
+	switch l.kind {
+	case filteringListFqdn:
+		_, found = l.data.fqdns[domain]
+	case filteringListDomain:
+		found = l.data.domains.Match(domain)
+		for i := 0; !found && i < len(l.data.regexes); i++ {
+			found = l.data.regexes[i].MatchString(qname)
+		}
+	}
+	if found {
+		l.hits.Add(1)
+	}
+	return found
+}
+
+// MatchIP returns true when the ip is in a prefix of the list
+func (l *FilteringList) MatchIP(ip string) bool {
+	addr, err := netaddr.ParseIP(ip)
+	if err != nil {
+		return false
+	}
+
+	l.RLock()
+	defer l.RUnlock()
+
+	if _, found := l.data.ips.Lookup(addr); found {
+		l.hits.Add(1)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package transformers
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/dmachard/go-dnscollector/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FilteringCollector exports the sizes and the hits of the lists of all filtering transforms,
+// it's registered once in the telemetry which sets the prefix of the metrics
+type FilteringCollector struct {
+	sync.Mutex
+	transforms map[*FilteringTransform]struct{}
+	entries    *prometheus.Desc
+	hits       *prometheus.Desc
+	reloads    *prometheus.Desc
+}
+
+func NewFilteringCollector() *FilteringCollector {
+	c := &FilteringCollector{transforms: make(map[*FilteringTransform]struct{})}
+	c.SetPrefix("dnscollector_exporter")
+	return c
+}
+
+var filteringMetrics = NewFilteringCollector()
+
+func init() {
+	telemetry.RegisterCollector(filteringMetrics)
+}
+
+func (c *FilteringCollector) SetPrefix(prefix string) {
+	c.Lock()
+	defer c.Unlock()
+
+	labels := []string{"worker", "instance", "list"}
+	c.entries = prometheus.NewDesc(prefix+"_filtering_list_entries",
+		"Number of entries in the filtering list", labels, nil)
+	c.hits = prometheus.NewDesc(prefix+"_filtering_list_hits_total",
+		"Number of messages matching the filtering list", labels, nil)
+	c.reloads = prometheus.NewDesc(prefix+"_filtering_list_reloads_total",
+		"Number of reloads of the filtering list", labels, nil)
+}
+
+func (c *FilteringCollector) register(t *FilteringTransform) {
+	c.Lock()
+	defer c.Unlock()
+	c.transforms[t] = struct{}{}
+}
+
+func (c *FilteringCollector) unregister(t *FilteringTransform) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.transforms, t)
+}
+
+func (c *FilteringCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.Lock()
+	defer c.Unlock()
+	ch <- c.entries
+	ch <- c.hits
+	ch <- c.reloads
+}
+
+func (c *FilteringCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+
+	for t := range c.transforms {
+		instance := strconv.Itoa(t.instance)
+		for _, list := range t.lists {
+			ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(list.Len()), t.workerName, instance, list.name)
+			ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(list.hits.Load()), t.workerName, instance, list.name)
+			ch <- prometheus.MustNewConstMetric(c.reloads, prometheus.CounterValue, float64(list.reloads.Load()), t.workerName, instance, list.name)
+		}
+	}
+}
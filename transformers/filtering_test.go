@@ -1,11 +1,19 @@
 package transformers
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 const (
@@ -472,3 +480,355 @@ func TestFilteringDownsampleFilter(t *testing.T) {
 		t.Errorf("expected %d messages to be kept, got %d", 10/N, kept)
 	}
 }
+
+func TestFilteringSampleFilter(t *testing.T) {
+	// config
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.SampleFraction = 0.1
+
+	outChans := []chan dnsutils.DNSMessage{}
+
+	// init processor
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := filtering.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate exchanges from several clients
+	kept := 0
+	total := 10000
+	for i := 0; i < total; i++ {
+		query := dnsutils.GetFakeDNSMessage()
+		query.NetworkInfo.QueryIP = fmt.Sprintf("10.0.%d.%d", i/250, i%250)
+		query.NetworkInfo.QueryPort = strconv.Itoa(1024 + i%60000)
+		query.DNS.ID = i % 65536
+
+		reply := dnsutils.GetFakeDNSMessage()
+		reply.DNS.Type = dnsutils.DNSReply
+		reply.NetworkInfo = query.NetworkInfo
+		reply.DNS.ID = query.DNS.ID
+
+		resultQuery, _ := filtering.sampleFilter(&query)
+		resultReply, _ := filtering.sampleFilter(&reply)
+		if resultQuery != resultReply {
+			t.Fatalf("exchange %d: the query and the reply must be sampled together", i)
+		}
+		if resultQuery == ReturnKeep {
+			kept++
+		}
+		if query.Filtering.SampleFraction != 0.1 {
+			t.Errorf("expected sample fraction 0.1, got %v", query.Filtering.SampleFraction)
+		}
+	}
+
+	// 10% of the exchanges with some tolerance
+	if kept < 900 || kept > 1100 {
+		t.Errorf("expected around %d exchanges to be kept, got %d", total/10, kept)
+	}
+}
+
+func TestFilteringSampleFilter_Qname(t *testing.T) {
+	// config
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.SampleFraction = 0.5
+	config.Filtering.SampleFields = []string{dnsutils.SampleFieldQname}
+
+	outChans := []chan dnsutils.DNSMessage{}
+
+	// init processor
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := filtering.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	// same decision for all the clients and the case of the qname
+	for i := 0; i < 100; i++ {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = fmt.Sprintf("www%d.example.com", i)
+		want, _ := filtering.sampleFilter(&dm)
+
+		other := dnsutils.GetFakeDNSMessage()
+		other.NetworkInfo.QueryIP = "192.168.1.1"
+		other.DNS.Qname = fmt.Sprintf("WWW%d.example.com.", i)
+		if got, _ := filtering.sampleFilter(&other); got != want {
+			t.Errorf("qname %s: expected the same decision for all clients", dm.DNS.Qname)
+		}
+	}
+}
+
+func TestFilteringSampleFilter_InvalidConfig(t *testing.T) {
+	tt := []struct {
+		name       string
+		rate       float64
+		downsample int
+		fields     []string
+	}{
+		{name: "rate greater than 1", rate: 2, fields: []string{dnsutils.SampleFieldQueryIP}},
+		{name: "with downsample", rate: 0.5, downsample: 10, fields: []string{dnsutils.SampleFieldQueryIP}},
+		{name: "no field", rate: 0.5, fields: []string{}},
+		{name: "invalid field", rate: 0.5, fields: []string{"qtype"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config := pkgconfig.GetFakeConfigTransformers()
+			config.Filtering.Enable = true
+			config.Filtering.SampleFraction = tc.rate
+			config.Filtering.Downsample = tc.downsample
+			config.Filtering.SampleFields = tc.fields
+
+			filtering := NewFilteringTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+			if _, err := filtering.GetTransforms(); err == nil {
+				t.Errorf("error expected")
+			}
+		})
+	}
+}
+
+func TestFiltering_DomainSuffixTrie(t *testing.T) {
+	trie := NewDomainSuffixTrie()
+	trie.Insert("github.com")
+	trie.Insert("Ads.Example.org.")
+	trie.Insert("github.com")
+
+	if trie.Len() != 2 {
+		t.Errorf("expected 2 domains, got %d", trie.Len())
+	}
+
+	testcases := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "github.com", want: true},
+		{domain: "test.github.com.", want: true},
+		{domain: "GITHUB.COM", want: true},
+		{domain: "notgithub.com", want: false},
+		{domain: "com", want: false},
+		{domain: "ads.example.org", want: true},
+		{domain: "x.y.ads.example.org", want: true},
+		{domain: "example.org", want: false},
+		{domain: "", want: false},
+	}
+	for _, tc := range testcases {
+		if got := trie.Match(tc.domain); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.domain, tc.want, got)
+		}
+	}
+}
+
+func TestFilteringByDomain_SuffixAndRegex(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "domains.txt")
+	os.WriteFile(file, []byte("# blocklist\nsuffix:ads.example.com\nsuffix:*.tracker.net\n\n^mail[0-9]+\\.google\\.com$\n"), 0o644)
+
+	// config
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.DropDomainFile = file
+
+	// init subprocessor
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := filtering.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer filtering.Reset()
+
+	if filtering.dropDomains.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", filtering.dropDomains.Len())
+	}
+
+	testcases := []struct {
+		qname string
+		want  int
+	}{
+		{qname: "ads.example.com", want: ReturnDrop},
+		{qname: "cdn.ads.example.com.", want: ReturnDrop},
+		{qname: "badads.example.com", want: ReturnKeep},
+		{qname: "pixel.tracker.net", want: ReturnDrop},
+		{qname: "tracker.net", want: ReturnDrop},
+		{qname: "mail42.google.com", want: ReturnDrop},
+		{qname: "mail.google.com", want: ReturnKeep},
+	}
+	for _, tc := range testcases {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = tc.qname
+		if result, _ := filtering.dropDomainRegexFilter(&dm); result != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.qname, tc.want, result)
+		}
+	}
+}
+
+func TestFilteringByDomain_PartialRegex(t *testing.T) {
+	// entries of the previous versions, regular expressions without anchors
+	file := filepath.Join(t.TempDir(), "domains.txt")
+	os.WriteFile(file, []byte("google\nads\ngithub.com\n"), 0o644)
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.DropDomainFile = file
+
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := filtering.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer filtering.Reset()
+
+	testcases := []struct {
+		qname string
+		want  int
+	}{
+		{qname: "www.google.fr", want: ReturnDrop},
+		{qname: "ads.example.net", want: ReturnDrop},
+		{qname: "mygithub.com", want: ReturnDrop},
+		{qname: "api.github.com", want: ReturnDrop},
+		{qname: "dns.collector", want: ReturnKeep},
+	}
+	for _, tc := range testcases {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = tc.qname
+		if result, _ := filtering.dropDomainRegexFilter(&dm); result != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.qname, tc.want, result)
+		}
+	}
+}
+
+func TestFilteringByDomain_InvalidRegex(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "domains.txt")
+	os.WriteFile(file, []byte("(unclosed\n"), 0o644)
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.DropDomainFile = file
+
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := filtering.GetTransforms(); err == nil {
+		t.Errorf("error expected for an invalid regular expression")
+	}
+}
+
+func TestFiltering_ReloadOnChange(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queryip.txt")
+	os.WriteFile(file, []byte("192.168.1.0/24\n"), 0o644)
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.DropQueryIPFile = file
+	config.Filtering.WatchFiles = true
+
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := filtering.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer filtering.Reset()
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "10.0.0.1"
+	if result, _ := filtering.dropQueryIPFilter(&dm); result != ReturnKeep {
+		t.Errorf("dns query should not be dropped before the reload")
+	}
+
+	// replace the file like a download tool
+	tmp := file + ".tmp"
+	os.WriteFile(tmp, []byte("192.168.1.0/24\n10.0.0.0/8\n"), 0o644)
+	os.Rename(tmp, file)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if result, _ := filtering.dropQueryIPFilter(&dm); result == ReturnDrop {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("list not reloaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if filtering.dropQueryIPs.reloads.Load() == 0 {
+		t.Errorf("reload not counted")
+	}
+}
+
+func TestFiltering_Metrics(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.DropQueryIPFile = "../tests/testsdata/filtering_queryip.txt"
+	config.Filtering.DropFqdnFile = "../tests/testsdata/filtering_fqdn.txt"
+	config.Filtering.WatchFiles = false
+
+	filtering := NewFilteringTransform(config, logger.New(false), "metrics", 1, []chan dnsutils.DNSMessage{})
+	if _, err := filtering.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer filtering.Reset()
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "192.168.1.15"
+	dm.DNS.Qname = testURL1
+	filtering.dropQueryIPFilter(&dm)
+	filtering.dropQueryIPFilter(&dm)
+	filtering.dropFqdnFilter(&dm)
+
+	// collect the metrics of the transform
+	values := make(map[string]float64)
+	ch := make(chan prometheus.Metric, 100)
+	filteringMetrics.Collect(ch)
+	close(ch)
+	for metric := range ch {
+		m := &dto.Metric{}
+		metric.Write(m)
+		labels := make(map[string]string)
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["worker"] != "metrics" || labels["instance"] != "1" {
+			continue
+		}
+		switch metric.Desc() {
+		case filteringMetrics.entries:
+			values["entries:"+labels["list"]] = m.GetGauge().GetValue()
+		case filteringMetrics.hits:
+			values["hits:"+labels["list"]] = m.GetCounter().GetValue()
+		}
+	}
+
+	want := map[string]float64{
+		"entries:drop-queryip-file": 4,
+		"entries:drop-fqdn-file":    2,
+		"hits:drop-queryip-file":    2,
+		"hits:drop-fqdn-file":       1,
+	}
+	for k, v := range want {
+		if values[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, values[k])
+		}
+	}
+
+	// no more metrics after the reset
+	filtering.Reset()
+	ch = make(chan prometheus.Metric, 100)
+	filteringMetrics.Collect(ch)
+	close(ch)
+	for metric := range ch {
+		m := &dto.Metric{}
+		metric.Write(m)
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "worker" && label.GetValue() == "metrics" {
+				t.Fatalf("metrics not removed after reset")
+			}
+		}
+	}
+}
+
+func TestFiltering_MetricsPrefix(t *testing.T) {
+	collector := NewFilteringCollector()
+	collector.SetPrefix("custom")
+
+	ch := make(chan *prometheus.Desc, 10)
+	collector.Describe(ch)
+	close(ch)
+	for desc := range ch {
+		if !strings.Contains(desc.String(), `fqName: "custom_filtering_list_`) {
+			t.Errorf("invalid metric name: %s", desc)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package transformers
 import (
 	"fmt"
 	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
@@ -22,17 +24,47 @@ type MaxminddbRecord struct {
 	City struct {
 		Names map[string]string `maxminddb:"names"`
 	} `maxminddb:"city"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
 	AutonomousSystemNumber       int    `maxminddb:"autonomous_system_number"`
 	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+	ISP                          string `maxminddb:"isp"`
+	Organization                 string `maxminddb:"organization"`
+	IsAnonymous                  bool   `maxminddb:"is_anonymous"`
+	IsAnonymousVPN               bool   `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider            bool   `maxminddb:"is_hosting_provider"`
+	IsPublicProxy                bool   `maxminddb:"is_public_proxy"`
+	IsTorExitNode                bool   `maxminddb:"is_tor_exit_node"`
 }
 
 type GeoRecord struct {
-	Continent, CountryISOCode, City, ASN, ASO string
+	Continent, CountryISOCode, City, ASN, ASO        string
+	Subdivision, PostalCode, TimeZone, ISP, Org      string
+	Latitude, Longitude                              float64
+	Anonymous, AnonymousVPN, Hosting, Proxy, TorExit bool
+}
+
+// database file and the reader to replace on reload
+type geoDatabase struct {
+	name   string
+	file   string
+	reader **maxminddb.Reader
 }
 
 type GeoIPTransform struct {
 	GenericTransformer
-	dbCountry, dbCity, dbAsn *maxminddb.Reader
+	sync.RWMutex
+	dbCountry, dbCity, dbAsn, dbAnonymousIP, dbISP *maxminddb.Reader
+	watcher                                        *FileWatcher
 }
 
 func NewDNSGeoIPTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *GeoIPTransform {
@@ -41,72 +73,136 @@ func NewDNSGeoIPTransform(config *pkgconfig.ConfigTransformers, logger *logger.L
 }
 
 func (t *GeoIPTransform) GetTransforms() ([]Subtransform, error) {
+	t.stopWatcher()
+
 	subtransforms := []Subtransform{}
 	if t.config.GeoIP.Enable {
 		if err := t.Open(); err != nil {
 			return nil, fmt.Errorf("open error %w", err)
 		}
+		if t.config.GeoIP.WatchFiles {
+			if err := t.startWatcher(); err != nil {
+				return nil, err
+			}
+		}
 		subtransforms = append(subtransforms, Subtransform{name: "geoip:lookup", processFunc: t.geoipTransform})
 	}
 	return subtransforms, nil
 }
 
 func (t *GeoIPTransform) Reset() {
+	t.stopWatcher()
 	if t.config.GeoIP.Enable {
 		t.Close()
 	}
 }
 
+func (t *GeoIPTransform) databases() []geoDatabase {
+	return []geoDatabase{
+		{name: "country", file: t.config.GeoIP.DBCountryFile, reader: &t.dbCountry},
+		{name: "city", file: t.config.GeoIP.DBCityFile, reader: &t.dbCity},
+		{name: "asn", file: t.config.GeoIP.DBASNFile, reader: &t.dbAsn},
+		{name: "anonymous-ip", file: t.config.GeoIP.DBAnonymousIPFile, reader: &t.dbAnonymousIP},
+		{name: "isp", file: t.config.GeoIP.DBISPFile, reader: &t.dbISP},
+	}
+}
+
 func (t *GeoIPTransform) Open() (err error) {
 	// before to open, close all files
 	// because open can be called also on reload
 	t.Close()
 
+	t.Lock()
+	defer t.Unlock()
+
 	// open files ?
-	if len(t.config.GeoIP.DBCountryFile) > 0 {
-		t.dbCountry, err = maxminddb.Open(t.config.GeoIP.DBCountryFile)
+	for _, db := range t.databases() {
+		if len(db.file) == 0 {
+			continue
+		}
+		*db.reader, err = maxminddb.Open(db.file)
 		if err != nil {
 			return err
 		}
-		t.LogInfo("country database loaded (%d records)", t.dbCountry.Metadata.NodeCount)
+		t.LogInfo("%s database loaded (%d records)", db.name, (*db.reader).Metadata.NodeCount)
 	}
+	return nil
+}
 
-	if len(t.config.GeoIP.DBCityFile) > 0 {
-		t.dbCity, err = maxminddb.Open(t.config.GeoIP.DBCityFile)
-		if err != nil {
-			return err
+func (t *GeoIPTransform) Close() {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, db := range t.databases() {
+		if *db.reader != nil {
+			(*db.reader).Close()
+			*db.reader = nil
 		}
-		t.LogInfo("city database loaded (%d records)", t.dbCity.Metadata.NodeCount)
 	}
+}
 
-	if len(t.config.GeoIP.DBASNFile) > 0 {
-		t.dbAsn, err = maxminddb.Open(t.config.GeoIP.DBASNFile)
-		if err != nil {
-			return err
+func (t *GeoIPTransform) startWatcher() error {
+	databases := []geoDatabase{}
+	files := []string{}
+	for _, db := range t.databases() {
+		if len(db.file) > 0 {
+			databases = append(databases, db)
+			files = append(files, db.file)
 		}
-		t.LogInfo("asn database loaded (%d records)", t.dbAsn.Metadata.NodeCount)
 	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	watcher, err := NewFileWatcher(files, func(file string) { t.reloadDatabase(databases, file) },
+		func(err error) { t.LogError("watcher error: %v", err) })
+	if err != nil {
+		return err
+	}
+	t.watcher = watcher
 	return nil
 }
 
-func (t *GeoIPTransform) Close() {
-	if t.dbCountry != nil {
-		t.dbCountry.Close()
+func (t *GeoIPTransform) stopWatcher() {
+	if t.watcher != nil {
+		t.watcher.Stop()
+		t.watcher = nil
 	}
-	if t.dbCity != nil {
-		t.dbCity.Close()
-	}
-	if t.dbAsn != nil {
-		t.dbAsn.Close()
+}
+
+// reloadDatabase replaces the reader when the new file is valid, otherwise the current one is kept
+func (t *GeoIPTransform) reloadDatabase(databases []geoDatabase, file string) {
+	for _, db := range databases {
+		if filepath.Clean(db.file) != file {
+			continue
+		}
+		reader, err := maxminddb.Open(db.file)
+		if err != nil {
+			t.LogError("unable to reload %s database: %v", db.name, err)
+			continue
+		}
+
+		t.Lock()
+		previous := *db.reader
+		*db.reader = reader
+		t.Unlock()
+
+		if previous != nil {
+			previous.Close()
+		}
+		t.LogInfo("%s database reloaded (%d records)", db.name, reader.Metadata.NodeCount)
 	}
 }
 
+// Lookup must be called with the lock held
 func (t *GeoIPTransform) Lookup(ip string) (GeoRecord, error) {
-	record := &MaxminddbRecord{}
-	rec := GeoRecord{Continent: "-", CountryISOCode: "-", City: "-", ASN: "-", ASO: "-"}
+	rec := GeoRecord{Continent: "-", CountryISOCode: "-", City: "-", ASN: "-", ASO: "-",
+		Subdivision: "-", PostalCode: "-", TimeZone: "-", ISP: "-", Org: "-"}
+	addr := net.ParseIP(ip)
 
 	if t.dbAsn != nil {
-		err := t.dbAsn.Lookup(net.ParseIP(ip), &record)
+		record := &MaxminddbRecord{}
+		err := t.dbAsn.Lookup(addr, &record)
 		if err != nil {
 			return rec, err
 		}
@@ -115,28 +211,90 @@ func (t *GeoIPTransform) Lookup(ip string) (GeoRecord, error) {
 	}
 
 	if t.dbCity != nil {
-		err := t.dbCity.Lookup(net.ParseIP(ip), &record)
+		record := &MaxminddbRecord{}
+		err := t.dbCity.Lookup(addr, &record)
 		if err != nil {
 			return rec, err
 		}
 		rec.City = record.City.Names["en"]
 		rec.CountryISOCode = record.Country.ISOCode
 		rec.Continent = record.Continent.Code
+		if len(record.Subdivisions) > 0 {
+			rec.Subdivision = record.Subdivisions[0].ISOCode
+		}
+		if len(record.Postal.Code) > 0 {
+			rec.PostalCode = record.Postal.Code
+		}
+		if len(record.Location.TimeZone) > 0 {
+			rec.TimeZone = record.Location.TimeZone
+		}
+		rec.Latitude = record.Location.Latitude
+		rec.Longitude = record.Location.Longitude
 
 	} else if t.dbCountry != nil {
-		err := t.dbCountry.Lookup(net.ParseIP(ip), &record)
+		record := &MaxminddbRecord{}
+		err := t.dbCountry.Lookup(addr, &record)
 		if err != nil {
 			return rec, err
 		}
 		rec.CountryISOCode = record.Country.ISOCode
 		rec.Continent = record.Continent.Code
 	}
+
+	if t.dbISP != nil {
+		record := &MaxminddbRecord{}
+		err := t.dbISP.Lookup(addr, &record)
+		if err != nil {
+			return rec, err
+		}
+		if len(record.ISP) > 0 {
+			rec.ISP = record.ISP
+		}
+		if len(record.Organization) > 0 {
+			rec.Org = record.Organization
+		}
+		// the isp database also contains the autonomous system
+		if t.dbAsn == nil && record.AutonomousSystemNumber > 0 {
+			rec.ASN = strconv.Itoa(record.AutonomousSystemNumber)
+			rec.ASO = record.AutonomousSystemOrganization
+		}
+	}
+
+	if t.dbAnonymousIP != nil {
+		record := &MaxminddbRecord{}
+		err := t.dbAnonymousIP.Lookup(addr, &record)
+		if err != nil {
+			return rec, err
+		}
+		rec.Anonymous = record.IsAnonymous
+		rec.AnonymousVPN = record.IsAnonymousVPN
+		rec.Hosting = record.IsHostingProvider
+		rec.Proxy = record.IsPublicProxy
+		rec.TorExit = record.IsTorExitNode
+	}
 	return rec, nil
 }
 
+// lookupLocation returns the location of the response ip or an answer
+func (t *GeoIPTransform) lookupLocation(ip string) (*dnsutils.GeoLocation, error) {
+	geoInfo, err := t.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsutils.GeoLocation{
+		IP:                     ip,
+		City:                   geoInfo.City,
+		Continent:              geoInfo.Continent,
+		CountryIsoCode:         geoInfo.CountryISOCode,
+		AutonomousSystemNumber: geoInfo.ASN,
+		AutonomousSystemOrg:    geoInfo.ASO,
+	}, nil
+}
+
 func (t *GeoIPTransform) geoipTransform(dm *dnsutils.DNSMessage) (int, error) {
 	if dm.Geo == nil {
-		dm.Geo = &dnsutils.TransformDNSGeo{CountryIsoCode: "-", City: "-", Continent: "-", AutonomousSystemNumber: "-", AutonomousSystemOrg: "-"}
+		dm.Geo = &dnsutils.TransformDNSGeo{CountryIsoCode: "-", City: "-", Continent: "-", AutonomousSystemNumber: "-", AutonomousSystemOrg: "-",
+			Subdivision: "-", PostalCode: "-", TimeZone: "-", ISP: "-", Organization: "-"}
 	}
 
 	clientIP := dm.NetworkInfo.QueryIP
@@ -149,6 +307,9 @@ func (t *GeoIPTransform) geoipTransform(dm *dnsutils.DNSMessage) (int, error) {
 		}
 	}
 
+	t.RLock()
+	defer t.RUnlock()
+
 	geoInfo, err := t.Lookup(clientIP)
 	if err != nil {
 		return ReturnKeep, err
@@ -159,6 +320,45 @@ func (t *GeoIPTransform) geoipTransform(dm *dnsutils.DNSMessage) (int, error) {
 	dm.Geo.City = geoInfo.City
 	dm.Geo.AutonomousSystemNumber = geoInfo.ASN
 	dm.Geo.AutonomousSystemOrg = geoInfo.ASO
+	dm.Geo.Subdivision = geoInfo.Subdivision
+	dm.Geo.PostalCode = geoInfo.PostalCode
+	dm.Geo.Latitude = geoInfo.Latitude
+	dm.Geo.Longitude = geoInfo.Longitude
+	dm.Geo.TimeZone = geoInfo.TimeZone
+	dm.Geo.ISP = geoInfo.ISP
+	dm.Geo.Organization = geoInfo.Org
+	dm.Geo.Anonymous = geoInfo.Anonymous
+	dm.Geo.AnonymousVPN = geoInfo.AnonymousVPN
+	dm.Geo.HostingProvider = geoInfo.Hosting
+	dm.Geo.PublicProxy = geoInfo.Proxy
+	dm.Geo.TorExitNode = geoInfo.TorExit
+
+	// lookup the server ip
+	if t.config.GeoIP.LookupResponseIP && net.ParseIP(dm.NetworkInfo.ResponseIP) != nil {
+		location, err := t.lookupLocation(dm.NetworkInfo.ResponseIP)
+		if err != nil {
+			return ReturnKeep, err
+		}
+		dm.Geo.ResponseIP = location
+	}
+
+	// lookup the addresses of the answers
+	if t.config.GeoIP.LookupAnswers {
+		dm.Geo.Answers = dm.Geo.Answers[:0]
+		for _, answer := range dm.DNS.DNSRRs.Answers {
+			if answer.Rdatatype != "A" && answer.Rdatatype != "AAAA" {
+				continue
+			}
+			if net.ParseIP(answer.Rdata) == nil {
+				continue
+			}
+			location, err := t.lookupLocation(answer.Rdata)
+			if err != nil {
+				return ReturnKeep, err
+			}
+			dm.Geo.Answers = append(dm.Geo.Answers, *location)
+		}
+	}
 
 	return ReturnKeep, nil
 }
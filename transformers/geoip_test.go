@@ -2,12 +2,18 @@ package transformers
 
 import (
 	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
 	"github.com/stretchr/testify/require"
 )
 
@@ -38,7 +44,19 @@ func TestGeoIP_Json(t *testing.T) {
 					"continent":"-",
 					"country-isocode":"-",
 					"as-number":"-",
-					"as-owner":"-"
+					"as-owner":"-",
+					"subdivision":"-",
+					"postal-code":"-",
+					"latitude":0,
+					"longitude":0,
+					"timezone":"-",
+					"isp":"-",
+					"organization":"-",
+					"anonymous":false,
+					"anonymous-vpn":false,
+					"hosting-provider":false,
+					"public-proxy":false,
+					"tor-exit-node":false
 				}
 			}
 			`
@@ -157,3 +175,154 @@ func TestGeoIP_Lookup_ECS(t *testing.T) {
 	// Ensure the return code is ReturnKeep
 	require.Equal(t, ReturnKeep, returnCode, "unexpected return code")
 }
+
+// writeTestMMDB generates a database with the records indexed by cidr
+func writeTestMMDB(t *testing.T, file, dbType string, records map[string]mmdbtype.Map) {
+	writer, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType, RecordSize: 24})
+	require.NoError(t, err)
+	for cidr, record := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		require.NoError(t, writer.Insert(network, record))
+	}
+
+	// write then rename, like the update tools
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	require.NoError(t, err)
+	_, err = writer.WriteTo(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Rename(tmp, file))
+}
+
+func testCityRecord(country, city string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"continent":    mmdbtype.Map{"code": mmdbtype.String("EU")},
+		"country":      mmdbtype.Map{"iso_code": mmdbtype.String(country)},
+		"city":         mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(city)}},
+		"subdivisions": mmdbtype.Slice{mmdbtype.Map{"iso_code": mmdbtype.String("IDF")}},
+		"postal":       mmdbtype.Map{"code": mmdbtype.String("75001")},
+		"location": mmdbtype.Map{
+			"latitude":  mmdbtype.Float64(48.86),
+			"longitude": mmdbtype.Float64(2.34),
+			"time_zone": mmdbtype.String("Europe/Paris"),
+		},
+	}
+}
+
+func TestGeoIP_CityIspAnonymous(t *testing.T) {
+	dir := t.TempDir()
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.GeoIP.Enable = true
+	config.GeoIP.WatchFiles = false
+	config.GeoIP.DBCityFile = filepath.Join(dir, "city.mmdb")
+	config.GeoIP.DBISPFile = filepath.Join(dir, "isp.mmdb")
+	config.GeoIP.DBAnonymousIPFile = filepath.Join(dir, "anonymous.mmdb")
+	config.GeoIP.LookupResponseIP = true
+	config.GeoIP.LookupAnswers = true
+
+	writeTestMMDB(t, config.GeoIP.DBCityFile, "GeoIP2-City", map[string]mmdbtype.Map{
+		"81.0.0.0/8": testCityRecord("FR", "Paris"),
+		"8.8.8.0/24": testCityRecord("US", "Mountain View"),
+	})
+	writeTestMMDB(t, config.GeoIP.DBISPFile, "GeoIP2-ISP", map[string]mmdbtype.Map{
+		"81.0.0.0/8": {
+			"isp":                            mmdbtype.String("Orange"),
+			"organization":                   mmdbtype.String("Orange Business"),
+			"autonomous_system_number":       mmdbtype.Uint32(3215),
+			"autonomous_system_organization": mmdbtype.String("Orange"),
+		},
+	})
+	writeTestMMDB(t, config.GeoIP.DBAnonymousIPFile, "GeoIP2-Anonymous-IP", map[string]mmdbtype.Map{
+		"81.1.0.0/16": {
+			"is_anonymous":     mmdbtype.Bool(true),
+			"is_anonymous_vpn": mmdbtype.Bool(true),
+		},
+	})
+
+	geoip := NewDNSGeoIPTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	_, err := geoip.GetTransforms()
+	require.NoError(t, err)
+	defer geoip.Reset()
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "81.1.2.3"
+	dm.NetworkInfo.ResponseIP = "8.8.8.8"
+	dm.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{
+		{Name: dm.DNS.Qname, Rdatatype: "CNAME", Rdata: "cdn.example.com"},
+		{Name: "cdn.example.com", Rdatatype: "A", Rdata: "81.2.3.4"},
+		{Name: "cdn.example.com", Rdatatype: "A", Rdata: "192.0.2.1"},
+	}
+
+	returnCode, err := geoip.geoipTransform(&dm)
+	require.NoError(t, err)
+	require.Equal(t, ReturnKeep, returnCode)
+
+	// client
+	require.Equal(t, "FR", dm.Geo.CountryIsoCode)
+	require.Equal(t, "Paris", dm.Geo.City)
+	require.Equal(t, "IDF", dm.Geo.Subdivision)
+	require.Equal(t, "75001", dm.Geo.PostalCode)
+	require.Equal(t, "Europe/Paris", dm.Geo.TimeZone)
+	require.InDelta(t, 48.86, dm.Geo.Latitude, 0.001)
+	require.InDelta(t, 2.34, dm.Geo.Longitude, 0.001)
+	require.Equal(t, "Orange", dm.Geo.ISP)
+	require.Equal(t, "Orange Business", dm.Geo.Organization)
+	require.Equal(t, "3215", dm.Geo.AutonomousSystemNumber)
+	require.True(t, dm.Geo.Anonymous)
+	require.True(t, dm.Geo.AnonymousVPN)
+	require.False(t, dm.Geo.TorExitNode)
+
+	// server
+	require.NotNil(t, dm.Geo.ResponseIP)
+	require.Equal(t, "8.8.8.8", dm.Geo.ResponseIP.IP)
+	require.Equal(t, "US", dm.Geo.ResponseIP.CountryIsoCode)
+	require.Equal(t, "-", dm.Geo.ResponseIP.AutonomousSystemNumber)
+
+	// answers, the cname is ignored
+	require.Len(t, dm.Geo.Answers, 2)
+	require.Equal(t, "81.2.3.4", dm.Geo.Answers[0].IP)
+	require.Equal(t, "FR", dm.Geo.Answers[0].CountryIsoCode)
+	require.Equal(t, "3215", dm.Geo.Answers[0].AutonomousSystemNumber)
+	require.Equal(t, "192.0.2.1", dm.Geo.Answers[1].IP)
+	require.Equal(t, "", dm.Geo.Answers[1].CountryIsoCode)
+}
+
+func TestGeoIP_Reload(t *testing.T) {
+	dir := t.TempDir()
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.GeoIP.Enable = true
+	config.GeoIP.WatchFiles = true
+	config.GeoIP.DBCityFile = filepath.Join(dir, "city.mmdb")
+
+	writeTestMMDB(t, config.GeoIP.DBCityFile, "GeoIP2-City", map[string]mmdbtype.Map{
+		"81.0.0.0/8": testCityRecord("FR", "Paris"),
+	})
+
+	geoip := NewDNSGeoIPTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	_, err := geoip.GetTransforms()
+	require.NoError(t, err)
+	defer geoip.Reset()
+
+	lookup := func() string {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.NetworkInfo.QueryIP = "81.1.2.3"
+		_, err := geoip.geoipTransform(&dm)
+		require.NoError(t, err)
+		return dm.Geo.CountryIsoCode
+	}
+	require.Equal(t, "FR", lookup())
+
+	// invalid file, the current database is kept
+	require.NoError(t, os.WriteFile(config.GeoIP.DBCityFile+".tmp", []byte("invalid"), 0o644))
+	require.NoError(t, os.Rename(config.GeoIP.DBCityFile+".tmp", config.GeoIP.DBCityFile))
+	time.Sleep(2 * fileWatcherDelay)
+	require.Equal(t, "FR", lookup())
+
+	// new database
+	writeTestMMDB(t, config.GeoIP.DBCityFile, "GeoIP2-City", map[string]mmdbtype.Map{
+		"81.0.0.0/8": testCityRecord("BE", "Brussels"),
+	})
+	require.Eventually(t, func() bool { return lookup() == "BE" }, 5*time.Second, 50*time.Millisecond)
+}
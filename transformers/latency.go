@@ -12,23 +12,30 @@ import (
 	"github.com/dmachard/go-logger"
 )
 
-// queries map
+// queries map, the eviction callback is called for each query not popped before the ttl
+type queryEntry struct {
+	dm    dnsutils.DNSMessage
+	timer *time.Timer
+}
+
 type MapQueries struct {
 	sync.RWMutex
-	ttl      time.Duration
-	kv       map[uint64]dnsutils.DNSMessage
-	channels []chan dnsutils.DNSMessage
+	ttl     time.Duration
+	kv      map[uint64]*queryEntry
+	onEvict func(dm dnsutils.DNSMessage)
 }
 
-func NewMapQueries(ttl time.Duration, channels []chan dnsutils.DNSMessage) MapQueries {
+func NewMapQueries(ttl time.Duration, onEvict func(dm dnsutils.DNSMessage)) MapQueries {
 	return MapQueries{
-		ttl:      ttl,
-		kv:       make(map[uint64]dnsutils.DNSMessage),
-		channels: channels,
+		ttl:     ttl,
+		kv:      make(map[uint64]*queryEntry),
+		onEvict: onEvict,
 	}
 }
 
 func (mp *MapQueries) SetTTL(ttl time.Duration) {
+	mp.Lock()
+	defer mp.Unlock()
 	mp.ttl = ttl
 }
 
@@ -42,22 +49,45 @@ func (mp *MapQueries) Exists(key uint64) (ok bool) {
 func (mp *MapQueries) Set(key uint64, dm dnsutils.DNSMessage) {
 	mp.Lock()
 	defer mp.Unlock()
-	mp.kv[key] = dm
-	time.AfterFunc(mp.ttl, func() {
-		if mp.Exists(key) {
-			dm.DNS.Rcode = "TIMEOUT"
-			for i := range mp.channels {
-				mp.channels[i] <- dm
-			}
+
+	// a retransmitted query replaces the previous one
+	if prev, ok := mp.kv[key]; ok {
+		prev.timer.Stop()
+	}
+
+	entry := &queryEntry{dm: dm}
+	entry.timer = time.AfterFunc(mp.ttl, func() {
+		mp.Lock()
+		current, ok := mp.kv[key]
+		if !ok || current != entry {
+			mp.Unlock()
+			return
+		}
+		delete(mp.kv, key)
+		mp.Unlock()
+
+		if mp.onEvict != nil {
+			mp.onEvict(entry.dm)
 		}
-		mp.Delete(key)
 	})
+	mp.kv[key] = entry
 }
 
-func (mp *MapQueries) Delete(key uint64) {
+// Pop removes the query from the map and returns it
+func (mp *MapQueries) Pop(key uint64) (dnsutils.DNSMessage, bool) {
 	mp.Lock()
 	defer mp.Unlock()
+	entry, ok := mp.kv[key]
+	if !ok {
+		return dnsutils.DNSMessage{}, false
+	}
+	entry.timer.Stop()
 	delete(mp.kv, key)
+	return entry.dm, true
+}
+
+func (mp *MapQueries) Delete(key uint64) {
+	mp.Pop(key)
 }
 
 // hash queries map
@@ -100,23 +130,161 @@ func (mp *HashQueries) Delete(key uint64) {
 	delete(mp.kv, key)
 }
 
+// upstream queries, resolver queries are attributed to the pending client queries
+// with the same qname/qtype received before and within the ttl
+type upstreamStats struct {
+	name       string
+	timestamp  int64
+	queries    int
+	roundTrips int
+	latency    int64
+}
+
+type upstreamQuery struct {
+	name      string
+	timestamp int64
+}
+
+type UpstreamQueries struct {
+	sync.Mutex
+	ttl       time.Duration
+	clients   map[uint64]*upstreamStats
+	byName    map[string]map[uint64]*upstreamStats
+	upstreams map[uint64]upstreamQuery
+}
+
+func NewUpstreamQueries(ttl time.Duration) UpstreamQueries {
+	return UpstreamQueries{
+		ttl:       ttl,
+		clients:   make(map[uint64]*upstreamStats),
+		byName:    make(map[string]map[uint64]*upstreamStats),
+		upstreams: make(map[uint64]upstreamQuery),
+	}
+}
+
+func (mp *UpstreamQueries) SetTTL(ttl time.Duration) {
+	mp.Lock()
+	defer mp.Unlock()
+	mp.ttl = ttl
+}
+
+// pending returns the client queries waiting for the name at the given time
+func (mp *UpstreamQueries) pending(name string, timestamp int64) []*upstreamStats {
+	stats := []*upstreamStats{}
+	for _, client := range mp.byName[name] {
+		if timestamp >= client.timestamp && timestamp-client.timestamp <= mp.ttl.Nanoseconds() {
+			stats = append(stats, client)
+		}
+	}
+	return stats
+}
+
+func (mp *UpstreamQueries) SetClient(key uint64, name string, timestamp int64) {
+	mp.Lock()
+	defer mp.Unlock()
+	mp.removeClient(key)
+
+	client := &upstreamStats{name: name, timestamp: timestamp}
+	mp.clients[key] = client
+	if _, ok := mp.byName[name]; !ok {
+		mp.byName[name] = make(map[uint64]*upstreamStats)
+	}
+	mp.byName[name][key] = client
+
+	time.AfterFunc(mp.ttl, func() {
+		mp.Lock()
+		defer mp.Unlock()
+		if mp.clients[key] == client {
+			mp.removeClient(key)
+		}
+	})
+}
+
+// PopClient removes the client query and returns the upstream stats
+func (mp *UpstreamQueries) PopClient(key uint64) (upstreamStats, bool) {
+	mp.Lock()
+	defer mp.Unlock()
+	client, ok := mp.clients[key]
+	if !ok {
+		return upstreamStats{}, false
+	}
+	mp.removeClient(key)
+	return *client, true
+}
+
+func (mp *UpstreamQueries) removeClient(key uint64) {
+	client, ok := mp.clients[key]
+	if !ok {
+		return
+	}
+	delete(mp.clients, key)
+	delete(mp.byName[client.name], key)
+	if len(mp.byName[client.name]) == 0 {
+		delete(mp.byName, client.name)
+	}
+}
+
+func (mp *UpstreamQueries) SetUpstream(key uint64, name string, timestamp int64) {
+	mp.Lock()
+	defer mp.Unlock()
+	for _, client := range mp.pending(name, timestamp) {
+		client.queries++
+	}
+
+	query := upstreamQuery{name: name, timestamp: timestamp}
+	mp.upstreams[key] = query
+	time.AfterFunc(mp.ttl, func() {
+		mp.Lock()
+		defer mp.Unlock()
+		if mp.upstreams[key] == query {
+			delete(mp.upstreams, key)
+		}
+	})
+}
+
+func (mp *UpstreamQueries) SetUpstreamReply(key uint64, timestamp int64) {
+	mp.Lock()
+	defer mp.Unlock()
+	query, ok := mp.upstreams[key]
+	if !ok {
+		return
+	}
+	delete(mp.upstreams, key)
+
+	for _, client := range mp.pending(query.name, query.timestamp) {
+		client.roundTrips++
+		client.latency += timestamp - query.timestamp
+	}
+}
+
 // latency transformer
 type LatencyTransform struct {
 	GenericTransformer
-	hashQueries HashQueries
-	mapQueries  MapQueries
+	hashQueries     HashQueries
+	mapQueries      MapQueries
+	upstreamQueries UpstreamQueries
 }
 
 func NewLatencyTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *LatencyTransform {
 	t := &LatencyTransform{GenericTransformer: NewTransformer(config, logger, "latency", name, instance, nextWorkers)}
 	t.hashQueries = NewHashQueries(time.Duration(config.Latency.QueriesTimeout) * time.Second)
-	t.mapQueries = NewMapQueries(time.Duration(config.Latency.QueriesTimeout)*time.Second, nextWorkers)
+	t.mapQueries = NewMapQueries(time.Duration(config.Latency.QueriesTimeout)*time.Second, t.sendTimeout)
+	t.upstreamQueries = NewUpstreamQueries(time.Duration(config.Latency.QueriesTimeout) * time.Second)
 	return t
 }
 
+// sendTimeout forwards the unanswered query to the next workers
+func (t *LatencyTransform) sendTimeout(dm dnsutils.DNSMessage) {
+	dm.DNS.Rcode = dnsutils.DNSRcodeTimeout
+	for i := range t.nextWorkers {
+		t.nextWorkers[i] <- dm
+	}
+}
+
 func (t *LatencyTransform) GetTransforms() ([]Subtransform, error) {
 	t.hashQueries.SetTTL(time.Duration(t.config.Latency.QueriesTimeout) * time.Second)
 	t.mapQueries.SetTTL(time.Duration(t.config.Latency.QueriesTimeout) * time.Second)
+	t.upstreamQueries.SetTTL(time.Duration(t.config.Latency.QueriesTimeout) * time.Second)
 
 	subtransforms := []Subtransform{}
 	if t.config.Latency.MeasureLatency {
@@ -125,6 +293,9 @@ func (t *LatencyTransform) GetTransforms() ([]Subtransform, error) {
 	if t.config.Latency.UnansweredQueries {
 		subtransforms = append(subtransforms, Subtransform{name: "latency:timeout", processFunc: t.detectEvictedTimeout})
 	}
+	if t.config.Latency.UpstreamQueries {
+		subtransforms = append(subtransforms, Subtransform{name: "latency:upstream", processFunc: t.measureUpstream})
+	}
 	return subtransforms, nil
 }
 
@@ -166,9 +337,53 @@ func (t *LatencyTransform) detectEvictedTimeout(dm *dnsutils.DNSMessage) (int, e
 
 		if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
 			t.mapQueries.Set(key, *dm)
-		} else if t.mapQueries.Exists(key) {
+		} else {
 			t.mapQueries.Delete(key)
 		}
 	}
 	return ReturnKeep, nil
 }
+
+func (t *LatencyTransform) measureUpstream(dm *dnsutils.DNSMessage) (int, error) {
+	queryport, _ := strconv.Atoi(dm.NetworkInfo.QueryPort)
+	if len(dm.NetworkInfo.QueryIP) == 0 || queryport == 0 || dm.DNS.MalformedPacket {
+		return ReturnKeep, nil
+	}
+
+	// compute the hash of the query
+	hashData := []string{dm.NetworkInfo.QueryIP, dm.NetworkInfo.QueryPort, strconv.Itoa(dm.DNS.ID)}
+	hashfnv := fnv.New64a()
+	hashfnv.Write([]byte(strings.Join(hashData, "+")))
+	key := hashfnv.Sum64()
+
+	name := strings.ToLower(strings.TrimSuffix(dm.DNS.Qname, ".")) + "/" + dm.DNS.Qtype
+
+	switch dm.DNSTap.Operation {
+	case dnsutils.DNSTapClientQuery:
+		t.upstreamQueries.SetClient(key, name, dm.DNSTap.Timestamp)
+
+	case dnsutils.DNSTapResolverQuery, dnsutils.DNSTapForwarderQuery:
+		t.upstreamQueries.SetUpstream(key, name, dm.DNSTap.Timestamp)
+
+	case dnsutils.DNSTapResolverResponse, dnsutils.DNSTapForwarderResponse:
+		t.upstreamQueries.SetUpstreamReply(key, dm.DNSTap.Timestamp)
+
+	case dnsutils.DNSTapClientResponse:
+		stats, ok := t.upstreamQueries.PopClient(key)
+		if !ok {
+			break
+		}
+		if dm.Upstream == nil {
+			dm.Upstream = &dnsutils.TransformUpstream{}
+		}
+		dm.Upstream.Queries = stats.queries
+		dm.Upstream.RoundTrips = stats.roundTrips
+		dm.Upstream.Latency = float64(stats.latency) / float64(1000000000)
+		dm.Upstream.LatencyMs = int(dm.Upstream.Latency * 1000)
+		dm.Upstream.Cache = dnsutils.UpstreamCacheHit
+		if stats.queries > 0 {
+			dm.Upstream.Cache = dnsutils.UpstreamCacheMiss
+		}
+	}
+	return ReturnKeep, nil
+}
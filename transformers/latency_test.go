@@ -117,6 +117,69 @@ func TestLatency_DetectEvictedTimeout(t *testing.T) {
 	}
 }
 
+func TestLatency_MeasureUpstream(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Latency.UpstreamQueries = true
+
+	latency := NewLatencyTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	latency.GetTransforms()
+
+	newMessage := func(operation, ip, port string, id int, ts int64) dnsutils.DNSMessage {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNSTap.Operation = operation
+		dm.DNSTap.Timestamp = ts
+		dm.NetworkInfo.QueryIP = ip
+		dm.NetworkInfo.QueryPort = port
+		dm.DNS.ID = id
+		return dm
+	}
+
+	t.Run("cache_miss", func(t *testing.T) {
+		CQ := newMessage(dnsutils.DNSTapClientQuery, "10.0.0.1", "5353", 1, 1000000000)
+		latency.measureUpstream(&CQ)
+
+		// two round trips to the upstream servers
+		RQ1 := newMessage(dnsutils.DNSTapResolverQuery, "10.0.0.254", "40001", 10, 1001000000)
+		RR1 := newMessage(dnsutils.DNSTapResolverResponse, "10.0.0.254", "40001", 10, 1011000000)
+		RQ2 := newMessage(dnsutils.DNSTapResolverQuery, "10.0.0.254", "40002", 11, 1012000000)
+		RR2 := newMessage(dnsutils.DNSTapResolverResponse, "10.0.0.254", "40002", 11, 1032000000)
+		for _, dm := range []*dnsutils.DNSMessage{&RQ1, &RR1, &RQ2, &RR2} {
+			latency.measureUpstream(dm)
+		}
+
+		CR := newMessage(dnsutils.DNSTapClientResponse, "10.0.0.1", "5353", 1, 1033000000)
+		latency.measureUpstream(&CR)
+
+		if CR.Upstream.Cache != dnsutils.UpstreamCacheMiss {
+			t.Errorf("want cache %s, got %s", dnsutils.UpstreamCacheMiss, CR.Upstream.Cache)
+		}
+		if CR.Upstream.Queries != 2 || CR.Upstream.RoundTrips != 2 {
+			t.Errorf("want 2 queries and round trips, got %d/%d", CR.Upstream.Queries, CR.Upstream.RoundTrips)
+		}
+		if CR.Upstream.LatencyMs != 30 {
+			t.Errorf("want upstream latency 30ms, got %d", CR.Upstream.LatencyMs)
+		}
+	})
+
+	t.Run("cache_hit", func(t *testing.T) {
+		CQ := newMessage(dnsutils.DNSTapClientQuery, "10.0.0.2", "5353", 2, 2000000000)
+		latency.measureUpstream(&CQ)
+
+		// upstream query for another name
+		RQ := newMessage(dnsutils.DNSTapResolverQuery, "10.0.0.254", "40003", 12, 2001000000)
+		RQ.DNS.Qname = "other.collector"
+		latency.measureUpstream(&RQ)
+
+		CR := newMessage(dnsutils.DNSTapClientResponse, "10.0.0.2", "5353", 2, 2002000000)
+		latency.measureUpstream(&CR)
+
+		if CR.Upstream.Cache != dnsutils.UpstreamCacheHit || CR.Upstream.Queries != 0 {
+			t.Errorf("want cache hit without upstream queries, got %s/%d", CR.Upstream.Cache, CR.Upstream.Queries)
+		}
+	})
+}
+
 func Test_HashQueries(t *testing.T) {
 	// init map
 	mapttl := NewHashQueries(2 * time.Second)
@@ -0,0 +1,308 @@
+package transformers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"inet.af/netaddr"
+)
+
+// LookupIndex contains the rows of a table indexed by CIDR or domain
+type LookupIndex struct {
+	table    pkgconfig.LookupTable
+	prefixes *IPRadixTree[map[string]string]
+	domains  map[string]map[string]string
+}
+
+func NewLookupIndex(table pkgconfig.LookupTable) *LookupIndex {
+	return &LookupIndex{
+		table:    table,
+		prefixes: NewIPRadixTree[map[string]string](),
+		domains:  make(map[string]map[string]string),
+	}
+}
+
+func (idx *LookupIndex) Add(key string, row map[string]string) error {
+	switch idx.table.Type {
+	case dnsutils.LookupTypeCIDR:
+		prefix, err := parseIPOrPrefix(key)
+		if err != nil {
+			return err
+		}
+		idx.prefixes.Insert(prefix, row)
+	default:
+		idx.domains[strings.ToLower(strings.TrimSuffix(key, "."))] = row
+	}
+	return nil
+}
+
+// Match returns the row of the longest prefix containing the ip, or the row of the domain,
+// the parent domains are also checked with the domain-suffix type
+func (idx *LookupIndex) Match(value string) (map[string]string, bool) {
+	switch idx.table.Type {
+	case dnsutils.LookupTypeCIDR:
+		ip, err := netaddr.ParseIP(value)
+		if err != nil {
+			return nil, false
+		}
+		return idx.prefixes.Lookup(ip)
+	case dnsutils.LookupTypeDomain:
+		row, ok := idx.domains[strings.ToLower(strings.TrimSuffix(value, "."))]
+		return row, ok
+	default:
+		domain := strings.ToLower(strings.TrimSuffix(value, "."))
+		for len(domain) > 0 {
+			if row, ok := idx.domains[domain]; ok {
+				return row, true
+			}
+			_, domain, _ = strings.Cut(domain, ".")
+		}
+		return nil, false
+	}
+}
+
+func (idx *LookupIndex) Len() int {
+	return idx.prefixes.Len() + len(idx.domains)
+}
+
+// ValidateLookupTable checks the table and sets the default field to match
+func ValidateLookupTable(table *pkgconfig.LookupTable) error {
+	if len(table.File) == 0 || len(table.Key) == 0 {
+		return fmt.Errorf("table %s: file and key are required", table.Name)
+	}
+	if table.Format != dnsutils.LookupFormatCSV && table.Format != dnsutils.LookupFormatJSON {
+		return fmt.Errorf("table %s: invalid format %s", table.Name, table.Format)
+	}
+	switch table.Type {
+	case dnsutils.LookupTypeCIDR:
+		if len(table.Field) == 0 {
+			table.Field = "network.query-ip"
+		}
+	case dnsutils.LookupTypeDomain, dnsutils.LookupTypeDomainSuffix:
+		if len(table.Field) == 0 {
+			table.Field = "dns.qname"
+		}
+	default:
+		return fmt.Errorf("table %s: invalid type %s", table.Name, table.Type)
+	}
+	return nil
+}
+
+// LoadLookupTable reads the file of the table, the key column is not copied in the rows
+func LoadLookupTable(table pkgconfig.LookupTable) (*LookupIndex, error) {
+	data, err := os.ReadFile(table.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	if table.Format == dnsutils.LookupFormatJSON {
+		rows, err = readJSONRows(data)
+	} else {
+		rows, err = readCSVRows(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := NewLookupIndex(table)
+	for i, row := range rows {
+		key := row[table.Key]
+		if len(key) == 0 {
+			return nil, fmt.Errorf("row %d: missing key %s", i+1, table.Key)
+		}
+
+		values := make(map[string]string)
+		if len(table.Columns) > 0 {
+			for _, column := range table.Columns {
+				if value, ok := row[column]; ok {
+					values[column] = value
+				}
+			}
+		} else {
+			for column, value := range row {
+				if column != table.Key {
+					values[column] = value
+				}
+			}
+		}
+
+		if err := index.Add(key, values); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	return index, nil
+}
+
+// CSV files with a header, comments start with #
+func readCSVRows(data []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			row[column] = strings.TrimSpace(record[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// JSON files with a list of objects
+func readJSONRows(data []byte) ([]map[string]string, error) {
+	objects := []map[string]interface{}{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		row := make(map[string]string, len(object))
+		for column, value := range object {
+			if value != nil {
+				row[column] = fmt.Sprintf("%v", value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// lookup transformer
+type LookupTransform struct {
+	GenericTransformer
+	sync.RWMutex
+	indexes []*LookupIndex
+	watcher *FileWatcher
+}
+
+func NewLookupTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *LookupTransform {
+	t := &LookupTransform{GenericTransformer: NewTransformer(config, logger, "lookup", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *LookupTransform) GetTransforms() ([]Subtransform, error) {
+	t.stopWatcher()
+
+	subtransforms := []Subtransform{}
+	if !t.config.Lookup.Enable {
+		return subtransforms, nil
+	}
+
+	tables := make([]pkgconfig.LookupTable, len(t.config.Lookup.Tables))
+	indexes := make([]*LookupIndex, len(tables))
+	for i, table := range t.config.Lookup.Tables {
+		if err := ValidateLookupTable(&table); err != nil {
+			return nil, err
+		}
+		index, err := LoadLookupTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load table %s: %w", table.Name, err)
+		}
+		t.LogInfo("table %s loaded with %d entries", table.Name, index.Len())
+		tables[i] = table
+		indexes[i] = index
+	}
+
+	t.Lock()
+	t.indexes = indexes
+	t.Unlock()
+
+	if t.config.Lookup.WatchFiles {
+		if err := t.startWatcher(tables); err != nil {
+			return nil, err
+		}
+	}
+
+	subtransforms = append(subtransforms, Subtransform{name: "lookup:enrich", processFunc: t.enrich})
+	return subtransforms, nil
+}
+
+func (t *LookupTransform) Reset() {
+	t.stopWatcher()
+}
+
+func (t *LookupTransform) stopWatcher() {
+	if t.watcher != nil {
+		t.watcher.Stop()
+		t.watcher = nil
+	}
+}
+
+func (t *LookupTransform) startWatcher(tables []pkgconfig.LookupTable) error {
+	files := []string{}
+	for _, table := range tables {
+		files = append(files, table.File)
+	}
+
+	watcher, err := NewFileWatcher(files, func(file string) { t.reloadTables(tables, file) },
+		func(err error) { t.LogError("watcher error: %v", err) })
+	if err != nil {
+		return err
+	}
+	t.watcher = watcher
+	return nil
+}
+
+// reloadTables reloads the tables of the file, the previous rows are kept on error
+func (t *LookupTransform) reloadTables(tables []pkgconfig.LookupTable, file string) {
+	for i, table := range tables {
+		if filepath.Clean(table.File) != file {
+			continue
+		}
+		index, err := LoadLookupTable(table)
+		if err != nil {
+			t.LogError("unable to reload table %s: %v", table.Name, err)
+			continue
+		}
+		t.Lock()
+		t.indexes[i] = index
+		t.Unlock()
+		t.LogInfo("table %s reloaded with %d entries", table.Name, index.Len())
+	}
+}
+
+func (t *LookupTransform) enrich(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.Enrichment == nil {
+		dm.Enrichment = make(map[string]string)
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	dmValue := reflect.ValueOf(dm).Elem()
+	for _, index := range t.indexes {
+		value, found := dnsutils.GetFieldByJSONTag(dmValue, index.table.Field)
+		if !found || value.Kind() != reflect.String {
+			continue
+		}
+		if row, ok := index.Match(value.String()); ok {
+			for column, v := range row {
+				dm.Enrichment[column] = v
+			}
+		}
+	}
+	return ReturnKeep, nil
+}
@@ -0,0 +1,158 @@
+package transformers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"inet.af/netaddr"
+)
+
+func TestLookup_RadixTree(t *testing.T) {
+	tree := NewIPRadixTree[string]()
+	tree.Insert(netaddr.MustParseIPPrefix("10.0.0.0/8"), "corp")
+	tree.Insert(netaddr.MustParseIPPrefix("10.1.0.0/16"), "paris")
+	tree.Insert(netaddr.MustParseIPPrefix("10.1.2.0/24"), "paris-lab")
+	tree.Insert(netaddr.MustParseIPPrefix("2001:db8::/32"), "corp-v6")
+
+	testcases := []struct {
+		ip    string
+		want  string
+		found bool
+	}{
+		{"10.1.2.3", "paris-lab", true},
+		{"10.1.3.3", "paris", true},
+		{"10.2.0.1", "corp", true},
+		{"::ffff:10.1.3.3", "paris", true},
+		{"2001:db8::1", "corp-v6", true},
+		{"192.168.1.1", "", false},
+	}
+	for _, tc := range testcases {
+		value, found := tree.Lookup(netaddr.MustParseIP(tc.ip))
+		if value != tc.want || found != tc.found {
+			t.Errorf("%s: want %s, got %s", tc.ip, tc.want, value)
+		}
+	}
+	if tree.Len() != 4 {
+		t.Errorf("want 4 prefixes, got %d", tree.Len())
+	}
+}
+
+func TestLookup_Enrich(t *testing.T) {
+	dir := t.TempDir()
+	sitesFile := filepath.Join(dir, "sites.csv")
+	os.WriteFile(sitesFile, []byte("# subnets\nsubnet,site,owner,department\n10.0.0.0/8,hq,it,infra\n10.1.0.0/16,paris,john,sales\n"), 0o644)
+	appsFile := filepath.Join(dir, "apps.json")
+	os.WriteFile(appsFile, []byte(`[{"domain": "office365.com", "application": "Office 365", "critical": true}]`), 0o644)
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Lookup.Enable = true
+	config.Lookup.WatchFiles = false
+	config.Lookup.Tables = []pkgconfig.LookupTable{
+		{Name: "sites", File: sitesFile, Format: "csv", Type: "cidr", Key: "subnet", Columns: []string{"site", "owner"}},
+		{Name: "apps", File: appsFile, Format: "json", Type: "domain-suffix", Key: "domain"},
+	}
+
+	lookup := NewLookupTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := lookup.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Reset()
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "10.1.2.3"
+	dm.DNS.Qname = "outlook.office365.com"
+	lookup.enrich(&dm)
+
+	want := map[string]string{"site": "paris", "owner": "john", "application": "Office 365", "critical": "true"}
+	if len(dm.Enrichment) != len(want) {
+		t.Errorf("want %v, got %v", want, dm.Enrichment)
+	}
+	for k, v := range want {
+		if dm.Enrichment[k] != v {
+			t.Errorf("%s: want %s, got %s", k, v, dm.Enrichment[k])
+		}
+	}
+
+	// no match
+	dm = dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "192.168.1.1"
+	dm.DNS.Qname = "notoffice365.com"
+	lookup.enrich(&dm)
+	if len(dm.Enrichment) != 0 {
+		t.Errorf("unexpected enrichment %v", dm.Enrichment)
+	}
+}
+
+func TestLookup_ExactDomain(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "apps.csv")
+	os.WriteFile(file, []byte("domain,application\nexample.com.,website\n"), 0o644)
+
+	index, err := LoadLookupTable(pkgconfig.LookupTable{File: file, Format: "csv", Type: "domain", Key: "domain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row, ok := index.Match("EXAMPLE.com"); !ok || row["application"] != "website" {
+		t.Errorf("domain not matched: %v", row)
+	}
+	if _, ok := index.Match("www.example.com"); ok {
+		t.Errorf("subdomain matched with exact type")
+	}
+}
+
+func TestLookup_InvalidTable(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sites.csv")
+	os.WriteFile(file, []byte("subnet,site\nnot-an-ip,hq\n"), 0o644)
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Lookup.Enable = true
+	config.Lookup.Tables = []pkgconfig.LookupTable{{Name: "sites", File: file, Format: "csv", Type: "cidr", Key: "subnet"}}
+
+	lookup := NewLookupTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := lookup.GetTransforms(); err == nil {
+		t.Errorf("error expected for invalid subnet")
+	}
+
+	config.Lookup.Tables[0].Type = "asn"
+	if _, err := lookup.GetTransforms(); err == nil {
+		t.Errorf("error expected for invalid type")
+	}
+}
+
+func TestLookup_ReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sites.csv")
+	os.WriteFile(file, []byte("subnet,site\n10.0.0.0/8,hq\n"), 0o644)
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Lookup.Enable = true
+	config.Lookup.Tables = []pkgconfig.LookupTable{{Name: "sites", File: file, Format: "csv", Type: "cidr", Key: "subnet"}}
+
+	lookup := NewLookupTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := lookup.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Reset()
+
+	os.WriteFile(file, []byte("subnet,site\n10.0.0.0/8,datacenter\n"), 0o644)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.NetworkInfo.QueryIP = "10.1.1.1"
+		lookup.enrich(&dm)
+		if dm.Enrichment["site"] == "datacenter" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("table not reloaded, site=%s", dm.Enrichment["site"])
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -1,6 +1,7 @@
 package transformers
 
 import (
+	"fmt"
 	"math"
 	"strings"
 	"unicode"
@@ -23,6 +24,7 @@ func isConsonant(char rune) bool {
 
 type MlTransform struct {
 	GenericTransformer
+	dgaModel *DGAModel
 }
 
 func NewMachineLearningTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *MlTransform {
@@ -32,8 +34,25 @@ func NewMachineLearningTransform(config *pkgconfig.ConfigTransformers, logger *l
 
 func (t *MlTransform) GetTransforms() ([]Subtransform, error) {
 	subtransforms := []Subtransform{}
-	if t.config.MachineLearning.Enable {
-		subtransforms = append(subtransforms, Subtransform{name: "machinelearning:add-feature", processFunc: t.addFeatures})
+	if !t.config.MachineLearning.Enable {
+		return subtransforms, nil
+	}
+
+	subtransforms = append(subtransforms, Subtransform{name: "machinelearning:add-feature", processFunc: t.addFeatures})
+
+	if t.config.MachineLearning.DGA {
+		switch t.config.MachineLearning.DGAAction {
+		case dnsutils.DGAActionNone, dnsutils.DGAActionTag, dnsutils.DGAActionDrop:
+		default:
+			return nil, fmt.Errorf("invalid dga action: %s", t.config.MachineLearning.DGAAction)
+		}
+
+		model, err := LoadDGAModel(t.config.MachineLearning.DGAModelFile)
+		if err != nil {
+			return nil, err
+		}
+		t.dgaModel = model
+		subtransforms = append(subtransforms, Subtransform{name: "machinelearning:dga", processFunc: t.scoreDGA})
 	}
 	return subtransforms, nil
 }
@@ -180,6 +199,25 @@ func (t *MlTransform) addFeatures(dm *dnsutils.DNSMessage) (int, error) {
 	dm.MachineLearning.ConsecutiveVowels = consecutiveVowelCount
 	dm.MachineLearning.ConsecutiveDigits = consecutiveDigitCount
 	dm.MachineLearning.ConsecutiveConsonants = consecutiveConsonantCount
+	dm.MachineLearning.BigramScore = bigramScore(dm.DNS.Qname)
 
 	return ReturnKeep, nil
 }
+
+func (t *MlTransform) scoreDGA(dm *dnsutils.DNSMessage) (int, error) {
+	dm.MachineLearning.DGAProbability = t.dgaModel.Predict(dm.MachineLearning)
+	if dm.MachineLearning.DGAProbability < t.config.MachineLearning.DGAThreshold {
+		return ReturnKeep, nil
+	}
+
+	switch t.config.MachineLearning.DGAAction {
+	case dnsutils.DGAActionTag:
+		if dm.ATags == nil {
+			dm.ATags = &dnsutils.TransformATags{Tags: []string{}}
+		}
+		dm.ATags.Tags = append(dm.ATags.Tags, dnsutils.DGATag)
+	case dnsutils.DGAActionDrop:
+		return ReturnDrop, nil
+	}
+	return ReturnKeep, nil
+}
@@ -0,0 +1,36 @@
+package transformers
+
+// dgaBigramAlphabet is the list of characters of the bigrams, the digits and the
+// hyphens are not part of the language model, they are scored by ratio-digits
+const dgaBigramAlphabet = "abcdefghijklmnopqrstuvwxyz"
+
+// dgaBigramLogProb is the log10 probability of a character knowing the previous one,
+// computed from english texts and popular domain names with add-one smoothing
+var dgaBigramLogProb = [26][26]float64{
+	/* a */ {-2.46, -1.39, -1.11, -1.32, -2.55, -2.09, -1.35, -2.68, -1.41, -2.72, -1.98, -0.93, -1.27, -0.97, -2.78, -1.39, -3.34, -0.96, -1.24, -0.76, -1.77, -1.93, -2.31, -2.17, -1.86, -2.48},
+	/* b */ {-0.97, -1.97, -1.48, -2.41, -0.77, -2.43, -2.72, -2.61, -1.10, -1.68, -2.93, -0.76, -1.93, -2.48, -1.06, -2.17, -2.75, -1.22, -1.14, -2.08, -0.97, -2.70, -3.14, -3.43, -1.56, -2.90},
+	/* c */ {-1.03, -2.96, -1.69, -2.36, -0.89, -2.67, -2.37, -0.97, -1.41, -3.03, -1.21, -1.22, -2.63, -2.68, -0.63, -2.01, -3.01, -1.28, -1.74, -0.96, -1.51, -2.66, -3.45, -3.48, -1.95, -3.10},
+	/* d */ {-1.14, -1.40, -1.77, -1.49, -0.49, -1.89, -1.92, -2.43, -0.82, -2.52, -2.06, -1.48, -1.79, -1.97, -1.26, -1.90, -3.00, -1.39, -1.23, -2.10, -1.28, -2.16, -2.22, -3.31, -1.75, -3.38},
+	/* e */ {-1.35, -2.04, -1.21, -1.00, -1.81, -1.74, -1.82, -2.45, -2.09, -2.83, -2.31, -1.31, -1.40, -0.94, -2.25, -1.57, -1.95, -0.74, -0.84, -1.25, -2.18, -1.73, -1.86, -1.46, -1.95, -2.97},
+	/* f */ {-1.00, -2.55, -2.37, -2.72, -0.94, -1.05, -2.57, -3.10, -0.61, -2.91, -2.56, -1.12, -2.18, -2.25, -0.88, -2.42, -3.13, -1.18, -1.60, -1.61, -1.22, -2.87, -2.64, -2.97, -1.57, -3.22},
+	/* g */ {-1.18, -2.54, -1.69, -2.64, -0.56, -2.07, -1.38, -1.41, -1.02, -3.49, -2.50, -1.60, -1.79, -1.34, -1.06, -1.93, -2.76, -0.87, -1.30, -2.01, -1.41, -2.79, -2.46, -3.08, -2.03, -2.28},
+	/* h */ {-0.66, -2.09, -1.87, -2.14, -0.64, -2.41, -2.51, -2.61, -0.95, -3.44, -2.27, -1.95, -1.38, -1.99, -0.89, -1.90, -2.42, -1.45, -1.68, -1.21, -1.36, -2.90, -2.02, -2.89, -1.88, -2.73},
+	/* i */ {-1.58, -1.71, -1.17, -1.42, -1.36, -1.69, -1.48, -3.17, -2.97, -3.27, -2.46, -1.31, -1.35, -0.59, -0.94, -1.56, -2.92, -1.64, -1.19, -0.99, -2.80, -1.54, -3.54, -2.10, -3.40, -1.67},
+	/* j */ {-1.03, -1.95, -1.80, -1.93, -0.69, -2.66, -2.30, -2.09, -1.61, -2.39, -1.91, -2.39, -2.05, -2.36, -0.81, -2.12, -2.09, -2.40, -0.77, -2.20, -0.94, -1.07, -1.78, -2.27, -2.48, -2.96},
+	/* k */ {-1.20, -1.87, -2.01, -1.79, -0.44, -1.77, -1.93, -2.10, -0.85, -2.86, -2.11, -1.61, -2.03, -1.28, -1.38, -1.54, -2.51, -1.74, -1.00, -1.85, -1.49, -2.30, -2.27, -3.00, -1.95, -2.91},
+	/* l */ {-0.94, -2.42, -2.09, -1.62, -0.67, -2.27, -2.72, -2.60, -0.73, -3.11, -2.44, -1.03, -2.35, -2.27, -0.91, -1.95, -2.96, -2.27, -1.47, -1.46, -1.40, -2.14, -2.66, -3.48, -1.15, -2.97},
+	/* m */ {-0.73, -1.56, -1.86, -2.08, -0.54, -2.54, -2.43, -2.38, -0.94, -2.84, -2.49, -2.03, -1.51, -2.13, -1.10, -0.91, -1.96, -2.33, -1.49, -2.02, -1.52, -2.67, -2.87, -3.39, -2.26, -3.43},
+	/* n */ {-1.07, -2.36, -1.15, -1.10, -1.01, -1.63, -0.78, -2.45, -1.22, -2.69, -1.91, -2.17, -2.03, -1.62, -1.45, -2.18, -2.81, -2.19, -0.99, -0.79, -1.85, -1.84, -2.66, -3.05, -2.20, -2.88},
+	/* o */ {-1.88, -1.72, -1.40, -1.32, -2.57, -1.85, -1.57, -2.82, -1.88, -2.69, -1.84, -1.35, -1.18, -0.61, -1.58, -1.30, -3.77, -0.84, -1.38, -1.30, -1.13, -1.58, -1.58, -2.34, -2.44, -2.97},
+	/* p */ {-0.91, -2.08, -1.67, -2.03, -0.83, -2.37, -2.28, -1.81, -1.31, -3.64, -2.37, -1.01, -2.24, -2.16, -0.95, -1.26, -3.28, -0.75, -1.49, -1.13, -1.42, -2.54, -3.14, -3.77, -2.20, -3.77},
+	/* q */ {-2.42, -2.99, -2.02, -1.89, -2.43, -2.69, -2.99, -2.99, -2.07, -2.99, -2.99, -1.15, -1.52, -2.19, -2.19, -2.02, -2.99, -2.35, -1.95, -1.39, -0.12, -2.99, -2.99, -2.99, -2.99, -2.99},
+	/* r */ {-0.90, -2.39, -1.68, -1.59, -0.59, -2.13, -1.86, -2.73, -0.93, -3.10, -1.73, -1.95, -1.65, -1.79, -0.94, -1.80, -3.36, -1.55, -1.17, -1.33, -1.60, -1.69, -2.37, -3.60, -1.50, -3.52},
+	/* s */ {-1.30, -2.84, -1.23, -1.91, -0.79, -2.23, -2.34, -1.26, -1.04, -3.35, -1.92, -1.81, -1.91, -2.02, -1.38, -1.23, -2.37, -2.20, -1.06, -0.66, -1.27, -2.78, -2.15, -3.42, -1.56, -3.31},
+	/* t */ {-1.03, -2.44, -1.59, -2.09, -0.67, -2.24, -2.71, -1.26, -0.67, -3.01, -2.53, -1.74, -2.10, -2.29, -1.11, -1.79, -3.80, -1.04, -1.26, -1.43, -1.62, -2.82, -2.08, -2.94, -1.54, -3.03},
+	/* u */ {-1.49, -1.29, -1.40, -1.59, -1.13, -1.79, -1.73, -3.26, -1.48, -3.18, -2.46, -1.10, -1.25, -0.75, -2.16, -1.25, -4.02, -1.00, -0.98, -0.97, -2.53, -3.20, -3.72, -2.28, -2.93, -2.57},
+	/* v */ {-0.81, -2.99, -1.71, -2.50, -0.30, -2.49, -2.67, -2.85, -0.70, -3.30, -3.13, -2.82, -1.53, -2.60, -1.30, -2.73, -3.60, -2.68, -2.17, -2.52, -2.23, -2.93, -3.30, -3.11, -2.80, -3.60},
+	/* w */ {-0.74, -2.25, -1.91, -2.04, -0.94, -2.42, -2.29, -1.25, -0.69, -2.81, -2.35, -1.82, -1.95, -1.20, -0.99, -1.89, -3.15, -1.01, -1.28, -1.87, -2.47, -2.24, -1.99, -3.02, -2.51, -3.15},
+	/* x */ {-1.27, -2.09, -1.21, -1.62, -0.98, -1.89, -2.08, -1.92, -1.03, -2.93, -2.93, -2.40, -1.65, -1.91, -2.23, -0.65, -2.66, -1.84, -1.65, -0.62, -1.70, -2.93, -2.63, -1.76, -1.68, -3.23},
+	/* y */ {-1.28, -1.92, -1.40, -1.99, -1.38, -1.89, -1.92, -2.18, -1.25, -2.36, -2.02, -1.41, -1.36, -1.15, -1.36, -0.89, -2.88, -1.53, -0.61, -1.22, -1.46, -1.87, -1.92, -2.61, -2.32, -2.03},
+	/* z */ {-0.77, -2.71, -2.15, -2.54, -0.37, -2.71, -3.01, -1.62, -0.96, -3.01, -2.31, -1.83, -2.34, -2.15, -1.06, -2.54, -2.30, -3.01, -1.64, -2.18, -1.53, -2.71, -2.54, -2.43, -1.86, -1.44},
+}
@@ -0,0 +1,217 @@
+package transformers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	publicsuffixlist "golang.org/x/net/publicsuffix"
+)
+
+const (
+	DGAModelLogisticRegression = "logistic-regression"
+	DGAModelGradientBoosted    = "gradient-boosted-trees"
+)
+
+// dgaDefaultModel is used when no model file is provided, trained on popular domain names
+// and random strings, a low bigram score is the main indicator of a generated domain
+const dgaDefaultModel = `{
+	"type": "logistic-regression",
+	"features": ["bigram-score", "entropy", "ratio-digits", "consecutive-consonants", "length"],
+	"intercept": -2.38,
+	"coefficients": [-5.22, -1.58, 1.19, 0.64, -0.18]
+}`
+
+// a node is a leaf when the value is set, otherwise the left child is
+// evaluated when the feature is lower than the threshold
+type DGATreeNode struct {
+	Feature   int      `json:"feature"`
+	Threshold float64  `json:"threshold"`
+	Left      int      `json:"left"`
+	Right     int      `json:"right"`
+	Leaf      *float64 `json:"leaf,omitempty"`
+}
+
+type DGATree struct {
+	Nodes []DGATreeNode `json:"nodes"`
+}
+
+type DGAModel struct {
+	Type         string    `json:"type"`
+	Features     []string  `json:"features"`
+	Intercept    float64   `json:"intercept"`
+	Coefficients []float64 `json:"coefficients"`
+	BaseScore    float64   `json:"base-score"`
+	Trees        []DGATree `json:"trees"`
+}
+
+// LoadDGAModel reads the model from the file or the default one
+func LoadDGAModel(fname string) (*DGAModel, error) {
+	data := []byte(dgaDefaultModel)
+	if len(fname) > 0 {
+		var err error
+		if data, err = os.ReadFile(fname); err != nil {
+			return nil, fmt.Errorf("unable to read dga model: %w", err)
+		}
+	}
+
+	model := &DGAModel{}
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, fmt.Errorf("unable to decode dga model: %w", err)
+	}
+	if err := model.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid dga model: %w", err)
+	}
+	return model, nil
+}
+
+func (m *DGAModel) Validate() error {
+	ml := &dnsutils.TransformML{}
+	for _, feature := range m.Features {
+		if _, ok := mlFeatureValue(ml, feature); !ok {
+			return fmt.Errorf("unknown feature %s", feature)
+		}
+	}
+
+	switch m.Type {
+	case DGAModelLogisticRegression:
+		if len(m.Coefficients) != len(m.Features) {
+			return fmt.Errorf("%d coefficients for %d features", len(m.Coefficients), len(m.Features))
+		}
+	case DGAModelGradientBoosted:
+		for i, tree := range m.Trees {
+			if len(tree.Nodes) == 0 {
+				return fmt.Errorf("tree %d is empty", i)
+			}
+			for j, node := range tree.Nodes {
+				if node.Leaf != nil {
+					continue
+				}
+				// children after the parent to avoid loops
+				if node.Left <= j || node.Right <= j || node.Left >= len(tree.Nodes) || node.Right >= len(tree.Nodes) {
+					return fmt.Errorf("tree %d: invalid children for node %d", i, j)
+				}
+				if node.Feature < 0 || node.Feature >= len(m.Features) {
+					return fmt.Errorf("tree %d: invalid feature for node %d", i, j)
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", m.Type)
+	}
+	return nil
+}
+
+// Predict returns the probability of a generated domain
+func (m *DGAModel) Predict(ml *dnsutils.TransformML) float64 {
+	values := make([]float64, len(m.Features))
+	for i, feature := range m.Features {
+		values[i], _ = mlFeatureValue(ml, feature)
+	}
+
+	var score float64
+	switch m.Type {
+	case DGAModelLogisticRegression:
+		score = m.Intercept
+		for i, value := range values {
+			score += m.Coefficients[i] * value
+		}
+	case DGAModelGradientBoosted:
+		score = m.BaseScore
+		for _, tree := range m.Trees {
+			node := tree.Nodes[0]
+			for node.Leaf == nil {
+				if values[node.Feature] < node.Threshold {
+					node = tree.Nodes[node.Left]
+				} else {
+					node = tree.Nodes[node.Right]
+				}
+			}
+			score += *node.Leaf
+		}
+	}
+	return 1.0 / (1.0 + math.Exp(-score))
+}
+
+func mlFeatureValue(ml *dnsutils.TransformML, name string) (float64, bool) {
+	switch name {
+	case "entropy":
+		return ml.Entropy, true
+	case "length":
+		return float64(ml.Length), true
+	case "labels":
+		return float64(ml.Labels), true
+	case "digits":
+		return float64(ml.Digits), true
+	case "lowers":
+		return float64(ml.Lowers), true
+	case "uppers":
+		return float64(ml.Uppers), true
+	case "specials":
+		return float64(ml.Specials), true
+	case "others":
+		return float64(ml.Others), true
+	case "ratio-digits":
+		return ml.RatioDigits, true
+	case "ratio-letters":
+		return ml.RatioLetters, true
+	case "ratio-specials":
+		return ml.RatioSpecials, true
+	case "ratio-others":
+		return ml.RatioOthers, true
+	case "consecutive-chars":
+		return float64(ml.ConsecutiveChars), true
+	case "consecutive-vowels":
+		return float64(ml.ConsecutiveVowels), true
+	case "consecutive-digits":
+		return float64(ml.ConsecutiveDigits), true
+	case "consecutive-consonants":
+		return float64(ml.ConsecutiveConsonants), true
+	case "size":
+		return float64(ml.Size), true
+	case "occurrences":
+		return float64(ml.Occurrences), true
+	case "uncommon-qtypes":
+		return float64(ml.UncommonQtypes), true
+	case "bigram-score":
+		return ml.BigramScore, true
+	}
+	return 0, false
+}
+
+// bigramScoreMinRun is the minimum length of a run of letters to be scored,
+// the shorter runs are acronyms (cdn, www, api...) and not words
+const bigramScoreMinRun = 4
+
+// bigramScore returns the average log10 probability of the bigrams of the registered
+// label of the qname, subdomains and public suffix are ignored. Only the runs of letters
+// are scored, the digits and the hyphens split the label, 0 if there is nothing to score
+func bigramScore(qname string) float64 {
+	qname = strings.ToLower(strings.TrimSuffix(qname, "."))
+	if etld1, err := publicsuffixlist.EffectiveTLDPlusOne(qname); err == nil {
+		qname = etld1
+	}
+	label, _, _ := strings.Cut(qname, ".")
+
+	var total float64
+	count := 0
+	notLetter := func(r rune) bool { return !strings.ContainsRune(dgaBigramAlphabet, r) }
+	for _, run := range strings.FieldsFunc(label, notLetter) {
+		if len(run) < bigramScoreMinRun {
+			continue
+		}
+		for i := 1; i < len(run); i++ {
+			prev := strings.IndexByte(dgaBigramAlphabet, run[i-1])
+			next := strings.IndexByte(dgaBigramAlphabet, run[i])
+			total += dgaBigramLogProb[prev][next]
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
@@ -0,0 +1,177 @@
+package transformers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestML_DGADefaultModel(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.MachineLearning.Enable = true
+	config.MachineLearning.DGA = true
+
+	ml := NewMachineLearningTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := ml.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		qname string
+		dga   bool
+	}{
+		{qname: "www.google.com", dga: false},
+		{qname: "wikipedia.org", dga: false},
+		{qname: "login.microsoftonline.com", dga: false},
+		{qname: "stackoverflow.com", dga: false},
+		{qname: "xjwqkzprtvbn.com", dga: true},
+		{qname: "qwhfbzkcpyrm.org", dga: true},
+		{qname: "nvjhbqrtzlwkd.com", dga: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.qname, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = tc.qname
+			ml.addFeatures(&dm)
+			ml.scoreDGA(&dm)
+
+			if dm.MachineLearning.BigramScore >= 0 {
+				t.Errorf("invalid bigram score %f", dm.MachineLearning.BigramScore)
+			}
+			if (dm.MachineLearning.DGAProbability >= 0.5) != tc.dga {
+				t.Errorf("want dga=%v, got probability %f", tc.dga, dm.MachineLearning.DGAProbability)
+			}
+		})
+	}
+}
+
+func TestML_DGADigitsAndHyphens(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.MachineLearning.Enable = true
+	config.MachineLearning.DGA = true
+
+	ml := NewMachineLearningTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := ml.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	// legitimate domains, the digits, the hyphens and the acronyms are not scored as bigrams
+	for _, qname := range []string{"cdn77.org", "www.1e100.net", "360.cn", "web3.io", "4chan.org", "x-cdn.net", "my-bank.co.uk", "dns-collector.org"} {
+		t.Run(qname, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = qname
+			ml.addFeatures(&dm)
+			ml.scoreDGA(&dm)
+
+			if dm.MachineLearning.DGAProbability >= 0.5 {
+				t.Errorf("legitimate domain, got probability %f", dm.MachineLearning.DGAProbability)
+			}
+		})
+	}
+}
+
+func TestML_DGAActions(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.MachineLearning.Enable = true
+	config.MachineLearning.DGA = true
+	config.MachineLearning.DGAAction = dnsutils.DGAActionTag
+
+	ml := NewMachineLearningTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := ml.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "xjwqkzprtvbn.com"
+	ml.addFeatures(&dm)
+	if result, _ := ml.scoreDGA(&dm); result != ReturnKeep {
+		t.Errorf("message should be kept")
+	}
+	if dm.ATags == nil || len(dm.ATags.Tags) != 1 || dm.ATags.Tags[0] != dnsutils.DGATag {
+		t.Errorf("dga tag expected, got %v", dm.ATags)
+	}
+
+	// drop
+	config.MachineLearning.DGAAction = dnsutils.DGAActionDrop
+	ml.GetTransforms()
+	dm = dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "xjwqkzprtvbn.com"
+	ml.addFeatures(&dm)
+	if result, _ := ml.scoreDGA(&dm); result != ReturnDrop {
+		t.Errorf("message should be dropped")
+	}
+
+	// invalid action
+	config.MachineLearning.DGAAction = "alert"
+	if _, err := ml.GetTransforms(); err == nil {
+		t.Errorf("error expected on invalid action")
+	}
+}
+
+func TestML_DGAGradientBoostedTrees(t *testing.T) {
+	model := `{
+		"type": "gradient-boosted-trees",
+		"features": ["bigram-score", "consecutive-consonants"],
+		"base-score": -1.0,
+		"trees": [
+			{"nodes": [{"feature": 0, "threshold": -1.9, "left": 1, "right": 2}, {"leaf": 2.0}, {"leaf": -1.0}]},
+			{"nodes": [{"feature": 1, "threshold": 6, "left": 1, "right": 2}, {"leaf": -0.5}, {"leaf": 1.5}]}
+		]
+	}`
+	fname := filepath.Join(t.TempDir(), "model.json")
+	if err := os.WriteFile(fname, []byte(model), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.MachineLearning.Enable = true
+	config.MachineLearning.DGA = true
+	config.MachineLearning.DGAModelFile = fname
+
+	ml := NewMachineLearningTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := ml.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	// -1.0 + 2.0 + 1.5
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "xjwqkzprtvbn.com"
+	ml.addFeatures(&dm)
+	ml.scoreDGA(&dm)
+	if p := dm.MachineLearning.DGAProbability; p < 0.92 || p > 0.93 {
+		t.Errorf("want probability 0.924, got %f", p)
+	}
+
+	// -1.0 - 1.0 - 0.5
+	dm = dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "wikipedia.org"
+	ml.addFeatures(&dm)
+	ml.scoreDGA(&dm)
+	if p := dm.MachineLearning.DGAProbability; p < 0.07 || p > 0.08 {
+		t.Errorf("want probability 0.076, got %f", p)
+	}
+}
+
+func TestML_DGAInvalidModel(t *testing.T) {
+	testcases := []string{
+		`{"type": "svm", "features": []}`,
+		`{"type": "logistic-regression", "features": ["entropy"], "coefficients": [1.0, 2.0]}`,
+		`{"type": "logistic-regression", "features": ["unknown"], "coefficients": [1.0]}`,
+		`{"type": "gradient-boosted-trees", "features": ["entropy"], "trees": [{"nodes": [{"feature": 0, "left": 0, "right": 0}]}]}`,
+	}
+
+	for _, model := range testcases {
+		fname := filepath.Join(t.TempDir(), "model.json")
+		if err := os.WriteFile(fname, []byte(model), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadDGAModel(fname); err == nil {
+			t.Errorf("error expected for %s", model)
+		}
+	}
+}
@@ -5,21 +5,37 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
 	"github.com/hashicorp/golang-lru/v2/expirable"
+	"golang.org/x/net/publicsuffix"
 )
 
+// prefixes of the keys tracked in addition to the qnames, each family has its own cache
+const (
+	newDomainKeyClient      = "client:"
+	newDomainKeyETLDPlusOne = "etld+1:"
+)
+
+// interval between two warnings when the cache is full
+const newDomainFullWarningInterval = time.Minute
+
 type NewDomainTracker struct {
-	ttl             time.Duration                    // Time window to consider a domain as "new"
-	cache           *expirable.LRU[string, struct{}] // Expirable LRU Cache
-	whitelist       map[string]*regexp.Regexp        // Whitelisted domains
+	sync.Mutex
+	ttl             time.Duration                                // Time window to consider a domain as "new"
+	maxSize         int                                          // Size of the cache of each key family
+	caches          map[string]*expirable.LRU[string, time.Time] // Expirable LRU Caches per key family, with the first time seen
+	bloom           *RotatingBloomFilter                         // Bloom filters, used instead of the caches
+	whitelist       map[string]*regexp.Regexp                    // Whitelisted domains
 	persistencePath string
 	logInfo         func(msg string, v ...interface{})
 	logError        func(msg string, v ...interface{})
@@ -31,11 +47,10 @@ func NewNewDomainTracker(ttl time.Duration, maxSize int, whitelist map[string]*r
 		return nil, fmt.Errorf("invalid TTL value: %v", ttl)
 	}
 
-	cache := expirable.NewLRU[string, struct{}](maxSize, nil, ttl)
-
 	tracker := &NewDomainTracker{
 		ttl:             ttl,
-		cache:           cache,
+		maxSize:         maxSize,
+		caches:          make(map[string]*expirable.LRU[string, time.Time]),
 		whitelist:       whitelist,
 		persistencePath: persistencePath,
 		logInfo:         logInfo,
@@ -51,6 +66,69 @@ func NewNewDomainTracker(ttl time.Duration, maxSize int, whitelist map[string]*r
 	return tracker, nil
 }
 
+// NewBloomDomainTracker tracks the domains with rotating bloom filters, the memory usage is low
+// but there is a small probability to consider a new domain as already seen
+func NewBloomDomainTracker(ttl time.Duration, capacity uint64, errorRate float64, whitelist map[string]*regexp.Regexp, persistencePath string, logInfo, logError func(msg string, v ...interface{})) (*NewDomainTracker, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid TTL value: %v", ttl)
+	}
+
+	bloom, err := NewRotatingBloomFilter(ttl, capacity, errorRate)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := &NewDomainTracker{
+		ttl:             ttl,
+		bloom:           bloom,
+		whitelist:       whitelist,
+		persistencePath: persistencePath,
+		logInfo:         logInfo,
+		logError:        logError,
+	}
+	if persistencePath != "" {
+		if err := tracker.loadCacheFromDisk(); err != nil {
+			return nil, fmt.Errorf("failed to load bloom filters: %w", err)
+		}
+	}
+	return tracker, nil
+}
+
+// keyFamily returns the prefix of the key, empty for the qnames
+func keyFamily(key string) string {
+	for _, prefix := range []string{newDomainKeyClient, newDomainKeyETLDPlusOne} {
+		if strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// cacheFor returns the cache of the family of the key, the client keys
+// can't evict the qnames when they are more numerous
+func (ndt *NewDomainTracker) cacheFor(key string) *expirable.LRU[string, time.Time] {
+	family := keyFamily(key)
+	cache, ok := ndt.caches[family]
+	if !ok {
+		cache = expirable.NewLRU[string, time.Time](ndt.maxSize, nil, ndt.ttl)
+		ndt.caches[family] = cache
+	}
+	return cache
+}
+
+// IsFull returns true when the cache of a key family is full, the oldest keys are evicted
+func (ndt *NewDomainTracker) IsFull() bool {
+	ndt.Lock()
+	defer ndt.Unlock()
+
+	for _, cache := range ndt.caches {
+		if cache.Len() >= ndt.maxSize {
+			return true
+		}
+	}
+	return false
+}
+
 func (ndt *NewDomainTracker) isWhitelisted(domain string) bool {
 	for _, d := range ndt.whitelist {
 		if d.MatchString(domain) {
@@ -66,50 +144,141 @@ func (ndt *NewDomainTracker) IsNewDomain(domain string) bool {
 		return false
 	}
 
-	// Check if the domain exists in the cache
-	if _, exists := ndt.cache.Get(domain); exists {
+	isNew, _ := ndt.FirstSeen(domain, time.Now())
+	return isNew
+}
+
+// FirstSeen returns true when the key was not seen during the time window, the key is added.
+// The time of the first observation is also returned, it is unknown with the bloom filters for the known keys
+func (ndt *NewDomainTracker) FirstSeen(key string, seen time.Time) (bool, time.Time) {
+	ndt.Lock()
+	defer ndt.Unlock()
+
+	if ndt.bloom != nil {
+		if ndt.bloom.TestAndAdd(key, time.Now()) {
+			return false, time.Time{}
+		}
+		return true, seen
+	}
+
+	// Check if the key exists in the cache
+	cache := ndt.cacheFor(key)
+	if firstSeen, exists := cache.Get(key); exists {
 		// Domain was recently seen, not new
-		return false
+		return false, firstSeen
 	}
 
-	// Otherwise, mark the domain as new
-	ndt.cache.Add(domain, struct{}{})
-	return true
+	// Otherwise, mark the key as new
+	cache.Add(key, seen)
+	return true, seen
+}
+
+func (ndt *NewDomainTracker) SetTTL(ttl time.Duration) {
+	ndt.Lock()
+	defer ndt.Unlock()
+
+	ndt.ttl = ttl
+	if ndt.bloom != nil {
+		ndt.bloom.ttl = ttl
+	}
+}
+
+// Len returns the number of keys, approximate with the bloom filters
+func (ndt *NewDomainTracker) Len() int {
+	ndt.Lock()
+	defer ndt.Unlock()
+
+	if ndt.bloom != nil {
+		return int(ndt.bloom.Count())
+	}
+	n := 0
+	for _, cache := range ndt.caches {
+		n += cache.Len()
+	}
+	return n
 }
 
+// SaveCacheToDisk writes a temporary file then renames it, the previous state is kept if the save fails,
+// the temporary file is unique to support several trackers with the same persistence file
 func (ndt *NewDomainTracker) SaveCacheToDisk() error {
-	keys := ndt.cache.Keys()
-	data, err := json.Marshal(keys)
+	file, err := os.CreateTemp(filepath.Dir(ndt.persistencePath), filepath.Base(ndt.persistencePath)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	tmpPath := file.Name()
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
 
-	return os.WriteFile(ndt.persistencePath, data, 0644)
+	ndt.Lock()
+	if ndt.bloom != nil {
+		err = ndt.bloom.Save(file)
+	} else {
+		state := make(map[string]int64)
+		for _, cache := range ndt.caches {
+			for _, key := range cache.Keys() {
+				if firstSeen, ok := cache.Peek(key); ok {
+					state[key] = firstSeen.UnixNano()
+				}
+			}
+		}
+		err = json.NewEncoder(file).Encode(state)
+	}
+	ndt.Unlock()
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, ndt.persistencePath)
 }
 
-// loadCacheFromDisk loads the cache state from a file
+// loadCacheFromDisk loads the cache state from a file,
+// the cache can be saved as a list of domains by the previous versions
 func (ndt *NewDomainTracker) loadCacheFromDisk() error {
 	if ndt.persistencePath == "" {
 		return errors.New("persistence filepath not set")
 	}
 
-	data, err := os.ReadFile(ndt.persistencePath)
+	file, err := os.Open(ndt.persistencePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil // File does not exist, no previous state to load
 		}
 		return err
 	}
+	defer file.Close()
 
-	var keys []string
-	if err := json.Unmarshal(data, &keys); err != nil {
+	if ndt.bloom != nil {
+		return ndt.bloom.Load(file)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
 		return err
 	}
 
-	for _, key := range keys {
-		ndt.cache.Add(key, struct{}{})
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err == nil {
+		now := time.Now()
+		for _, key := range keys {
+			ndt.cacheFor(key).Add(key, now)
+		}
+		return nil
 	}
 
+	state := make(map[string]int64)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for key, firstSeen := range state {
+		ndt.cacheFor(key).Add(key, time.Unix(0, firstSeen))
+	}
 	return nil
 }
 
@@ -118,6 +287,9 @@ type NewDomainTrackerTransform struct {
 	GenericTransformer
 	domainTracker    *NewDomainTracker
 	listDomainsRegex map[string]*regexp.Regexp
+	stopCheckpoint   chan struct{}
+	checkpointDone   chan struct{}
+	lastFullWarning  time.Time
 }
 
 // NewNewDomainTransform creates a new instance of the transformer
@@ -131,11 +303,15 @@ func NewNewDomainTrackerTransform(config *pkgconfig.ConfigTransformers, logger *
 func (t *NewDomainTrackerTransform) ReloadConfig(config *pkgconfig.ConfigTransformers) {
 	t.GenericTransformer.ReloadConfig(config)
 	ttl := time.Duration(config.NewDomainTracker.TTL) * time.Second
-	t.domainTracker.ttl = ttl
+	if t.domainTracker != nil {
+		t.domainTracker.SetTTL(ttl)
+	}
 	t.LogInfo("new-domain-transformer configuration reloaded")
 }
 
 func (t *NewDomainTrackerTransform) GetTransforms() ([]Subtransform, error) {
+	t.stopCheckpoints()
+
 	subtransforms := []Subtransform{}
 	if t.config.NewDomainTracker.Enable {
 		// init whitelist
@@ -145,18 +321,66 @@ func (t *NewDomainTrackerTransform) GetTransforms() ([]Subtransform, error) {
 
 		// Initialize the domain tracker
 		ttl := time.Duration(t.config.NewDomainTracker.TTL) * time.Second
-		maxSize := t.config.NewDomainTracker.CacheSize
-		tracker, err := NewNewDomainTracker(ttl, maxSize, t.listDomainsRegex, t.config.NewDomainTracker.PersistenceFile, t.LogInfo, t.LogError)
+		persistenceFile := t.config.NewDomainTracker.PersistenceFile
+
+		var tracker *NewDomainTracker
+		var err error
+		switch t.config.NewDomainTracker.Store {
+		case dnsutils.NewDomainStoreLRU:
+			maxSize := t.config.NewDomainTracker.CacheSize
+			tracker, err = NewNewDomainTracker(ttl, maxSize, t.listDomainsRegex, persistenceFile, t.LogInfo, t.LogError)
+		case dnsutils.NewDomainStoreBloom:
+			capacity := uint64(t.config.NewDomainTracker.BloomCapacity)
+			tracker, err = NewBloomDomainTracker(ttl, capacity, t.config.NewDomainTracker.BloomErrorRate, t.listDomainsRegex, persistenceFile, t.LogInfo, t.LogError)
+		default:
+			err = fmt.Errorf("invalid store %s", t.config.NewDomainTracker.Store)
+		}
 		if err != nil {
 			return nil, err
 		}
 		t.domainTracker = tracker
 
+		if len(persistenceFile) > 0 && t.config.NewDomainTracker.CheckpointInterval > 0 {
+			t.stopCheckpoint = make(chan struct{})
+			t.checkpointDone = make(chan struct{})
+			interval := time.Duration(t.config.NewDomainTracker.CheckpointInterval) * time.Second
+			go t.checkpointPeriodically(tracker, interval, t.stopCheckpoint, t.checkpointDone)
+		}
+
 		subtransforms = append(subtransforms, Subtransform{name: "new-domain-tracker:detect", processFunc: t.trackNewDomain})
 	}
 	return subtransforms, nil
 }
 
+// stopCheckpoints waits for the end of the checkpoint in progress
+func (t *NewDomainTrackerTransform) stopCheckpoints() {
+	if t.stopCheckpoint != nil {
+		close(t.stopCheckpoint)
+		<-t.checkpointDone
+		t.stopCheckpoint = nil
+		t.checkpointDone = nil
+	}
+}
+
+// checkpointPeriodically saves the state on disk to limit the loss in case of crash
+func (t *NewDomainTrackerTransform) checkpointPeriodically(tracker *NewDomainTracker, interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := tracker.SaveCacheToDisk(); err != nil {
+				t.LogError("checkpoint failed: %v", err)
+				continue
+			}
+			t.LogInfo("checkpoint saved with %d entries", tracker.Len())
+		}
+	}
+}
 func (t *NewDomainTrackerTransform) LoadWhiteDomainsList() error {
 	// before to start, reset all maps
 	for key := range t.listDomainsRegex {
@@ -182,22 +406,71 @@ func (t *NewDomainTrackerTransform) LoadWhiteDomainsList() error {
 
 // Process processes DNS messages and detects newly observed domains
 func (t *NewDomainTrackerTransform) trackNewDomain(dm *dnsutils.DNSMessage) (int, error) {
-	// Log a warning if the cache is full (before adding the new domain)
-	if t.domainTracker.cache.Len() == t.config.NewDomainTracker.CacheSize {
-		return ReturnError, fmt.Errorf("LRU cache is full. Consider increasing cache-size to avoid frequent evictions")
+	// Log a warning if the cache is full (before adding the new domain), the oldest keys are evicted
+	if t.domainTracker.bloom == nil && time.Since(t.lastFullWarning) > newDomainFullWarningInterval && t.domainTracker.IsFull() {
+		t.lastFullWarning = time.Now()
+		t.LogError("LRU cache is full. Consider increasing cache-size to avoid frequent evictions")
+	}
+
+	// Whitelisted domains are never new
+	if t.domainTracker.isWhitelisted(dm.DNS.Qname) {
+		return ReturnDrop, nil
+	}
+
+	seen := time.Now()
+	if dm.DNSTap.TimeSec > 0 {
+		seen = time.Unix(int64(dm.DNSTap.TimeSec), int64(dm.DNSTap.TimeNsec))
 	}
 
+	result := &dnsutils.TransformNewDomain{QnameFirstSeen: "-", ClientFirstSeen: "-", ETLDPlusOneFirstSeen: "-"}
+	var firstSeen time.Time
+
 	// Check if the domain is newly observed
-	if t.domainTracker.IsNewDomain(dm.DNS.Qname) {
+	result.NewQname, firstSeen = t.domainTracker.FirstSeen(dm.DNS.Qname, seen)
+	result.QnameFirstSeen = formatFirstSeen(firstSeen)
+
+	// and by this client
+	if t.config.NewDomainTracker.TrackClients {
+		key := newDomainKeyClient + dm.NetworkInfo.QueryIP + "|" + dm.DNS.Qname
+		result.NewForClient, firstSeen = t.domainTracker.FirstSeen(key, seen)
+		result.ClientFirstSeen = formatFirstSeen(firstSeen)
+	}
+
+	// the registered domain
+	if t.config.NewDomainTracker.TrackETLDPlusOne {
+		etldPlusOne := ""
+		if dm.PublicSuffix != nil && dm.PublicSuffix.QnameEffectiveTLDPlusOne != "-" {
+			etldPlusOne = dm.PublicSuffix.QnameEffectiveTLDPlusOne
+		}
+		if len(etldPlusOne) == 0 {
+			etldPlusOne, _ = publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(dm.DNS.Qname, "."))
+		}
+		if len(etldPlusOne) > 0 {
+			result.NewETLDPlusOne, firstSeen = t.domainTracker.FirstSeen(newDomainKeyETLDPlusOne+etldPlusOne, seen)
+			result.ETLDPlusOneFirstSeen = formatFirstSeen(firstSeen)
+		}
+	}
+	dm.NewDomain = result
+
+	if result.NewQname || result.NewForClient || result.NewETLDPlusOne {
 		return ReturnKeep, nil
 	}
 	return ReturnDrop, nil
 }
 
+func formatFirstSeen(firstSeen time.Time) string {
+	if firstSeen.IsZero() {
+		return "-"
+	}
+	return firstSeen.UTC().Format(time.RFC3339Nano)
+}
+
 func (t *NewDomainTrackerTransform) Reset() {
-	if len(t.domainTracker.persistencePath) != 0 {
+	t.stopCheckpoints()
+	if t.domainTracker != nil && len(t.domainTracker.persistencePath) != 0 {
 		if err := t.domainTracker.SaveCacheToDisk(); err != nil {
 			t.LogError("failed to save cache state: %v", err)
+			return
 		}
 		t.LogInfo("cache content saved on disk with success")
 	}
@@ -0,0 +1,251 @@
+package transformers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	bloomFileMagic   = "NDTBLOOM"
+	bloomFileVersion = uint32(1)
+
+	// each new filter doubles the capacity and halves the error rate,
+	// the error rate of the scalable filter stays below the configured one
+	bloomGrowth     = 2
+	bloomTightening = 0.5
+)
+
+// bloomHash returns the two hashes used to compute the k positions (Kirsch-Mitzenmacher),
+// the hash function is stable to reload the filters saved on disk
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+// BloomFilter is a fixed size filter
+type BloomFilter struct {
+	bits     []uint64
+	m        uint64
+	k        uint32
+	count    uint64
+	capacity uint64
+}
+
+func NewBloomFilter(capacity uint64, errorRate float64) *BloomFilter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Ceil(math.Ln2 * float64(m) / float64(capacity)))
+	if k == 0 {
+		k = 1
+	}
+	return &BloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k, capacity: capacity}
+}
+
+func (f *BloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < uint64(f.k); i++ {
+		pos := (h1 + i*h2) % f.m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+	f.count++
+}
+
+func (f *BloomFilter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < uint64(f.k); i++ {
+		pos := (h1 + i*h2) % f.m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ScalableBloomFilter adds a larger filter when the last one is full (Almeida et al.)
+type ScalableBloomFilter struct {
+	filters   []*BloomFilter
+	capacity  uint64
+	errorRate float64
+}
+
+func NewScalableBloomFilter(capacity uint64, errorRate float64) *ScalableBloomFilter {
+	return &ScalableBloomFilter{capacity: capacity, errorRate: errorRate}
+}
+
+func (s *ScalableBloomFilter) test(h1, h2 uint64) bool {
+	for _, f := range s.filters {
+		if f.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ScalableBloomFilter) add(h1, h2 uint64) {
+	if len(s.filters) == 0 || s.filters[len(s.filters)-1].count >= s.filters[len(s.filters)-1].capacity {
+		n := len(s.filters)
+		capacity := s.capacity * uint64(math.Pow(bloomGrowth, float64(n)))
+		errorRate := s.errorRate * (1 - bloomTightening) * math.Pow(bloomTightening, float64(n))
+		s.filters = append(s.filters, NewBloomFilter(capacity, errorRate))
+	}
+	s.filters[len(s.filters)-1].add(h1, h2)
+}
+
+// Count returns the number of keys added
+func (s *ScalableBloomFilter) Count() uint64 {
+	var count uint64
+	for _, f := range s.filters {
+		count += f.count
+	}
+	return count
+}
+
+// SizeBytes returns the memory used by the bits
+func (s *ScalableBloomFilter) SizeBytes() uint64 {
+	var size uint64
+	for _, f := range s.filters {
+		size += uint64(len(f.bits)) * 8
+	}
+	return size
+}
+
+// RotatingBloomFilter forgets the keys with two generations of filters,
+// the current generation becomes the previous one after the ttl,
+// so a key is remembered between one and two ttl after it was added
+type RotatingBloomFilter struct {
+	current, previous *ScalableBloomFilter
+	rotatedAt         time.Time
+	ttl               time.Duration
+	capacity          uint64
+	errorRate         float64
+}
+
+func NewRotatingBloomFilter(ttl time.Duration, capacity uint64, errorRate float64) (*RotatingBloomFilter, error) {
+	if capacity == 0 {
+		return nil, errors.New("the capacity must be greater than 0")
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		return nil, fmt.Errorf("invalid error rate: %v", errorRate)
+	}
+	return &RotatingBloomFilter{
+		current:   NewScalableBloomFilter(capacity, errorRate),
+		previous:  NewScalableBloomFilter(capacity, errorRate),
+		rotatedAt: time.Now(),
+		ttl:       ttl,
+		capacity:  capacity,
+		errorRate: errorRate,
+	}, nil
+}
+
+func (r *RotatingBloomFilter) rotate(now time.Time) {
+	elapsed := now.Sub(r.rotatedAt)
+	if elapsed < r.ttl {
+		return
+	}
+	if elapsed >= 2*r.ttl {
+		r.previous = NewScalableBloomFilter(r.capacity, r.errorRate)
+	} else {
+		r.previous = r.current
+	}
+	r.current = NewScalableBloomFilter(r.capacity, r.errorRate)
+	r.rotatedAt = now
+}
+
+// TestAndAdd returns true when the key is already known, otherwise the key is added
+func (r *RotatingBloomFilter) TestAndAdd(key string, now time.Time) bool {
+	r.rotate(now)
+
+	h1, h2 := bloomHash(key)
+	if r.current.test(h1, h2) || r.previous.test(h1, h2) {
+		return true
+	}
+	r.current.add(h1, h2)
+	return false
+}
+
+// Count returns the approximate number of keys remembered
+func (r *RotatingBloomFilter) Count() uint64 {
+	return r.current.Count() + r.previous.Count()
+}
+
+func (r *RotatingBloomFilter) SizeBytes() uint64 {
+	return r.current.SizeBytes() + r.previous.SizeBytes()
+}
+
+// Save writes the filters in a compact binary format
+func (r *RotatingBloomFilter) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range []interface{}{[]byte(bloomFileMagic), bloomFileVersion, r.rotatedAt.UnixNano()} {
+		if err := binary.Write(bw, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	for _, s := range []*ScalableBloomFilter{r.current, r.previous} {
+		if err := binary.Write(bw, binary.BigEndian, uint32(len(s.filters))); err != nil {
+			return err
+		}
+		for _, f := range s.filters {
+			for _, v := range []interface{}{f.m, f.k, f.count, f.capacity, f.bits} {
+				if err := binary.Write(bw, binary.BigEndian, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// Load reads the filters, the next filters are created with the capacity and the error rate of the configuration
+func (r *RotatingBloomFilter) Load(rd io.Reader) error {
+	br := bufio.NewReader(rd)
+
+	magic := make([]byte, len(bloomFileMagic))
+	var version uint32
+	var rotatedAt int64
+	for _, v := range []interface{}{magic, &version, &rotatedAt} {
+		if err := binary.Read(br, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	if string(magic) != bloomFileMagic || version != bloomFileVersion {
+		return errors.New("invalid bloom filter file")
+	}
+
+	generations := make([]*ScalableBloomFilter, 2)
+	for i := range generations {
+		var n uint32
+		if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+			return err
+		}
+		s := NewScalableBloomFilter(r.capacity, r.errorRate)
+		for j := uint32(0); j < n; j++ {
+			f := &BloomFilter{}
+			for _, v := range []interface{}{&f.m, &f.k, &f.count, &f.capacity} {
+				if err := binary.Read(br, binary.BigEndian, v); err != nil {
+					return err
+				}
+			}
+			if f.m == 0 || f.k == 0 {
+				return errors.New("invalid bloom filter file")
+			}
+			f.bits = make([]uint64, (f.m+63)/64)
+			if err := binary.Read(br, binary.BigEndian, f.bits); err != nil {
+				return err
+			}
+			s.filters = append(s.filters, f)
+		}
+		generations[i] = s
+	}
+
+	r.current, r.previous = generations[0], generations[1]
+	r.rotatedAt = time.Unix(0, rotatedAt)
+	return nil
+}
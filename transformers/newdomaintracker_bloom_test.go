@@ -0,0 +1,91 @@
+package transformers
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRotatingBloomFilter_ErrorRate(t *testing.T) {
+	// the filter is scaled several times
+	bloom, err := NewRotatingBloomFilter(time.Hour, 1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 20000; i++ {
+		bloom.TestAndAdd(fmt.Sprintf("domain%d.com", i), now)
+	}
+	if len(bloom.current.filters) < 4 {
+		t.Errorf("the filter is not scaled: %d filters", len(bloom.current.filters))
+	}
+	for i := 0; i < 20000; i++ {
+		if !bloom.TestAndAdd(fmt.Sprintf("domain%d.com", i), now) {
+			t.Fatalf("domain%d.com forgotten", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 20000; i++ {
+		if bloom.TestAndAdd(fmt.Sprintf("unknown%d.com", i), now) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 20000; rate > 0.01 {
+		t.Errorf("false positive rate too high: %f", rate)
+	}
+}
+
+func TestRotatingBloomFilter_Rotation(t *testing.T) {
+	bloom, _ := NewRotatingBloomFilter(time.Hour, 100, 0.001)
+	now := bloom.rotatedAt
+
+	bloom.TestAndAdd("first.com", now)
+
+	// remembered after one rotation
+	now = now.Add(90 * time.Minute)
+	if !bloom.TestAndAdd("first.com", now) {
+		t.Errorf("first.com forgotten after one rotation")
+	}
+
+	// forgotten after two rotations
+	now = now.Add(90 * time.Minute)
+	if bloom.TestAndAdd("first.com", now) {
+		t.Errorf("first.com not forgotten after two rotations")
+	}
+}
+
+func TestRotatingBloomFilter_SaveLoad(t *testing.T) {
+	bloom, _ := NewRotatingBloomFilter(time.Hour, 100, 0.001)
+	for i := 0; i < 500; i++ {
+		bloom.TestAndAdd(fmt.Sprintf("domain%d.com", i), time.Now())
+	}
+
+	var buf bytes.Buffer
+	if err := bloom.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, _ := NewRotatingBloomFilter(time.Hour, 100, 0.001)
+	if err := loaded.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Count() != 500 || !loaded.rotatedAt.Equal(bloom.rotatedAt) {
+		t.Errorf("invalid state loaded: %d entries", loaded.Count())
+	}
+	for i := 0; i < 500; i++ {
+		if !loaded.TestAndAdd(fmt.Sprintf("domain%d.com", i), time.Now()) {
+			t.Fatalf("domain%d.com not loaded", i)
+		}
+	}
+
+	// invalid content
+	if err := loaded.Load(bytes.NewReader([]byte("invalid content"))); err == nil {
+		t.Errorf("error expected")
+	}
+	if err := loaded.Load(bytes.NewReader(buf.Bytes()[:buf.Len()/2])); err == nil {
+		t.Errorf("error expected for truncated file")
+	}
+}
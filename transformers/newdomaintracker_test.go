@@ -1,6 +1,10 @@
 package transformers
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
@@ -75,6 +79,37 @@ func TestNewDomainTracker_Whitelist(t *testing.T) {
 	}
 }
 
+func TestNewDomainTracker_CachePerKeyFamily(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.NewDomainTracker.Enable = true
+	config.NewDomainTracker.CacheSize = 2
+	config.NewDomainTracker.TrackClients = true
+	config.NewDomainTracker.TrackETLDPlusOne = true
+
+	tracker := NewNewDomainTrackerTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := tracker.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client and etld+1 keys don't evict the qnames
+	for _, qname := range []string{"www.example.com", "www.example.org"} {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = qname
+		if result, _ := tracker.trackNewDomain(&dm); result != ReturnKeep {
+			t.Errorf("%s should be new", qname)
+		}
+	}
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "www.example.com"
+	if result, _ := tracker.trackNewDomain(&dm); result != ReturnDrop {
+		t.Errorf("www.example.com should be known")
+	}
+	if n := tracker.domainTracker.Len(); n != 6 {
+		t.Errorf("want 6 keys, got %d", n)
+	}
+}
+
 func TestNewDomainTracker_LRUCacheFull(t *testing.T) {
 	// config
 	config := pkgconfig.GetFakeConfigTransformers()
@@ -99,10 +134,13 @@ func TestNewDomainTracker_LRUCacheFull(t *testing.T) {
 		t.Errorf("This domain should be new!")
 	}
 
-	// Send the same domain again (should return an error because cache is full)
+	// Send the same domain again, the cache is full but the message is processed
 	result, _ := tracker.trackNewDomain(&dm)
-	if result != ReturnError {
-		t.Errorf("Cache full check failed, expected ReturnError")
+	if result != ReturnDrop {
+		t.Errorf("Cache full check failed, expected ReturnDrop")
+	}
+	if !tracker.domainTracker.IsFull() {
+		t.Errorf("the cache should be full")
 	}
 
 	// Wait for TTL expiration
@@ -113,3 +151,172 @@ func TestNewDomainTracker_LRUCacheFull(t *testing.T) {
 		t.Errorf("recheck, this domain should be new!!")
 	}
 }
+
+func TestNewDomainTracker_ClientsAndETLDPlusOne(t *testing.T) {
+	for _, store := range []string{dnsutils.NewDomainStoreLRU, dnsutils.NewDomainStoreBloom} {
+		t.Run(store, func(t *testing.T) {
+			config := pkgconfig.GetFakeConfigTransformers()
+			config.NewDomainTracker.Enable = true
+			config.NewDomainTracker.Store = store
+			config.NewDomainTracker.TrackClients = true
+			config.NewDomainTracker.TrackETLDPlusOne = true
+
+			tracker := NewNewDomainTrackerTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+			if _, err := tracker.GetTransforms(); err != nil {
+				t.Fatal(err)
+			}
+
+			newMessage := func(client, qname string) dnsutils.DNSMessage {
+				dm := dnsutils.GetFakeDNSMessage()
+				dm.NetworkInfo.QueryIP = client
+				dm.DNS.Qname = qname
+				dm.DNSTap.TimeSec = 1700000000
+				return dm
+			}
+
+			// everything is new
+			dm := newMessage("10.0.0.1", "www.example.com")
+			if result, _ := tracker.trackNewDomain(&dm); result != ReturnKeep {
+				t.Errorf("message should be kept")
+			}
+			if !dm.NewDomain.NewQname || !dm.NewDomain.NewForClient || !dm.NewDomain.NewETLDPlusOne {
+				t.Errorf("everything should be new %+v", dm.NewDomain)
+			}
+			if dm.NewDomain.QnameFirstSeen != "2023-11-14T22:13:20Z" {
+				t.Errorf("invalid first seen %s", dm.NewDomain.QnameFirstSeen)
+			}
+
+			// new for this client only
+			dm = newMessage("10.0.0.2", "www.example.com")
+			if result, _ := tracker.trackNewDomain(&dm); result != ReturnKeep {
+				t.Errorf("message should be kept")
+			}
+			if dm.NewDomain.NewQname || !dm.NewDomain.NewForClient || dm.NewDomain.NewETLDPlusOne {
+				t.Errorf("only new for the client %+v", dm.NewDomain)
+			}
+
+			// new subdomain of a known registered domain
+			dm = newMessage("10.0.0.2", "mail.example.com")
+			tracker.trackNewDomain(&dm)
+			if !dm.NewDomain.NewQname || dm.NewDomain.NewETLDPlusOne {
+				t.Errorf("only the qname should be new %+v", dm.NewDomain)
+			}
+
+			// nothing is new
+			dm = newMessage("10.0.0.1", "www.example.com")
+			dm.DNSTap.TimeSec += 60
+			if result, _ := tracker.trackNewDomain(&dm); result != ReturnDrop {
+				t.Errorf("message should be dropped")
+			}
+			// the first time is only known with the lru cache
+			want := "2023-11-14T22:13:20Z"
+			if store == dnsutils.NewDomainStoreBloom {
+				want = "-"
+			}
+			if dm.NewDomain.QnameFirstSeen != want || dm.NewDomain.ClientFirstSeen != want {
+				t.Errorf("invalid first seen %+v", dm.NewDomain)
+			}
+		})
+	}
+}
+
+func TestNewDomainTracker_Checkpoint(t *testing.T) {
+	for _, store := range []string{dnsutils.NewDomainStoreLRU, dnsutils.NewDomainStoreBloom} {
+		t.Run(store, func(t *testing.T) {
+			config := pkgconfig.GetFakeConfigTransformers()
+			config.NewDomainTracker.Enable = true
+			config.NewDomainTracker.Store = store
+			config.NewDomainTracker.PersistenceFile = filepath.Join(t.TempDir(), "state")
+			config.NewDomainTracker.CheckpointInterval = 1
+
+			tracker := NewNewDomainTrackerTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+			if _, err := tracker.GetTransforms(); err != nil {
+				t.Fatal(err)
+			}
+			dm := dnsutils.GetFakeDNSMessage()
+			tracker.trackNewDomain(&dm)
+
+			// wait the checkpoint, without stopping the transform
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				if _, err := os.Stat(config.NewDomainTracker.PersistenceFile); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("no checkpoint")
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			tracker.stopCheckpoints()
+
+			// the domain is known after a restart
+			restarted := NewNewDomainTrackerTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+			if _, err := restarted.GetTransforms(); err != nil {
+				t.Fatal(err)
+			}
+			defer restarted.Reset()
+			dm = dnsutils.GetFakeDNSMessage()
+			if result, _ := restarted.trackNewDomain(&dm); result != ReturnDrop {
+				t.Errorf("the domain should be known after a restart")
+			}
+		})
+	}
+}
+
+func TestNewDomainTracker_ConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state")
+	noLog := func(msg string, v ...interface{}) {}
+
+	// several instances share the same persistence file
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		tracker, err := NewNewDomainTracker(time.Hour, 100, map[string]*regexp.Regexp{}, path, noLog, noLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker.IsNewDomain("dns.collector")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := tracker.SaveCacheToDisk(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the state is valid and the temporary files are removed
+	tracker, err := NewNewDomainTracker(time.Hour, 100, map[string]*regexp.Regexp{}, path, noLog, noLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracker.IsNewDomain("dns.collector") {
+		t.Errorf("the domain should be loaded from the state")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(files) != 0 {
+		t.Errorf("temporary files not removed: %v", files)
+	}
+}
+
+func TestNewDomainTracker_LoadLegacyState(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(file, []byte(`["dns.collector"]`), 0o644)
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.NewDomainTracker.Enable = true
+	config.NewDomainTracker.PersistenceFile = file
+
+	tracker := NewNewDomainTrackerTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := tracker.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	dm := dnsutils.GetFakeDNSMessage()
+	if result, _ := tracker.trackNewDomain(&dm); result != ReturnDrop {
+		t.Errorf("the domain of the previous format should be known")
+	}
+}
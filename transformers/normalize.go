@@ -41,7 +41,7 @@ func processRecords(records []dnsutils.DNSAnswer) {
 	for i := range records {
 		records[i].Name = strings.ToLower(records[i].Name)
 		switch records[i].Rdatatype {
-		case "CNAME", "SOA", "NS", "MX", "PTR", "SRV":
+		case "CNAME", "DNAME", "SOA", "NS", "MX", "PTR", "SRV":
 			records[i].Rdata = strings.ToLower(records[i].Rdata)
 		}
 	}
@@ -49,6 +49,7 @@ func processRecords(records []dnsutils.DNSAnswer) {
 
 type NormalizeTransform struct {
 	GenericTransformer
+	protectedBrands map[string]string
 }
 
 func NewNormalizeTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *NormalizeTransform {
@@ -76,6 +77,21 @@ func (t *NormalizeTransform) GetTransforms() ([]Subtransform, error) {
 	if t.config.Normalize.Enable && t.config.Normalize.AddTldPlusOne {
 		subprocessors = append(subprocessors, Subtransform{name: "normalize:add-etld+1", processFunc: t.GetEffectiveTldPlusOne})
 	}
+	if t.config.Normalize.Enable && t.config.Normalize.QnameUnicode {
+		subprocessors = append(subprocessors, Subtransform{name: "normalize:qname-unicode", processFunc: t.QnameToUnicode})
+	}
+	if t.config.Normalize.Enable && t.config.Normalize.CheckHomoglyphs {
+		// brands are indexed by skeleton
+		t.protectedBrands = make(map[string]string)
+		for _, brand := range t.config.Normalize.ProtectedBrands {
+			brand = strings.ToLower(strings.TrimSpace(brand))
+			if brand == "" || strings.Contains(brand, ".") {
+				return nil, fmt.Errorf("invalid protected brand: %q, a single label is expected", brand)
+			}
+			t.protectedBrands[homoglyphSkeleton(brand)] = brand
+		}
+		subprocessors = append(subprocessors, Subtransform{name: "normalize:check-homoglyphs", processFunc: t.CheckHomoglyphs})
+	}
 	return subprocessors, nil
 }
 
@@ -164,3 +180,37 @@ func (t *NormalizeTransform) GetEffectiveTldPlusOne(dm *dnsutils.DNSMessage) (in
 
 	return ReturnKeep, nil
 }
+
+func (t *NormalizeTransform) QnameToUnicode(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.IDN == nil {
+		dm.IDN = &dnsutils.TransformIDN{QnameUnicode: "-", Brand: "-"}
+	}
+	dm.IDN.QnameUnicode = qnameToUnicode(dm.DNS.Qname)
+	return ReturnKeep, nil
+}
+
+func (t *NormalizeTransform) CheckHomoglyphs(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.IDN == nil {
+		dm.IDN = &dnsutils.TransformIDN{QnameUnicode: "-", Brand: "-"}
+	}
+
+	for _, label := range strings.Split(qnameToUnicode(dm.DNS.Qname), ".") {
+		if isMixedScript(label) {
+			dm.IDN.MixedScript = true
+		}
+
+		// the brand can be a part of the label, like paypal-login
+		tokens := []string{label}
+		if strings.Contains(label, "-") {
+			tokens = append(tokens, strings.Split(label, "-")...)
+		}
+		for _, token := range tokens {
+			brand, found := t.protectedBrands[homoglyphSkeleton(token)]
+			if found && strings.ToLower(token) != brand {
+				dm.IDN.Confusable = true
+				dm.IDN.Brand = brand
+			}
+		}
+	}
+	return ReturnKeep, nil
+}
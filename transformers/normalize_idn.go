@@ -0,0 +1,102 @@
+package transformers
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// homoglyphs maps the characters looking like a latin letter or digit, the accents
+// and the compatibility forms (fullwidth, ligatures, ...) are removed before by the NFKD decomposition
+var homoglyphs = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i', 'ј': 'j', 'к': 'k',
+	'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x',
+	'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ь': 'b', 'ү': 'y', 'ɡ': 'g',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// armenian
+	'օ': 'o', 'ս': 'u', 'ց': 'g', 'հ': 'h', 'ո': 'n',
+	// latin letters and digits
+	'ı': 'i', 'ł': 'l', 'ø': 'o', 'đ': 'd', 'ħ': 'h', '0': 'o', '1': 'l',
+}
+
+// sequences of latin letters looking like another letter
+var homoglyphSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// scripts used together in the japanese, chinese and korean names
+var cjkScripts = map[string]bool{"Han": true, "Hiragana": true, "Katakana": true, "Hangul": true, "Bopomofo": true}
+
+// qnameToUnicode decodes the punycode labels (xn--), the invalid labels are kept
+func qnameToUnicode(qname string) string {
+	labels := strings.Split(qname, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+			continue
+		}
+		if decoded, err := idna.Punycode.ToUnicode(strings.ToLower(label)); err == nil {
+			labels[i] = decoded
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// homoglyphSkeleton returns the latin form of the label, two labels looking
+// the same have the same skeleton
+func homoglyphSkeleton(label string) string {
+	var builder strings.Builder
+	for _, r := range norm.NFKD.String(strings.ToLower(label)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if c, ok := homoglyphs[r]; ok {
+			r = c
+		}
+		builder.WriteRune(r)
+	}
+	return homoglyphSequences.Replace(builder.String())
+}
+
+// labelScript returns the script of the character, empty for the digits,
+// hyphens and others characters shared by all scripts
+func labelScript(r rune) string {
+	switch {
+	case r < unicode.MaxASCII:
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return "Latin"
+		}
+		return ""
+	case unicode.In(r, unicode.Common, unicode.Inherited):
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// isMixedScript returns true when the label mixes several scripts,
+// the latin script can be mixed with the chinese, japanese and korean scripts
+func isMixedScript(label string) bool {
+	scripts := map[string]bool{}
+	cjk := false
+	for _, r := range label {
+		script := labelScript(r)
+		switch {
+		case script == "":
+		case cjkScripts[script]:
+			cjk = true
+		default:
+			scripts[script] = true
+		}
+	}
+	if len(scripts) > 1 {
+		return true
+	}
+	return cjk && len(scripts) == 1 && !scripts["Latin"]
+}
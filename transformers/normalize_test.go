@@ -323,3 +323,116 @@ func BenchmarkNormalize_QuietText(b *testing.B) {
 		subprocessor.QuietText(&dm)
 	}
 }
+
+func TestNormalize_QnameUnicode(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Normalize.Enable = true
+	config.Normalize.QnameUnicode = true
+
+	outChans := []chan dnsutils.DNSMessage{}
+
+	// init the processor
+	normTransformer := NewNormalizeTransform(config, logger.New(false), "test", 0, outChans)
+
+	tt := []struct {
+		name  string
+		qname string
+		want  string
+	}{
+		{name: "ascii", qname: "www.google.com", want: "www.google.com"},
+		{name: "idn", qname: "www.xn--mnchen-3ya.de", want: "www.münchen.de"},
+		{name: "idn uppercase", qname: "XN--R8JZ45G.jp", want: "例え.jp"},
+		{name: "invalid punycode", qname: "xn--ab&.com", want: "xn--ab&.com"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = tc.qname
+
+			returnCode, err := normTransformer.QnameToUnicode(&dm)
+			if err != nil {
+				t.Errorf("process transform err %s", err.Error())
+			}
+			if returnCode != ReturnKeep {
+				t.Errorf("Return code is %v and not RETURN_KEEP (%v)", returnCode, ReturnKeep)
+			}
+			if dm.IDN.QnameUnicode != tc.want {
+				t.Errorf("Bad unicode qname, got: %s, expected: %s", dm.IDN.QnameUnicode, tc.want)
+			}
+			if dm.DNS.Qname != tc.qname {
+				t.Errorf("Qname must not be modified, got: %s", dm.DNS.Qname)
+			}
+		})
+	}
+}
+
+func TestNormalize_CheckHomoglyphs(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Normalize.Enable = true
+	config.Normalize.CheckHomoglyphs = true
+	config.Normalize.ProtectedBrands = []string{"PayPal", "apple", "microsoft"}
+
+	outChans := []chan dnsutils.DNSMessage{}
+
+	// init the processor
+	normTransformer := NewNormalizeTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := normTransformer.GetTransforms(); err != nil {
+		t.Fatalf("get transforms err %s", err.Error())
+	}
+
+	tt := []struct {
+		name        string
+		qname       string
+		mixedScript bool
+		confusable  bool
+		brand       string
+	}{
+		{name: "legitimate brand", qname: "www.paypal.com", brand: "-"},
+		{name: "not a brand", qname: "www.xn--mnchen-3ya.de", brand: "-"},
+		{name: "cyrillic a", qname: "xn--pypal-4ve.com", mixedScript: true, confusable: true, brand: "paypal"},
+		{name: "whole cyrillic label", qname: "xn--80ak6aa92e.com", confusable: true, brand: "apple"},
+		{name: "brand in label", qname: "xn--pypal-login-yij.com", mixedScript: true, confusable: true, brand: "paypal"},
+		{name: "ascii lookalike", qname: "rnicrosoft.com", confusable: true, brand: "microsoft"},
+		{name: "digit lookalike", qname: "paypa1.com", confusable: true, brand: "paypal"},
+		{name: "japanese", qname: "xn--r8jz45g.jp", brand: "-"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = tc.qname
+
+			returnCode, err := normTransformer.CheckHomoglyphs(&dm)
+			if err != nil {
+				t.Errorf("process transform err %s", err.Error())
+			}
+			if returnCode != ReturnKeep {
+				t.Errorf("Return code is %v and not RETURN_KEEP (%v)", returnCode, ReturnKeep)
+			}
+			if dm.IDN.MixedScript != tc.mixedScript {
+				t.Errorf("Bad mixed script flag, got: %v, expected: %v", dm.IDN.MixedScript, tc.mixedScript)
+			}
+			if dm.IDN.Confusable != tc.confusable {
+				t.Errorf("Bad confusable flag, got: %v, expected: %v", dm.IDN.Confusable, tc.confusable)
+			}
+			if dm.IDN.Brand != tc.brand {
+				t.Errorf("Bad brand, got: %s, expected: %s", dm.IDN.Brand, tc.brand)
+			}
+		})
+	}
+}
+
+func TestNormalize_InvalidProtectedBrand(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Normalize.Enable = true
+	config.Normalize.CheckHomoglyphs = true
+	config.Normalize.ProtectedBrands = []string{"paypal.com"}
+
+	normTransformer := NewNormalizeTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := normTransformer.GetTransforms(); err == nil {
+		t.Errorf("error expected for a brand with several labels")
+	}
+}
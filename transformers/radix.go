@@ -0,0 +1,81 @@
+package transformers
+
+import (
+	"inet.af/netaddr"
+)
+
+type radixNode[V any] struct {
+	children [2]*radixNode[V]
+	value    V
+	set      bool
+}
+
+// IPRadixTree is a binary radix tree of IPv4 and IPv6 prefixes,
+// the lookup returns the value of the longest matching prefix
+type IPRadixTree[V any] struct {
+	v4   radixNode[V]
+	v6   radixNode[V]
+	size int
+}
+
+func NewIPRadixTree[V any]() *IPRadixTree[V] {
+	return &IPRadixTree[V]{}
+}
+
+func (t *IPRadixTree[V]) Len() int {
+	return t.size
+}
+
+func (t *IPRadixTree[V]) root(addr netaddr.IP) *radixNode[V] {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+func addrBit(addr netaddr.IP, i int) int {
+	if addr.Is4() {
+		b := addr.As4()
+		return int(b[i/8]>>(7-i%8)) & 1
+	}
+	b := addr.As16()
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+// Insert adds or replaces the value of the prefix
+func (t *IPRadixTree[V]) Insert(prefix netaddr.IPPrefix, value V) {
+	prefix = prefix.Masked()
+	addr := prefix.IP()
+	node := t.root(addr)
+	for i := 0; i < int(prefix.Bits()); i++ {
+		bit := addrBit(addr, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &radixNode[V]{}
+		}
+		node = node.children[bit]
+	}
+	if !node.set {
+		t.size++
+	}
+	node.value = value
+	node.set = true
+}
+
+// Lookup returns the value of the longest prefix containing the address
+func (t *IPRadixTree[V]) Lookup(addr netaddr.IP) (V, bool) {
+	addr = addr.Unmap()
+	node := t.root(addr)
+
+	var value V
+	found := false
+	for i := 0; node != nil; i++ {
+		if node.set {
+			value, found = node.value, true
+		}
+		if i == int(addr.BitLen()) {
+			break
+		}
+		node = node.children[addrBit(addr, i)]
+	}
+	return value, found
+}
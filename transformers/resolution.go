@@ -0,0 +1,129 @@
+package transformers
+
+import (
+	"strings"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+// resolutionName returns the name used to compare the owners and the targets
+func resolutionName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+type ResolutionTransform struct {
+	GenericTransformer
+}
+
+func NewResolutionTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *ResolutionTransform {
+	t := &ResolutionTransform{GenericTransformer: NewTransformer(config, logger, "resolution", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *ResolutionTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if t.config.Resolution.Enable {
+		subtransforms = append(subtransforms, Subtransform{name: "resolution:flatten-chain", processFunc: t.flattenChain})
+	}
+	return subtransforms, nil
+}
+
+// flattenChain follows the CNAME and DNAME records from the qname to the final name,
+// the records can be in any order in the answer section
+func (t *ResolutionTransform) flattenChain(dm *dnsutils.DNSMessage) (int, error) {
+	resolution := &dnsutils.TransformResolution{CNAMEChain: []string{}, ResolvedIPs: []string{}}
+	dm.Resolution = resolution
+
+	answers := dm.DNS.DNSRRs.Answers
+	cnames := make(map[string]int)
+	dnames := []int{}
+	for i, rr := range answers {
+		switch rr.Rdatatype {
+		case "CNAME":
+			// only one CNAME is allowed per name
+			if _, found := cnames[resolutionName(rr.Name)]; found {
+				resolution.Broken = true
+				continue
+			}
+			cnames[resolutionName(rr.Name)] = i
+		case "DNAME":
+			dnames = append(dnames, i)
+		}
+	}
+
+	used := make(map[int]bool)
+	name := resolutionName(dm.DNS.Qname)
+	visited := map[string]bool{name: true}
+	for {
+		next := ""
+		if i, found := cnames[name]; found {
+			next = resolutionName(answers[i].Rdata)
+			used[i] = true
+		} else if i, found := t.matchDNAME(answers, dnames, name); found {
+			// the owner of the dname is replaced by the target
+			owner := resolutionName(answers[i].Name)
+			next = strings.TrimSuffix(name, owner) + resolutionName(answers[i].Rdata)
+			used[i] = true
+		} else {
+			break
+		}
+
+		// loops and long chains are not followed
+		if visited[next] || len(resolution.CNAMEChain) >= t.config.Resolution.MaxChainLength {
+			resolution.Broken = true
+			break
+		}
+		visited[next] = true
+		resolution.CNAMEChain = append(resolution.CNAMEChain, next)
+		name = next
+	}
+	resolution.FinalName = name
+
+	for i, rr := range answers {
+		switch {
+		case rr.Rdatatype == "DNAME":
+			// the dnames can be used or synthesized as cnames
+		case rr.Rdatatype != "CNAME" && resolutionName(rr.Name) == name:
+			used[i] = true
+			if rr.Rdatatype == "A" || rr.Rdatatype == "AAAA" {
+				resolution.ResolvedIPs = append(resolution.ResolvedIPs, rr.Rdata)
+			}
+		case !used[i]:
+			// the record is not reachable from the qname
+			resolution.Broken = true
+		}
+	}
+
+	first := true
+	for i, rr := range answers {
+		if !used[i] {
+			continue
+		}
+		if first || rr.TTL < resolution.MinTTL {
+			resolution.MinTTL = rr.TTL
+		}
+		if first || rr.TTL > resolution.MaxTTL {
+			resolution.MaxTTL = rr.TTL
+		}
+		first = false
+	}
+
+	return ReturnKeep, nil
+}
+
+// matchDNAME returns the dname with the longest owner redirecting the name
+func (t *ResolutionTransform) matchDNAME(answers []dnsutils.DNSAnswer, dnames []int, name string) (int, bool) {
+	match, found := 0, false
+	for _, i := range dnames {
+		owner := resolutionName(answers[i].Name)
+		if !strings.HasSuffix(name, "."+owner) {
+			continue
+		}
+		if !found || len(owner) > len(resolutionName(answers[match].Name)) {
+			match, found = i, true
+		}
+	}
+	return match, found
+}
@@ -0,0 +1,185 @@
+package transformers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestResolution_FlattenChain(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Resolution.Enable = true
+	config.Resolution.MaxChainLength = 3
+
+	outChans := []chan dnsutils.DNSMessage{}
+
+	// init the processor
+	resolution := NewResolutionTransform(config, logger.New(false), "test", 0, outChans)
+
+	tt := []struct {
+		name      string
+		qname     string
+		answers   []dnsutils.DNSAnswer
+		finalName string
+		chain     []string
+		ips       []string
+		minTTL    int
+		maxTTL    int
+		broken    bool
+	}{
+		{
+			name:      "no answer",
+			qname:     "www.example.com",
+			finalName: "www.example.com",
+			chain:     []string{},
+			ips:       []string{},
+		},
+		{
+			name:  "direct answer",
+			qname: "www.example.com.",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "www.example.com", Rdatatype: "A", TTL: 300, Rdata: "192.0.2.1"},
+				{Name: "www.example.com", Rdatatype: "A", TTL: 300, Rdata: "192.0.2.2"},
+			},
+			finalName: "www.example.com",
+			chain:     []string{},
+			ips:       []string{"192.0.2.1", "192.0.2.2"},
+			minTTL:    300,
+			maxTTL:    300,
+		},
+		{
+			name:  "out of order chain",
+			qname: "WWW.example.com",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "edge.cdn.net", Rdatatype: "AAAA", TTL: 20, Rdata: "2001:db8::1"},
+				{Name: "www.example.cdn.net", Rdatatype: "CNAME", TTL: 60, Rdata: "edge.cdn.net"},
+				{Name: "www.example.com", Rdatatype: "CNAME", TTL: 3600, Rdata: "www.example.CDN.net"},
+			},
+			finalName: "edge.cdn.net",
+			chain:     []string{"www.example.cdn.net", "edge.cdn.net"},
+			ips:       []string{"2001:db8::1"},
+			minTTL:    20,
+			maxTTL:    3600,
+		},
+		{
+			name:  "dname",
+			qname: "www.example.com",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "example.com", Rdatatype: "DNAME", TTL: 600, Rdata: "example.net"},
+				{Name: "www.example.net", Rdatatype: "A", TTL: 60, Rdata: "192.0.2.1"},
+			},
+			finalName: "www.example.net",
+			chain:     []string{"www.example.net"},
+			ips:       []string{"192.0.2.1"},
+			minTTL:    60,
+			maxTTL:    600,
+		},
+		{
+			name:  "dname with synthesized cname",
+			qname: "www.example.com",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "example.com", Rdatatype: "DNAME", TTL: 600, Rdata: "example.net"},
+				{Name: "www.example.com", Rdatatype: "CNAME", TTL: 600, Rdata: "www.example.net"},
+				{Name: "www.example.net", Rdatatype: "A", TTL: 60, Rdata: "192.0.2.1"},
+			},
+			finalName: "www.example.net",
+			chain:     []string{"www.example.net"},
+			ips:       []string{"192.0.2.1"},
+			minTTL:    60,
+			maxTTL:    600,
+		},
+		{
+			name:  "dangling chain",
+			qname: "www.example.com",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "www.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "www.example.net"},
+			},
+			finalName: "www.example.net",
+			chain:     []string{"www.example.net"},
+			ips:       []string{},
+			minTTL:    300,
+			maxTTL:    300,
+		},
+		{
+			name:  "unreachable records",
+			qname: "www.example.com",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "www.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "www.example.net"},
+				{Name: "other.example.net", Rdatatype: "A", TTL: 60, Rdata: "192.0.2.1"},
+			},
+			finalName: "www.example.net",
+			chain:     []string{"www.example.net"},
+			ips:       []string{},
+			minTTL:    300,
+			maxTTL:    300,
+			broken:    true,
+		},
+		{
+			name:  "loop",
+			qname: "a.example.com",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "a.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "b.example.com"},
+				{Name: "b.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "a.example.com"},
+			},
+			finalName: "b.example.com",
+			chain:     []string{"b.example.com"},
+			ips:       []string{},
+			minTTL:    300,
+			maxTTL:    300,
+			broken:    true,
+		},
+		{
+			name:  "too long chain",
+			qname: "a.example.com",
+			answers: []dnsutils.DNSAnswer{
+				{Name: "a.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "b.example.com"},
+				{Name: "b.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "c.example.com"},
+				{Name: "c.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "d.example.com"},
+				{Name: "d.example.com", Rdatatype: "CNAME", TTL: 300, Rdata: "e.example.com"},
+				{Name: "e.example.com", Rdatatype: "A", TTL: 300, Rdata: "192.0.2.1"},
+			},
+			finalName: "d.example.com",
+			chain:     []string{"b.example.com", "c.example.com", "d.example.com"},
+			ips:       []string{},
+			minTTL:    300,
+			maxTTL:    300,
+			broken:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = tc.qname
+			dm.DNS.DNSRRs.Answers = tc.answers
+
+			returnCode, err := resolution.flattenChain(&dm)
+			if err != nil {
+				t.Errorf("process transform err %s", err.Error())
+			}
+			if returnCode != ReturnKeep {
+				t.Errorf("Return code is %v and not RETURN_KEEP (%v)", returnCode, ReturnKeep)
+			}
+
+			if dm.Resolution.FinalName != tc.finalName {
+				t.Errorf("Bad final name, got: %s, expected: %s", dm.Resolution.FinalName, tc.finalName)
+			}
+			if !reflect.DeepEqual(dm.Resolution.CNAMEChain, tc.chain) {
+				t.Errorf("Bad chain, got: %v, expected: %v", dm.Resolution.CNAMEChain, tc.chain)
+			}
+			if !reflect.DeepEqual(dm.Resolution.ResolvedIPs, tc.ips) {
+				t.Errorf("Bad resolved ips, got: %v, expected: %v", dm.Resolution.ResolvedIPs, tc.ips)
+			}
+			if dm.Resolution.MinTTL != tc.minTTL || dm.Resolution.MaxTTL != tc.maxTTL {
+				t.Errorf("Bad ttl, got: %d/%d, expected: %d/%d", dm.Resolution.MinTTL, dm.Resolution.MaxTTL, tc.minTTL, tc.maxTTL)
+			}
+			if dm.Resolution.Broken != tc.broken {
+				t.Errorf("Bad broken flag, got: %v, expected: %v", dm.Resolution.Broken, tc.broken)
+			}
+		})
+	}
+}
@@ -1,17 +1,35 @@
 package transformers
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
 )
 
+// rewriteValue is the new value of a field, the templates are rendered with the DNS message
+type rewriteValue struct {
+	key      string
+	value    interface{}
+	template *template.Template
+}
+
+type rewriteRule struct {
+	match  map[string]interface{}
+	values []rewriteValue
+}
+
 type RewriteTransform struct {
 	GenericTransformer
+	rules []rewriteRule
 }
 
 func NewRewriteTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *RewriteTransform {
@@ -21,46 +39,193 @@ func NewRewriteTransform(config *pkgconfig.ConfigTransformers, logger *logger.Lo
 
 func (t *RewriteTransform) GetTransforms() ([]Subtransform, error) {
 	subtransforms := []Subtransform{}
+
+	// the identifiers are a rule applied to all messages, before the other rules
+	t.rules = []rewriteRule{}
 	if len(t.config.Rewrite.Identifiers) > 0 {
+		rule, err := newRewriteRule(nil, t.config.Rewrite.Identifiers)
+		if err != nil {
+			return nil, err
+		}
+		t.rules = append(t.rules, rule)
+	}
+	for i, cfg := range t.config.Rewrite.Rules {
+		rule, err := newRewriteRule(cfg.Match, cfg.Identifiers)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		t.rules = append(t.rules, rule)
+	}
+
+	if len(t.rules) > 0 {
 		subtransforms = append(subtransforms, Subtransform{name: "rewrite", processFunc: t.UpdateValues})
 	}
 	return subtransforms, nil
 }
 
+// newRewriteRule parses the templates of the values, the strings with {{ }} are templates
+func newRewriteRule(match map[string]interface{}, identifiers map[string]interface{}) (rewriteRule, error) {
+	rule := rewriteRule{match: match}
+
+	// sort the keys to rewrite the fields in the same order for all messages
+	keys := make([]string, 0, len(identifiers))
+	for key := range identifiers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := rewriteValue{key: key, value: identifiers[key]}
+		if s, ok := value.value.(string); ok && strings.Contains(s, "{{") {
+			tmpl, err := template.New(key).Option("missingkey=error").Parse(s)
+			if err != nil {
+				return rule, fmt.Errorf("invalid template for %s: %w", key, err)
+			}
+			value.template = tmpl
+		}
+		rule.values = append(rule.values, value)
+	}
+	return rule, nil
+}
+
 func (t *RewriteTransform) UpdateValues(dm *dnsutils.DNSMessage) (int, error) {
 	dmValue := reflect.ValueOf(dm)
 	if dmValue.Kind() == reflect.Ptr {
 		dmValue = dmValue.Elem()
 	}
 
-	for nestedKeys, value := range t.config.Rewrite.Identifiers {
-		realValue, found := getFieldByTag(dmValue, nestedKeys)
-		switch {
-		case !found:
-			return 0, errors.New("field not found: " + nestedKeys)
-		case !realValue.CanSet():
-			return 0, errors.New("field cannot be set: " + nestedKeys)
-		default:
-			newValue := reflect.ValueOf(value)
-
-			switch realValue.Kind() {
-			case reflect.Int, reflect.String:
-				if realValue.Kind() == newValue.Kind() {
-					realValue.Set(newValue)
-				} else {
-					return 0, errors.New("unable to set value (" + newValue.Type().String() + ") for " + nestedKeys + "(" + realValue.Type().String() + ")")
+	for _, rule := range t.rules {
+		if len(rule.match) > 0 {
+			err, matched := dm.Matching(rule.match)
+			if err != nil {
+				return 0, err
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		for _, v := range rule.values {
+			realValue, found := getFieldByTag(dmValue, v.key)
+			switch {
+			case !found:
+				return 0, errors.New("field not found: " + v.key)
+			case !realValue.CanSet():
+				return 0, errors.New("field cannot be set: " + v.key)
+			}
+
+			value := v.value
+			if v.template != nil {
+				var buf bytes.Buffer
+				if err := v.template.Execute(&buf, dm); err != nil {
+					return 0, fmt.Errorf("unable to render the value of %s: %w", v.key, err)
 				}
-			default:
+				value = buf.String()
+			}
+
+			set, err := setFieldValue(realValue, value)
+			if err != nil {
+				return 0, fmt.Errorf("unable to set value (%T) for %s(%s): %w", value, v.key, realValue.Type(), err)
+			}
+			if !set {
 				// Ignore unsupported types
 				continue
 			}
-
 		}
 	}
 
 	return ReturnKeep, nil
 }
 
+// setFieldValue converts the value to the type of the field, the strings are parsed
+// for the numbers and the booleans, returns false for the unsupported types
+func setFieldValue(field reflect.Value, value interface{}) (bool, error) {
+	newValue := reflect.ValueOf(value)
+	if !newValue.IsValid() {
+		return false, errors.New("nil value")
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		if newValue.Kind() != reflect.String {
+			return false, errors.New("string expected")
+		}
+		field.SetString(newValue.String())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch newValue.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i = newValue.Int()
+		case reflect.String:
+			n, err := strconv.ParseInt(strings.TrimSpace(newValue.String()), 10, 64)
+			if err != nil {
+				return false, err
+			}
+			i = n
+		default:
+			return false, errors.New("integer expected")
+		}
+		if field.OverflowInt(i) {
+			return false, errors.New("integer overflow")
+		}
+		field.SetInt(i)
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch newValue.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f = newValue.Float()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(newValue.Int())
+		case reflect.String:
+			n, err := strconv.ParseFloat(strings.TrimSpace(newValue.String()), 64)
+			if err != nil {
+				return false, err
+			}
+			f = n
+		default:
+			return false, errors.New("float expected")
+		}
+		field.SetFloat(f)
+
+	case reflect.Bool:
+		switch newValue.Kind() {
+		case reflect.Bool:
+			field.SetBool(newValue.Bool())
+		case reflect.String:
+			b, err := strconv.ParseBool(strings.TrimSpace(newValue.String()))
+			if err != nil {
+				return false, err
+			}
+			field.SetBool(b)
+		default:
+			return false, errors.New("boolean expected")
+		}
+
+	case reflect.Slice:
+		if newValue.Kind() != reflect.Slice {
+			return false, errors.New("list expected")
+		}
+		// the slice is replaced, the elements are converted one by one
+		slice := reflect.MakeSlice(field.Type(), newValue.Len(), newValue.Len())
+		for i := 0; i < newValue.Len(); i++ {
+			set, err := setFieldValue(slice.Index(i), newValue.Index(i).Interface())
+			if err != nil {
+				return false, fmt.Errorf("element %d: %w", i, err)
+			}
+			if !set {
+				return false, nil
+			}
+		}
+		field.Set(slice)
+
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
 func getFieldByTag(value reflect.Value, nestedKeys string) (reflect.Value, bool) {
 	listKeys := strings.SplitN(nestedKeys, ".", 2)
 
@@ -76,14 +241,20 @@ func getFieldByTag(value reflect.Value, nestedKeys string) (reflect.Value, bool)
 			// Check if the JSON tag matches
 			if tagClean == jsonKey {
 				switch field.Type.Kind() {
-				// ptr
+				// ptr, the transforms not enabled are nil
 				case reflect.Ptr:
+					if value.Field(i).IsNil() || j+1 >= len(listKeys) {
+						return reflect.Value{}, false
+					}
 					if fieldValue, found := getFieldByTag(value.Field(i).Elem(), listKeys[j+1]); found {
 						return fieldValue, true
 					}
 
 				// struct
 				case reflect.Struct:
+					if j+1 >= len(listKeys) {
+						return reflect.Value{}, false
+					}
 					if fieldValue, found := getFieldByTag(value.Field(i), listKeys[j+1]); found {
 						return fieldValue, true
 					}
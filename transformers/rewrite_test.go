@@ -61,3 +61,128 @@ func TestRewrite_UpdateFields_InvalidType(t *testing.T) {
 		t.Errorf("invalid error: %s", err)
 	}
 }
+
+func TestRewrite_TemplatedValue(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Rewrite.Enable = true
+	config.Rewrite.Identifiers = map[string]interface{}{
+		"dnstap.identity": "{{ .NetworkInfo.ResponseIP }}-dc1",
+		"dns.id":          "{{ .NetworkInfo.QueryPort }}",
+	}
+
+	// init the processor
+	outChans := []chan dnsutils.DNSMessage{}
+	rewrite := NewRewriteTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := rewrite.GetTransforms(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dm := dnsutils.GetFakeDNSMessage()
+	if _, err := rewrite.UpdateValues(&dm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if dm.DNSTap.Identity != "4.3.2.1-dc1" {
+		t.Errorf("Want 4.3.2.1-dc1, got %v", dm.DNSTap.Identity)
+	}
+	if dm.DNS.ID != 1234 {
+		t.Errorf("Want 1234, got %v", dm.DNS.ID)
+	}
+}
+
+func TestRewrite_ConditionalRules(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Rewrite.Enable = true
+	config.Rewrite.Rules = []pkgconfig.RewriteRule{
+		{
+			Match:       map[string]interface{}{"network.query-ip": "^1\\.2\\."},
+			Identifiers: map[string]interface{}{"dnstap.identity": "internal"},
+		},
+		{
+			Match:       map[string]interface{}{"dnstap.identity": "internal"},
+			Identifiers: map[string]interface{}{"dnstap.version": "{{ .DNSTap.Identity }}-v2"},
+		},
+		{
+			Match:       map[string]interface{}{"network.query-ip": "^10\\."},
+			Identifiers: map[string]interface{}{"dnstap.identity": "private"},
+		},
+	}
+
+	// init the processor
+	outChans := []chan dnsutils.DNSMessage{}
+	rewrite := NewRewriteTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := rewrite.GetTransforms(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testcases := []struct {
+		queryIP  string
+		identity string
+		version  string
+	}{
+		{queryIP: "1.2.3.4", identity: "internal", version: "internal-v2"},
+		{queryIP: "10.0.0.1", identity: "private", version: "dnscollector 1.0.0"},
+		{queryIP: "192.168.1.1", identity: "collector", version: "dnscollector 1.0.0"},
+	}
+	for _, tc := range testcases {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.NetworkInfo.QueryIP = tc.queryIP
+		if _, err := rewrite.UpdateValues(&dm); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if dm.DNSTap.Identity != tc.identity || dm.DNSTap.Version != tc.version {
+			t.Errorf("%s: want %s/%s, got %s/%s", tc.queryIP, tc.identity, tc.version, dm.DNSTap.Identity, dm.DNSTap.Version)
+		}
+	}
+}
+
+func TestRewrite_UpdateFields_Types(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Rewrite.Enable = true
+	config.Rewrite.Identifiers = map[string]interface{}{
+		"dns.flags.qr":   true,
+		"dns.flags.aa":   "{{ if eq .DNS.Qtype \"A\" }}true{{ else }}false{{ end }}",
+		"dnstap.latency": 0.5,
+		"atags.tags":     []interface{}{"tag1", "tag2"},
+	}
+
+	// init the processor
+	outChans := []chan dnsutils.DNSMessage{}
+	rewrite := NewRewriteTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := rewrite.GetTransforms(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.InitTransforms()
+	if _, err := rewrite.UpdateValues(&dm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !dm.DNS.Flags.QR || !dm.DNS.Flags.AA {
+		t.Errorf("Want qr and aa flags, got %v", dm.DNS.Flags)
+	}
+	if dm.DNSTap.Latency != 0.5 {
+		t.Errorf("Want 0.5, got %v", dm.DNSTap.Latency)
+	}
+	if len(dm.ATags.Tags) != 2 || dm.ATags.Tags[0] != "tag1" || dm.ATags.Tags[1] != "tag2" {
+		t.Errorf("Want [tag1 tag2], got %v", dm.ATags.Tags)
+	}
+}
+
+func TestRewrite_InvalidTemplate(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Rewrite.Enable = true
+	config.Rewrite.Identifiers = map[string]interface{}{"dnstap.identity": "{{ .NetworkInfo.ResponseIP"}
+
+	// init the processor
+	outChans := []chan dnsutils.DNSMessage{}
+	rewrite := NewRewriteTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := rewrite.GetTransforms(); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
@@ -0,0 +1,230 @@
+package transformers
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+const rollupFieldQueryIP = "network.query-ip"
+
+// summary record of a group and the sketch of the distinct qnames
+type rollupGroup struct {
+	summary *dnsutils.DNSMessage
+	qnames  *HyperLogLog
+}
+
+type RollupTransform struct {
+	GenericTransformer
+	sync.Mutex
+	groups       map[string]*rollupGroup
+	windowStart  time.Time
+	unaggregated int
+	v4Mask       net.IPMask
+	v6Mask       net.IPMask
+	stopFlush    chan struct{}
+}
+
+func NewRollupTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *RollupTransform {
+	t := &RollupTransform{GenericTransformer: NewTransformer(config, logger, "rollup", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *RollupTransform) GetTransforms() ([]Subtransform, error) {
+	t.stopFlusher()
+
+	subtransforms := []Subtransform{}
+	if !t.config.Rollup.Enable {
+		return subtransforms, nil
+	}
+	if t.config.Rollup.Window <= 0 {
+		return nil, fmt.Errorf("invalid window %d", t.config.Rollup.Window)
+	}
+
+	// send the summaries of the open window before the new settings are applied
+	t.Flush(time.Now())
+
+	t.Lock()
+	t.groups = make(map[string]*rollupGroup)
+	t.windowStart = time.Now()
+	t.v4Mask = net.CIDRMask(t.config.Rollup.ClientPrefixV4, 32)
+	t.v6Mask = net.CIDRMask(t.config.Rollup.ClientPrefixV6, 128)
+	t.Unlock()
+
+	t.stopFlush = make(chan struct{})
+	go t.flushPeriodically(time.Duration(t.config.Rollup.Window)*time.Second, t.stopFlush)
+
+	subtransforms = append(subtransforms, Subtransform{name: "rollup:aggregate", processFunc: t.aggregate})
+	return subtransforms, nil
+}
+
+func (t *RollupTransform) Reset() {
+	t.stopFlusher()
+	t.Flush(time.Now())
+}
+
+func (t *RollupTransform) stopFlusher() {
+	if t.stopFlush != nil {
+		close(t.stopFlush)
+		t.stopFlush = nil
+	}
+}
+
+func (t *RollupTransform) flushPeriodically(window time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			t.Flush(now)
+		}
+	}
+}
+
+// Flush closes the current window and sends one summary record per group
+func (t *RollupTransform) Flush(now time.Time) {
+	t.Lock()
+	groups, start, unaggregated := t.groups, t.windowStart, t.unaggregated
+	t.groups = make(map[string]*rollupGroup)
+	t.windowStart = now
+	t.unaggregated = 0
+	t.Unlock()
+
+	if unaggregated > 0 {
+		t.LogError("%d message(s) not aggregated and forwarded raw, max groups reached", unaggregated)
+	}
+
+	for _, group := range groups {
+		summary := group.summary
+		rollup := summary.Rollup
+		rollup.WindowStart = start.Unix()
+		rollup.WindowEnd = now.Unix()
+		rollup.LengthAvg = float64(rollup.LengthSum) / float64(rollup.Count)
+		if rollup.Latencies > 0 {
+			rollup.LatencyAvg = rollup.LatencySum / float64(rollup.Latencies)
+		}
+		rollup.DistinctQnames = group.qnames.Count()
+
+		summary.DNSTap.Operation = dnsutils.DNSTapOperationRollup
+		summary.DNSTap.Timestamp = now.UnixNano()
+		summary.DNSTap.TimeSec = int(now.Unix())
+		summary.DNSTap.TimeNsec = now.Nanosecond()
+		summary.DNSTap.TimestampRFC3339 = now.UTC().Format(time.RFC3339Nano)
+
+		for i := range t.nextWorkers {
+			t.nextWorkers[i] <- *summary
+		}
+	}
+}
+
+// groupValue returns the value of the field used to group the message,
+// the query ip is replaced by the client subnet
+func (t *RollupTransform) groupValue(dmValue reflect.Value, field string) string {
+	value, found := dnsutils.GetFieldByJSONTag(dmValue, field)
+	if !found {
+		return "-"
+	}
+	if field != rollupFieldQueryIP {
+		return fmt.Sprintf("%v", value.Interface())
+	}
+
+	ip := net.ParseIP(value.String())
+	if ip == nil {
+		return value.String()
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ones, _ := t.v4Mask.Size()
+		return ipv4.Mask(t.v4Mask).String() + "/" + strconv.Itoa(ones)
+	}
+	ones, _ := t.v6Mask.Size()
+	return ip.Mask(t.v6Mask).String() + "/" + strconv.Itoa(ones)
+}
+
+// newRollupGroup creates the summary record with the fields of the group
+func (t *RollupTransform) newRollupGroup(dmValue reflect.Value, values []string) *rollupGroup {
+	summary := &dnsutils.DNSMessage{}
+	summary.Init()
+	summary.Rollup = &dnsutils.TransformRollup{Group: make(map[string]string)}
+
+	summaryValue := reflect.ValueOf(summary).Elem()
+	for i, field := range t.config.Rollup.GroupBy {
+		summary.Rollup.Group[field] = values[i]
+		if field == rollupFieldQueryIP {
+			summary.NetworkInfo.QueryIP, _, _ = strings.Cut(values[i], "/")
+			continue
+		}
+		src, found := dnsutils.GetFieldByJSONTag(dmValue, field)
+		if !found {
+			continue
+		}
+		if dst, found := dnsutils.GetFieldByJSONTag(summaryValue, field); found && dst.CanSet() && dst.Type() == src.Type() {
+			dst.Set(src)
+		}
+	}
+	return &rollupGroup{summary: summary, qnames: NewHyperLogLog(t.config.Rollup.HLLPrecision)}
+}
+
+func (t *RollupTransform) aggregate(dm *dnsutils.DNSMessage) (int, error) {
+	dmValue := reflect.ValueOf(dm).Elem()
+	values := make([]string, len(t.config.Rollup.GroupBy))
+	for i, field := range t.config.Rollup.GroupBy {
+		values[i] = t.groupValue(dmValue, field)
+	}
+	key := strings.Join(values, "|")
+
+	t.Lock()
+	defer t.Unlock()
+
+	group, ok := t.groups[key]
+	if !ok {
+		// the message is not in any summary, it is kept to not lose it
+		if len(t.groups) >= t.config.Rollup.MaxGroups {
+			t.unaggregated++
+			return ReturnKeep, nil
+		}
+		group = t.newRollupGroup(dmValue, values)
+		t.groups[key] = group
+	}
+
+	rollup := group.summary.Rollup
+	if rollup.Count == 0 || dm.DNS.Length < rollup.LengthMin {
+		rollup.LengthMin = dm.DNS.Length
+	}
+	if dm.DNS.Length > rollup.LengthMax {
+		rollup.LengthMax = dm.DNS.Length
+	}
+	rollup.Count++
+	rollup.LengthSum += dm.DNS.Length
+
+	// latency is only available on replies
+	if latency := dm.DNSTap.Latency; latency > 0 {
+		if rollup.Latencies == 0 || latency < rollup.LatencyMin {
+			rollup.LatencyMin = latency
+		}
+		if latency > rollup.LatencyMax {
+			rollup.LatencyMax = latency
+		}
+		rollup.Latencies++
+		rollup.LatencySum += latency
+	}
+
+	group.qnames.Add(strings.ToLower(strings.TrimSuffix(dm.DNS.Qname, ".")))
+	return t.rawAction(), nil
+}
+
+func (t *RollupTransform) rawAction() int {
+	if t.config.Rollup.KeepRaw {
+		return ReturnKeep
+	}
+	return ReturnDrop
+}
@@ -0,0 +1,87 @@
+package transformers
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// the seed is shared by all the sketches to be able to merge them
+var hllSeed = maphash.MakeSeed()
+
+// HyperLogLog estimates the number of distinct values with 2^precision registers,
+// the standard error is 1.04/sqrt(2^precision)
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func NewHyperLogLog(precision int) *HyperLogLog {
+	if precision < 4 {
+		precision = 4
+	}
+	if precision > 16 {
+		precision = 16
+	}
+	return &HyperLogLog{precision: uint8(precision), registers: make([]uint8, 1<<precision)}
+}
+
+// Add returns true when a register is updated, the count has to be computed again
+func (h *HyperLogLog) Add(value string) bool {
+	hash := maphash.String(hllSeed, value)
+	index := hash >> (64 - h.precision)
+	// position of the first set bit in the remaining bits
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+		return true
+	}
+	return false
+}
+
+// Reset clears the registers to reuse the sketch
+func (h *HyperLogLog) Reset() {
+	clear(h.registers)
+}
+
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	if other.precision != h.precision {
+		return
+	}
+	for i, rank := range other.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+}
+
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += 1.0 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	estimate := alpha * m * m / sum
+
+	// linear counting for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
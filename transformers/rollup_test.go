@@ -0,0 +1,168 @@
+package transformers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestRollup_Summary(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Rollup.Enable = true
+	config.Rollup.GroupBy = []string{"dnstap.identity", "network.query-ip", "dns.qtype"}
+	config.Rollup.ClientPrefixV4 = 24
+
+	outChan := make(chan dnsutils.DNSMessage, 10)
+	rollup := NewRollupTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{outChan})
+	if _, err := rollup.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer rollup.Reset()
+
+	// two clients of the same subnet
+	for i, ip := range []string{"192.168.1.1", "192.168.1.2", "192.168.1.1"} {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNSTap.Identity = "resolver1"
+		dm.NetworkInfo.QueryIP = ip
+		dm.DNS.Qname = "www" + strconv.Itoa(i%2) + ".example.com"
+		dm.DNS.Length = 50 + i*10
+		dm.DNSTap.Latency = 0.01 * float64(i+1)
+		if ret, _ := rollup.aggregate(&dm); ret != ReturnKeep {
+			t.Errorf("raw message not kept")
+		}
+	}
+	// another group
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNSTap.Identity = "resolver1"
+	dm.NetworkInfo.QueryIP = "192.168.1.1"
+	dm.DNS.Qtype = "AAAA"
+	rollup.aggregate(&dm)
+
+	rollup.Flush(time.Now())
+	if len(outChan) != 2 {
+		t.Fatalf("want 2 summaries, got %d", len(outChan))
+	}
+
+	var summary dnsutils.DNSMessage
+	for len(outChan) > 0 {
+		if dm := <-outChan; dm.DNS.Qtype == "A" {
+			summary = dm
+		}
+	}
+	if summary.DNSTap.Operation != dnsutils.DNSTapOperationRollup {
+		t.Errorf("invalid operation %s", summary.DNSTap.Operation)
+	}
+	if summary.DNSTap.Identity != "resolver1" || summary.NetworkInfo.QueryIP != "192.168.1.0" {
+		t.Errorf("invalid group fields %s %s", summary.DNSTap.Identity, summary.NetworkInfo.QueryIP)
+	}
+	if summary.Rollup.Group["network.query-ip"] != "192.168.1.0/24" {
+		t.Errorf("invalid group %v", summary.Rollup.Group)
+	}
+
+	r := summary.Rollup
+	if r.Count != 3 || r.LengthSum != 180 || r.LengthMin != 50 || r.LengthMax != 70 || r.LengthAvg != 60 {
+		t.Errorf("invalid length stats %+v", r)
+	}
+	if r.Latencies != 3 || r.LatencyMin != 0.01 || r.LatencyMax != 0.03 || r.LatencyAvg < 0.0199 || r.LatencyAvg > 0.0201 {
+		t.Errorf("invalid latency stats %+v", r)
+	}
+	if r.DistinctQnames != 2 {
+		t.Errorf("want 2 distinct qnames, got %d", r.DistinctQnames)
+	}
+
+	// the next window is empty
+	rollup.Flush(time.Now())
+	if len(outChan) != 0 {
+		t.Errorf("unexpected summaries in empty window")
+	}
+}
+
+func TestRollup_DropRawAndMaxGroups(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Rollup.Enable = true
+	config.Rollup.GroupBy = []string{"dns.qname"}
+	config.Rollup.KeepRaw = false
+	config.Rollup.MaxGroups = 5
+
+	outChan := make(chan dnsutils.DNSMessage, 10)
+	rollup := NewRollupTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{outChan})
+	if _, err := rollup.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer rollup.Reset()
+
+	for i := 0; i < 10; i++ {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = "www" + strconv.Itoa(i) + ".example.com"
+		ret, _ := rollup.aggregate(&dm)
+		// the messages of the new groups are kept when the limit is reached
+		switch {
+		case i < 5 && ret != ReturnDrop:
+			t.Errorf("message %d: raw message not dropped", i)
+		case i >= 5 && ret != ReturnKeep:
+			t.Errorf("message %d: message not aggregated must be kept", i)
+		}
+	}
+
+	rollup.Flush(time.Now())
+	if len(outChan) != 5 {
+		t.Errorf("want 5 summaries, got %d", len(outChan))
+	}
+}
+
+func TestRollup_FlushOnReloadAndReset(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Rollup.Enable = true
+	config.Rollup.GroupBy = []string{"dns.qname"}
+	config.Rollup.KeepRaw = false
+
+	outChan := make(chan dnsutils.DNSMessage, 10)
+	rollup := NewRollupTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{outChan})
+	if _, err := rollup.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := dnsutils.GetFakeDNSMessage()
+	rollup.aggregate(&dm)
+	rollup.aggregate(&dm)
+
+	// the reload sends the summary of the open window
+	if _, err := rollup.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	if len(outChan) != 1 {
+		t.Fatalf("want 1 summary after reload, got %d", len(outChan))
+	}
+	if summary := <-outChan; summary.Rollup.Count != 2 {
+		t.Errorf("want 2 messages in the summary, got %d", summary.Rollup.Count)
+	}
+
+	// and the stop too
+	rollup.aggregate(&dm)
+	rollup.Reset()
+	if len(outChan) != 1 {
+		t.Fatalf("want 1 summary after reset, got %d", len(outChan))
+	}
+	if summary := <-outChan; summary.Rollup.Count != 1 {
+		t.Errorf("want 1 message in the summary, got %d", summary.Rollup.Count)
+	}
+}
+
+func TestRollup_HyperLogLog(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		hll := NewHyperLogLog(12)
+		for i := 0; i < n; i++ {
+			hll.Add("www" + strconv.Itoa(i) + ".example.com")
+			// duplicates are not counted
+			hll.Add("www" + strconv.Itoa(i) + ".example.com")
+		}
+		count := float64(hll.Count())
+		if count < float64(n)*0.95 || count > float64(n)*1.05 {
+			t.Errorf("want ~%d distinct values, got %.0f", n, count)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package transformers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	scriptFunction         = "process"
+	scriptEnrichmentPrefix = "enrichment."
+)
+
+// scriptMessage exposes the fields of the message to the script with their json names,
+// dm["dns.qname"] to read a field and dm["dns.qname"] = "value" to update it
+type scriptMessage struct {
+	dm    *dnsutils.DNSMessage
+	value reflect.Value
+}
+
+func newScriptMessage(dm *dnsutils.DNSMessage) *scriptMessage {
+	return &scriptMessage{dm: dm, value: reflect.ValueOf(dm).Elem()}
+}
+
+func (m *scriptMessage) String() string        { return "dnsmessage" }
+func (m *scriptMessage) Type() string          { return "dnsmessage" }
+func (m *scriptMessage) Freeze()               {}
+func (m *scriptMessage) Truth() starlark.Bool  { return starlark.True }
+func (m *scriptMessage) Hash() (uint32, error) { return 0, errors.New("unhashable type: dnsmessage") }
+
+func (m *scriptMessage) Get(k starlark.Value) (starlark.Value, bool, error) {
+	key, ok := starlark.AsString(k)
+	if !ok {
+		return nil, false, fmt.Errorf("field name must be a string, got %s", k.Type())
+	}
+
+	if column, ok := strings.CutPrefix(key, scriptEnrichmentPrefix); ok {
+		value, found := m.dm.Enrichment[column]
+		return starlark.String(value), found, nil
+	}
+
+	field, found := dnsutils.GetFieldByJSONTag(m.value, key)
+	if !found {
+		return nil, false, nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return starlark.String(field.String()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(field.Int()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return starlark.MakeUint64(field.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		return starlark.Float(field.Float()), true, nil
+	case reflect.Bool:
+		return starlark.Bool(field.Bool()), true, nil
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			items := make([]starlark.Value, field.Len())
+			for i := range items {
+				items[i] = starlark.String(field.Index(i).String())
+			}
+			return starlark.NewList(items), true, nil
+		}
+	}
+	return nil, false, fmt.Errorf("unsupported type for field %s", key)
+}
+
+// SetKey updates a field of the message, new fields are computed in the enrichment map
+func (m *scriptMessage) SetKey(k, v starlark.Value) error {
+	key, ok := starlark.AsString(k)
+	if !ok {
+		return fmt.Errorf("field name must be a string, got %s", k.Type())
+	}
+
+	if column, ok := strings.CutPrefix(key, scriptEnrichmentPrefix); ok {
+		if m.dm.Enrichment == nil {
+			m.dm.Enrichment = make(map[string]string)
+		}
+		if s, ok := starlark.AsString(v); ok {
+			m.dm.Enrichment[column] = s
+		} else {
+			m.dm.Enrichment[column] = v.String()
+		}
+		return nil
+	}
+
+	field, found := dnsutils.GetFieldByJSONTag(m.value, key)
+	if !found || !field.CanSet() {
+		return fmt.Errorf("unknown field %s", key)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		s, ok := starlark.AsString(v)
+		if !ok {
+			return fmt.Errorf("field %s: string expected, got %s", key, v.Type())
+		}
+		field.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := v.(starlark.Int)
+		if !ok {
+			return fmt.Errorf("field %s: int expected, got %s", key, v.Type())
+		}
+		n, ok := i.Int64()
+		if !ok || field.OverflowInt(n) {
+			return fmt.Errorf("field %s: int out of range", key)
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := starlark.AsFloat(v)
+		if !ok {
+			return fmt.Errorf("field %s: float expected, got %s", key, v.Type())
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, ok := v.(starlark.Bool)
+		if !ok {
+			return fmt.Errorf("field %s: bool expected, got %s", key, v.Type())
+		}
+		field.SetBool(bool(b))
+	default:
+		return fmt.Errorf("field %s is read-only", key)
+	}
+	return nil
+}
+
+func (m *scriptMessage) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "get":
+		return starlark.NewBuiltin("get", m.builtinGet), nil
+	case "tag":
+		return starlark.NewBuiltin("tag", m.builtinTag), nil
+	}
+	return nil, nil
+}
+
+func (m *scriptMessage) AttrNames() []string {
+	return []string{"get", "tag"}
+}
+
+// dm.get(field, default=None)
+func (m *scriptMessage) builtinGet(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key starlark.Value
+	var fallback starlark.Value = starlark.None
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &key, &fallback); err != nil {
+		return nil, err
+	}
+	value, found, err := m.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return fallback, nil
+	}
+	return value, nil
+}
+
+// dm.tag(name) adds a tag in the atags
+func (m *scriptMessage) builtinTag(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var tag string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &tag); err != nil {
+		return nil, err
+	}
+	if m.dm.ATags == nil {
+		m.dm.ATags = &dnsutils.TransformATags{Tags: []string{}}
+	}
+	m.dm.ATags.Tags = append(m.dm.ATags.Tags, tag)
+	return starlark.None, nil
+}
+
+// script transformer
+type ScriptTransform struct {
+	GenericTransformer
+	process    starlark.Callable
+	timeBudget time.Duration
+}
+
+func NewScriptTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *ScriptTransform {
+	t := &ScriptTransform{GenericTransformer: NewTransformer(config, logger, "script", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *ScriptTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if !t.config.Script.Enable {
+		return subtransforms, nil
+	}
+
+	process, err := CompileScript(t.config.Script.Source, t.config.Script.File, t.config.Script.MaxSteps)
+	if err != nil {
+		return nil, err
+	}
+	t.process = process
+	t.timeBudget = time.Duration(t.config.Script.TimeBudget) * time.Millisecond
+
+	subtransforms = append(subtransforms, Subtransform{name: "script:process", processFunc: t.runScript})
+	return subtransforms, nil
+}
+
+// CompileScript executes the script once and returns the process function,
+// the globals are frozen and no module can be loaded
+func CompileScript(source, file string, maxSteps uint64) (starlark.Callable, error) {
+	filename := "script"
+	if len(file) > 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read script: %w", err)
+		}
+		source, filename = string(data), file
+	}
+	if len(source) == 0 {
+		return nil, errors.New("no script provided")
+	}
+
+	thread := &starlark.Thread{Name: "init"}
+	thread.SetMaxExecutionSteps(maxSteps)
+	options := &syntax.FileOptions{Set: true, While: true, TopLevelControl: true}
+	globals, err := starlark.ExecFileOptions(options, thread, filename, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile script: %w", err)
+	}
+	globals.Freeze()
+
+	process, ok := globals[scriptFunction].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("the script must define a %s(dm) function", scriptFunction)
+	}
+	return process, nil
+}
+
+// runScript calls the process function, the message is dropped when False is returned
+func (t *ScriptTransform) runScript(dm *dnsutils.DNSMessage) (int, error) {
+	thread := &starlark.Thread{Name: "process"}
+	thread.SetMaxExecutionSteps(t.config.Script.MaxSteps)
+	if t.timeBudget > 0 {
+		timer := time.AfterFunc(t.timeBudget, func() { thread.Cancel("time budget exceeded") })
+		defer timer.Stop()
+	}
+
+	result, err := starlark.Call(thread, t.process, starlark.Tuple{newScriptMessage(dm)}, nil)
+	if err != nil {
+		if t.config.Script.OnError == dnsutils.ScriptOnErrorDrop {
+			return ReturnDrop, nil
+		}
+		return ReturnKeep, fmt.Errorf("script: %w", err)
+	}
+	if result == starlark.False {
+		return ReturnDrop, nil
+	}
+	return ReturnKeep, nil
+}
@@ -0,0 +1,154 @@
+package transformers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func newScriptForTest(t *testing.T, source string) *ScriptTransform {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Script.Enable = true
+	config.Script.Source = source
+
+	script := NewScriptTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := script.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestScript_ReadWriteFields(t *testing.T) {
+	script := newScriptForTest(t, `
+def process(dm):
+    dm["dns.qname"] = dm["dns.qname"].lower()
+    dm["dns.length"] = dm["dns.length"] * 2
+    dm["dnstap.latency"] = 0.5
+    dm["dns.flags.aa"] = True
+    dm["enrichment.labels"] = len(dm["dns.qname"].split("."))
+    if dm.get("geoip.country-isocode", "-") == "-":
+        dm.tag("no-geoip")
+`)
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "WWW.Example.COM"
+	dm.DNS.Length = 20
+	if ret, err := script.runScript(&dm); ret != ReturnKeep || err != nil {
+		t.Fatalf("unexpected result %d %v", ret, err)
+	}
+
+	if dm.DNS.Qname != "www.example.com" || dm.DNS.Length != 40 || dm.DNSTap.Latency != 0.5 || !dm.DNS.Flags.AA {
+		t.Errorf("fields not updated: %s %d %f %v", dm.DNS.Qname, dm.DNS.Length, dm.DNSTap.Latency, dm.DNS.Flags.AA)
+	}
+	if dm.Enrichment["labels"] != "3" {
+		t.Errorf("invalid computed field %v", dm.Enrichment)
+	}
+	if dm.ATags == nil || len(dm.ATags.Tags) != 1 || dm.ATags.Tags[0] != "no-geoip" {
+		t.Errorf("tag not added")
+	}
+}
+
+func TestScript_Drop(t *testing.T) {
+	script := newScriptForTest(t, `
+blocked = ["ads.example.com", "tracker.example.com"]
+
+def process(dm):
+    return dm["dns.qname"] not in blocked
+`)
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "ads.example.com"
+	if ret, _ := script.runScript(&dm); ret != ReturnDrop {
+		t.Errorf("message not dropped")
+	}
+
+	dm.DNS.Qname = "www.example.com"
+	if ret, _ := script.runScript(&dm); ret != ReturnKeep {
+		t.Errorf("message dropped")
+	}
+}
+
+func TestScript_Errors(t *testing.T) {
+	// invalid field type
+	script := newScriptForTest(t, `
+def process(dm):
+    dm["dns.length"] = "big"
+`)
+	dm := dnsutils.GetFakeDNSMessage()
+	if _, err := script.runScript(&dm); err == nil || !strings.Contains(err.Error(), "int expected") {
+		t.Errorf("error expected, got %v", err)
+	}
+
+	// unknown field
+	script = newScriptForTest(t, `
+def process(dm):
+    dm["dns.unknown"] = 1
+`)
+	if _, err := script.runScript(&dm); err == nil {
+		t.Errorf("error expected for unknown field")
+	}
+
+	// message dropped on error
+	script.config.Script.OnError = dnsutils.ScriptOnErrorDrop
+	if ret, err := script.runScript(&dm); ret != ReturnDrop || err != nil {
+		t.Errorf("message not dropped on error")
+	}
+}
+
+func TestScript_Budget(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Script.Enable = true
+	config.Script.Source = `
+def process(dm):
+    n = 0
+    while True:
+        n += 1
+`
+
+	// limited by the number of steps
+	script := NewScriptTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := script.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	dm := dnsutils.GetFakeDNSMessage()
+	if _, err := script.runScript(&dm); err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Errorf("steps limit expected, got %v", err)
+	}
+
+	// limited by the time budget
+	config.Script.MaxSteps = 0
+	config.Script.TimeBudget = 5
+	if _, err := script.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := script.runScript(&dm); err == nil || !strings.Contains(err.Error(), "time budget exceeded") {
+		t.Errorf("time budget expected, got %v", err)
+	}
+}
+
+func TestScript_Compile(t *testing.T) {
+	// syntax error
+	if _, err := CompileScript("def process(dm)\n", "", 1000); err == nil {
+		t.Errorf("syntax error expected")
+	}
+	// missing function
+	if _, err := CompileScript("x = 1\n", "", 1000); err == nil {
+		t.Errorf("missing function error expected")
+	}
+	// modules can't be loaded
+	if _, err := CompileScript("load('os.star', 'os')\ndef process(dm):\n    pass\n", "", 1000); err == nil {
+		t.Errorf("load error expected")
+	}
+
+	// from file
+	file := filepath.Join(t.TempDir(), "script.star")
+	os.WriteFile(file, []byte("def process(dm):\n    pass\n"), 0o644)
+	if _, err := CompileScript("", file, 1000); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
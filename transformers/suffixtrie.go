@@ -0,0 +1,68 @@
+package transformers
+
+import (
+	"strings"
+)
+
+type suffixNode struct {
+	children map[string]*suffixNode
+	terminal bool
+}
+
+// DomainSuffixTrie is a trie of the labels from the TLD, the lookup
+// matches the domains of the trie and their subdomains
+type DomainSuffixTrie struct {
+	root suffixNode
+	size int
+}
+
+func NewDomainSuffixTrie() *DomainSuffixTrie {
+	return &DomainSuffixTrie{}
+}
+
+func (t *DomainSuffixTrie) Len() int {
+	return t.size
+}
+
+// Insert adds the domain, the case and the ending dot are ignored
+func (t *DomainSuffixTrie) Insert(domain string) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	node := &t.root
+	for end := len(domain); end > 0; {
+		start := strings.LastIndexByte(domain[:end], '.') + 1
+		label := domain[start:end]
+		if node.children == nil {
+			node.children = make(map[string]*suffixNode)
+		}
+		child, ok := node.children[label]
+		if !ok {
+			child = &suffixNode{}
+			node.children[label] = child
+		}
+		node = child
+		end = start - 1
+	}
+	if node != &t.root && !node.terminal {
+		node.terminal = true
+		t.size++
+	}
+}
+
+// Match returns true when the domain or one of its parents is in the trie
+func (t *DomainSuffixTrie) Match(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	node := &t.root
+	for end := len(domain); end > 0; {
+		start := strings.LastIndexByte(domain[:end], '.') + 1
+		child, ok := node.children[domain[start:end]]
+		if !ok {
+			return false
+		}
+		if child.terminal {
+			return true
+		}
+		node = child
+		end = start - 1
+	}
+	return false
+}
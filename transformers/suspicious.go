@@ -1,18 +1,169 @@
 package transformers
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
 )
 
+// minimal length of a label to be considered as encoded data or numeric
+const (
+	suspiciousEncodedMinLen = 16
+	suspiciousNumericMinLen = 4
+)
+
+var (
+	suspiciousHexLabel    = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	suspiciousBase32Label = regexp.MustCompile(`^[a-zA-Z2-7]+$`)
+	suspiciousBase64Label = regexp.MustCompile(`^[a-zA-Z0-9+_-]+$`)
+)
+
+// suspiciousCheck returns true when the message is suspicious for this check
+type suspiciousCheck func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool
+
+var suspiciousChecks = map[string]suspiciousCheck{
+	// dns decoding error?
+	dnsutils.SuspiciousCheckMalformedPacket: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		dm.Suspicious.MalformedPacket = dm.DNS.MalformedPacket
+		return dm.Suspicious.MalformedPacket
+	},
+	// large packet size ?
+	dnsutils.SuspiciousCheckLargePacket: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		dm.Suspicious.LargePacket = dm.DNS.Length > t.config.Suspicious.ThresholdPacketLen
+		return dm.Suspicious.LargePacket
+	},
+	// long domain name ?
+	dnsutils.SuspiciousCheckLongDomain: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		dm.Suspicious.LongDomain = len(dm.DNS.Qname) > t.config.Suspicious.ThresholdQnameLen
+		return dm.Suspicious.LongDomain
+	},
+	// slow domain name resolution ?
+	dnsutils.SuspiciousCheckSlowDomain: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		dm.Suspicious.SlowDomain = dm.DNSTap.Latency > t.config.Suspicious.ThresholdSlow
+		return dm.Suspicious.SlowDomain
+	},
+	// search for unallowed characters
+	dnsutils.SuspiciousCheckUnallowedChars: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		for _, v := range t.config.Suspicious.UnallowedChars {
+			if strings.Contains(dm.DNS.Qname, v) {
+				dm.Suspicious.UnallowedChars = true
+				return true
+			}
+		}
+		return false
+	},
+	// uncommon qtype?
+	dnsutils.SuspiciousCheckUncommonQtypes: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		_, found := t.commonQtypes[dm.DNS.Qtype]
+		dm.Suspicious.UncommonQtypes = !found
+		return dm.Suspicious.UncommonQtypes
+	},
+	// count the number of labels in qname
+	dnsutils.SuspiciousCheckExcessiveLabels: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		dm.Suspicious.ExcessiveNumberLabels = strings.Count(dm.DNS.Qname, ".") > t.config.Suspicious.ThresholdMaxLabels
+		return dm.Suspicious.ExcessiveNumberLabels
+	},
+	dnsutils.SuspiciousCheckHighEntropy: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		return subdomainEntropy(dm.DNS.Qname) > t.config.Suspicious.ThresholdEntropy
+	},
+	dnsutils.SuspiciousCheckNumericLabels: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		for _, label := range strings.Split(dm.DNS.Qname, ".") {
+			if len(label) >= suspiciousNumericMinLen && digitsRatio(label) > t.config.Suspicious.ThresholdDigitsRatio {
+				return true
+			}
+		}
+		return false
+	},
+	dnsutils.SuspiciousCheckEncodedLabels: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		for _, label := range strings.Split(dm.DNS.Qname, ".") {
+			if looksEncoded(label) {
+				return true
+			}
+		}
+		return false
+	},
+	// internationalized domain names can contain homoglyphs
+	dnsutils.SuspiciousCheckNonASCII: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		for _, label := range strings.Split(dm.DNS.Qname, ".") {
+			if strings.HasPrefix(strings.ToLower(label), "xn--") {
+				return true
+			}
+		}
+		for _, c := range dm.DNS.Qname {
+			if c > unicode.MaxASCII {
+				return true
+			}
+		}
+		return false
+	},
+	dnsutils.SuspiciousCheckTTLAnomaly: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		for _, answer := range dm.DNS.DNSRRs.Answers {
+			if answer.TTL < t.config.Suspicious.ThresholdMinTTL || answer.TTL > t.config.Suspicious.ThresholdMaxTTL {
+				return true
+			}
+		}
+		return false
+	},
+	dnsutils.SuspiciousCheckAnyQuery: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		return dm.DNS.Qtype == "ANY"
+	},
+	// the private use types are decoded as unknown
+	dnsutils.SuspiciousCheckNullPrivateQtype: func(t *SuspiciousTransform, dm *dnsutils.DNSMessage) bool {
+		return dm.DNS.Qtype == "NULL" || dm.DNS.Qtype == dnsutils.UNKNOWN
+	},
+}
+
+// digitsRatio returns the proportion of digits in the label
+func digitsRatio(label string) float64 {
+	digits := 0
+	for _, c := range label {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return float64(digits) / float64(len(label))
+}
+
+// looksEncoded detects the long labels with hex, base32 or base64 data,
+// the digits and the case are used to not match the words
+func looksEncoded(label string) bool {
+	if len(label) < suspiciousEncodedMinLen {
+		return false
+	}
+
+	var digits, lower, upper int
+	for _, c := range label {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c >= 'a' && c <= 'z':
+			lower++
+		case c >= 'A' && c <= 'Z':
+			upper++
+		}
+	}
+
+	switch {
+	case suspiciousHexLabel.MatchString(label):
+		return digits > 0 && digits < len(label)
+	case suspiciousBase32Label.MatchString(label):
+		return digits >= 2
+	case suspiciousBase64Label.MatchString(label):
+		return digits > 0 && lower > 0 && upper > 0
+	}
+	return false
+}
+
 type SuspiciousTransform struct {
 	GenericTransformer
 	commonQtypes          map[string]bool
 	whitelistDomainsRegex map[string]*regexp.Regexp
+	checks                []string
 }
 
 func NewSuspiciousTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *SuspiciousTransform {
@@ -42,68 +193,71 @@ func (t *SuspiciousTransform) GetTransforms() ([]Subtransform, error) {
 	}
 
 	if t.config.Suspicious.Enable {
+		for _, check := range t.config.Suspicious.Checks {
+			if _, ok := suspiciousChecks[check]; !ok {
+				return nil, fmt.Errorf("invalid check: %s", check)
+			}
+		}
+		for check := range t.config.Suspicious.Weights {
+			if _, ok := suspiciousChecks[check]; !ok {
+				return nil, fmt.Errorf("invalid check in weights: %s", check)
+			}
+		}
+		switch t.config.Suspicious.Action {
+		case dnsutils.SuspiciousActionKeep, dnsutils.SuspiciousActionDrop, dnsutils.SuspiciousActionOnlySuspicious:
+		default:
+			return nil, fmt.Errorf("invalid action: %s", t.config.Suspicious.Action)
+		}
+		t.checks = t.config.Suspicious.Checks
+
 		subtransforms = append(subtransforms, Subtransform{name: "suspicious:check", processFunc: t.checkIfSuspicious})
 	}
 	return subtransforms, nil
 }
 
+// weight returns the score added by the check, 1.0 by default
+func (t *SuspiciousTransform) weight(check string) float64 {
+	if weight, ok := t.config.Suspicious.Weights[check]; ok {
+		return weight
+	}
+	return 1.0
+}
+
 func (t *SuspiciousTransform) checkIfSuspicious(dm *dnsutils.DNSMessage) (int, error) {
 
 	if dm.Suspicious == nil {
-		dm.Suspicious = &dnsutils.TransformSuspicious{}
+		dm.Suspicious = &dnsutils.TransformSuspicious{Reasons: []string{}}
 	}
 
 	// ignore some domains ?
 	for _, d := range t.whitelistDomainsRegex {
 		if d.MatchString(dm.DNS.Qname) {
-			return ReturnKeep, nil
+			return t.applyAction(dm), nil
 		}
 	}
 
-	// dns decoding error?
-	if dm.DNS.MalformedPacket {
-		dm.Suspicious.Score += 1.0
-		dm.Suspicious.MalformedPacket = true
-	}
-
-	// long domain name ?
-	if len(dm.DNS.Qname) > t.config.Suspicious.ThresholdQnameLen {
-		dm.Suspicious.Score += 1.0
-		dm.Suspicious.LongDomain = true
-	}
-
-	// large packet size ?
-	if dm.DNS.Length > t.config.Suspicious.ThresholdPacketLen {
-		dm.Suspicious.Score += 1.0
-		dm.Suspicious.LargePacket = true
-	}
-
-	// slow domain name resolution ?
-	if dm.DNSTap.Latency > t.config.Suspicious.ThresholdSlow {
-		dm.Suspicious.Score += 1.0
-		dm.Suspicious.SlowDomain = true
-	}
-
-	// uncommon qtype?
-	if _, found := t.commonQtypes[dm.DNS.Qtype]; !found {
-		dm.Suspicious.Score += 1.0
-		dm.Suspicious.UncommonQtypes = true
+	for _, check := range t.checks {
+		if suspiciousChecks[check](t, dm) {
+			dm.Suspicious.Score += t.weight(check)
+			dm.Suspicious.Reasons = append(dm.Suspicious.Reasons, check)
+		}
 	}
 
-	// count the number of labels in qname
-	if strings.Count(dm.DNS.Qname, ".") > t.config.Suspicious.ThresholdMaxLabels {
-		dm.Suspicious.Score += 1.0
-		dm.Suspicious.ExcessiveNumberLabels = true
-	}
+	return t.applyAction(dm), nil
+}
 
-	// search for unallowed characters
-	for _, v := range t.config.Suspicious.UnallowedChars {
-		if strings.Contains(dm.DNS.Qname, v) {
-			dm.Suspicious.Score += 1.0
-			dm.Suspicious.UnallowedChars = true
-			break
+// applyAction drops the suspicious messages, or the others to forward only the suspicious ones
+func (t *SuspiciousTransform) applyAction(dm *dnsutils.DNSMessage) int {
+	suspicious := dm.Suspicious.Score >= t.config.Suspicious.ThresholdScore
+	switch t.config.Suspicious.Action {
+	case dnsutils.SuspiciousActionDrop:
+		if suspicious {
+			return ReturnDrop
+		}
+	case dnsutils.SuspiciousActionOnlySuspicious:
+		if !suspicious {
+			return ReturnDrop
 		}
 	}
-
-	return ReturnKeep, nil
+	return ReturnKeep
 }
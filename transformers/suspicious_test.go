@@ -332,3 +332,133 @@ func TestSuspicious_WhitelistDomains(t *testing.T) {
 		t.Errorf("suspicious score should be equal to 0.0, got: %d", int(dm.Suspicious.Score))
 	}
 }
+
+func TestSuspicious_WeightsAndReasons(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Suspicious.Enable = true
+	config.Suspicious.Checks = []string{dnsutils.SuspiciousCheckLongDomain, dnsutils.SuspiciousCheckUncommonQtypes, dnsutils.SuspiciousCheckAnyQuery}
+	config.Suspicious.Weights = map[string]float64{dnsutils.SuspiciousCheckAnyQuery: 2.5, dnsutils.SuspiciousCheckUncommonQtypes: 0.5}
+	config.Suspicious.ThresholdQnameLen = 4
+
+	suspicious := NewSuspiciousTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := suspicious.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qtype = "ANY"
+	suspicious.checkIfSuspicious(&dm)
+
+	if dm.Suspicious.Score != 4.0 {
+		t.Errorf("score 4.0 expected, got %v", dm.Suspicious.Score)
+	}
+	want := []string{dnsutils.SuspiciousCheckLongDomain, dnsutils.SuspiciousCheckUncommonQtypes, dnsutils.SuspiciousCheckAnyQuery}
+	if !reflect.DeepEqual(dm.Suspicious.Reasons, want) {
+		t.Errorf("invalid reasons %v", dm.Suspicious.Reasons)
+	}
+	if !dm.Suspicious.LongDomain || !dm.Suspicious.UncommonQtypes {
+		t.Errorf("flags not set")
+	}
+
+	// invalid names
+	config.Suspicious.Weights = map[string]float64{"unknown": 1}
+	if _, err := suspicious.GetTransforms(); err == nil {
+		t.Errorf("error expected for an invalid weight")
+	}
+	config.Suspicious.Weights = nil
+	config.Suspicious.Checks = []string{"unknown"}
+	if _, err := suspicious.GetTransforms(); err == nil {
+		t.Errorf("error expected for an invalid check")
+	}
+}
+
+func TestSuspicious_Checks(t *testing.T) {
+	testcases := []struct {
+		check  string
+		qname  string
+		qtype  string
+		ttl    int
+		result bool
+	}{
+		{dnsutils.SuspiciousCheckHighEntropy, "www.google.com", "A", 300, false},
+		{dnsutils.SuspiciousCheckHighEntropy, "qx7vz2kp9w4jm8rt5nb3yh6.example.com", "A", 300, true},
+		{dnsutils.SuspiciousCheckNumericLabels, "www.example.com", "A", 300, false},
+		{dnsutils.SuspiciousCheckNumericLabels, "4.3.2.1.in-addr.arpa", "PTR", 300, false},
+		{dnsutils.SuspiciousCheckNumericLabels, "a81726354.example.com", "A", 300, true},
+		{dnsutils.SuspiciousCheckEncodedLabels, "internationalization.example.com", "A", 300, false},
+		{dnsutils.SuspiciousCheckEncodedLabels, "4a6f686e20446f65206973206865726.example.com", "A", 300, true},
+		{dnsutils.SuspiciousCheckEncodedLabels, "mzxw6ytboi2dsmzrgu3tq.example.com", "A", 300, true},
+		{dnsutils.SuspiciousCheckEncodedLabels, "SGVsbG8gV29ybGQgdGhpcw.example.com", "A", 300, true},
+		{dnsutils.SuspiciousCheckNonASCII, "www.example.com", "A", 300, false},
+		{dnsutils.SuspiciousCheckNonASCII, "xn--pple-43d.com", "A", 300, true},
+		{dnsutils.SuspiciousCheckNonASCII, "аpple.com", "A", 300, true},
+		{dnsutils.SuspiciousCheckTTLAnomaly, "www.example.com", "A", 300, false},
+		{dnsutils.SuspiciousCheckTTLAnomaly, "www.example.com", "A", 0, true},
+		{dnsutils.SuspiciousCheckTTLAnomaly, "www.example.com", "A", 2592000, true},
+		{dnsutils.SuspiciousCheckAnyQuery, "www.example.com", "A", 300, false},
+		{dnsutils.SuspiciousCheckAnyQuery, "www.example.com", "ANY", 300, true},
+		{dnsutils.SuspiciousCheckNullPrivateQtype, "www.example.com", "NULL", 300, true},
+		{dnsutils.SuspiciousCheckNullPrivateQtype, "www.example.com", dnsutils.UNKNOWN, 300, true},
+		{dnsutils.SuspiciousCheckNullPrivateQtype, "www.example.com", "TXT", 300, false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.check+"/"+tc.qname, func(t *testing.T) {
+			config := pkgconfig.GetFakeConfigTransformers()
+			config.Suspicious.Enable = true
+			config.Suspicious.Checks = []string{tc.check}
+
+			suspicious := NewSuspiciousTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+			if _, err := suspicious.GetTransforms(); err != nil {
+				t.Fatal(err)
+			}
+
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = tc.qname
+			dm.DNS.Qtype = tc.qtype
+			dm.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{{Name: tc.qname, Rdatatype: tc.qtype, TTL: tc.ttl}}
+			suspicious.checkIfSuspicious(&dm)
+
+			if (len(dm.Suspicious.Reasons) == 1) != tc.result {
+				t.Errorf("result %v expected, reasons %v", tc.result, dm.Suspicious.Reasons)
+			}
+		})
+	}
+}
+
+func TestSuspicious_Action(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Suspicious.Enable = true
+	config.Suspicious.Checks = []string{dnsutils.SuspiciousCheckAnyQuery}
+	config.Suspicious.ThresholdScore = 1.0
+
+	suspicious := NewSuspiciousTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+
+	testcases := []struct {
+		action string
+		qtype  string
+		result int
+	}{
+		{dnsutils.SuspiciousActionKeep, "ANY", ReturnKeep},
+		{dnsutils.SuspiciousActionDrop, "ANY", ReturnDrop},
+		{dnsutils.SuspiciousActionDrop, "A", ReturnKeep},
+		{dnsutils.SuspiciousActionOnlySuspicious, "ANY", ReturnKeep},
+		{dnsutils.SuspiciousActionOnlySuspicious, "A", ReturnDrop},
+	}
+	for _, tc := range testcases {
+		config.Suspicious.Action = tc.action
+		if _, err := suspicious.GetTransforms(); err != nil {
+			t.Fatal(err)
+		}
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qtype = tc.qtype
+		if result, _ := suspicious.checkIfSuspicious(&dm); result != tc.result {
+			t.Errorf("%s %s: result %d expected, got %d", tc.action, tc.qtype, tc.result, result)
+		}
+	}
+
+	config.Suspicious.Action = "alert"
+	if _, err := suspicious.GetTransforms(); err == nil {
+		t.Errorf("error expected for an invalid action")
+	}
+}
@@ -0,0 +1,450 @@
+package transformers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/miekg/dns"
+	"inet.af/netaddr"
+)
+
+// threatIntelEntry is an indicator of a source, the action is set for the RPZ triggers
+type threatIntelEntry struct {
+	source int
+	action string
+}
+
+// threatIntelHit is an indicator matched by a lookup
+type threatIntelHit struct {
+	source    int
+	action    string
+	indicator string
+}
+
+// threat intel indexes, domains are matched exactly or on their parents for wildcards,
+// ip addresses on the longest prefix
+type ThreatIntelIndex struct {
+	exact    map[string][]threatIntelEntry
+	wildcard map[string][]threatIntelEntry
+	prefixes map[netaddr.IPPrefix][]threatIntelEntry
+	bits     map[uint8]bool
+	sources  []pkgconfig.ThreatIntelSource
+}
+
+func NewThreatIntelIndex(sources []pkgconfig.ThreatIntelSource) *ThreatIntelIndex {
+	return &ThreatIntelIndex{
+		exact:    make(map[string][]threatIntelEntry),
+		wildcard: make(map[string][]threatIntelEntry),
+		prefixes: make(map[netaddr.IPPrefix][]threatIntelEntry),
+		bits:     make(map[uint8]bool),
+		sources:  sources,
+	}
+}
+
+func (idx *ThreatIntelIndex) AddDomain(domain string, source int, wildcard bool, action string) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if len(domain) == 0 {
+		return
+	}
+	entry := threatIntelEntry{source: source, action: action}
+	if wildcard {
+		idx.wildcard[domain] = append(idx.wildcard[domain], entry)
+	} else {
+		idx.exact[domain] = append(idx.exact[domain], entry)
+	}
+}
+
+func (idx *ThreatIntelIndex) AddPrefix(prefix netaddr.IPPrefix, source int, action string) {
+	prefix = prefix.Masked()
+	idx.prefixes[prefix] = append(idx.prefixes[prefix], threatIntelEntry{source: source, action: action})
+	idx.bits[prefix.Bits()] = true
+}
+
+// collectHits keeps the most specific entry of each source,
+// the passthru entries exempt the indicator from the less specific ones
+func collectHits(hits []threatIntelHit, decided map[int]bool, entries []threatIntelEntry, indicator string) []threatIntelHit {
+	for _, entry := range entries {
+		if decided[entry.source] {
+			continue
+		}
+		decided[entry.source] = true
+		if entry.action != dnsutils.ThreatIntelActionPassthru {
+			hits = append(hits, threatIntelHit{source: entry.source, action: entry.action, indicator: indicator})
+		}
+	}
+	return hits
+}
+
+// LookupDomain returns the indicators matching the domain
+func (idx *ThreatIntelIndex) LookupDomain(domain string) []threatIntelHit {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	hits := []threatIntelHit{}
+	decided := make(map[int]bool)
+	if entries, ok := idx.exact[domain]; ok {
+		hits = collectHits(hits, decided, entries, domain)
+	}
+	for i := strings.IndexByte(domain, '.'); i >= 0; i = strings.IndexByte(domain, '.') {
+		domain = domain[i+1:]
+		if entries, ok := idx.wildcard[domain]; ok {
+			hits = collectHits(hits, decided, entries, "*."+domain)
+		}
+	}
+	return hits
+}
+
+// LookupIP returns the indicators matching the ip, from the longest prefix
+func (idx *ThreatIntelIndex) LookupIP(value string) []threatIntelHit {
+	hits := []threatIntelHit{}
+	ip, err := netaddr.ParseIP(value)
+	if err != nil {
+		return hits
+	}
+	decided := make(map[int]bool)
+	for bits := int(ip.BitLen()); bits >= 0; bits-- {
+		if !idx.bits[uint8(bits)] {
+			continue
+		}
+		prefix, err := ip.Prefix(uint8(bits))
+		if err != nil {
+			continue
+		}
+		if entries, ok := idx.prefixes[prefix]; ok {
+			hits = collectHits(hits, decided, entries, prefix.String())
+		}
+	}
+	return hits
+}
+
+// threat intel transformer
+type ThreatIntelTransform struct {
+	GenericTransformer
+	sync.RWMutex
+	index      *ThreatIntelIndex
+	httpclient *http.Client
+	stopReload chan struct{}
+}
+
+func NewThreatIntelTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *ThreatIntelTransform {
+	t := &ThreatIntelTransform{GenericTransformer: NewTransformer(config, logger, "threat-intel", name, instance, nextWorkers)}
+	t.index = NewThreatIntelIndex(nil)
+	return t
+}
+
+func (t *ThreatIntelTransform) GetTransforms() ([]Subtransform, error) {
+	t.stopReloader()
+
+	subtransforms := []Subtransform{}
+	if !t.config.ThreatIntel.Enable {
+		return subtransforms, nil
+	}
+
+	t.httpclient = &http.Client{Timeout: time.Duration(t.config.ThreatIntel.HTTPTimeout) * time.Second}
+	if err := t.LoadSources(t.config.ThreatIntel.Sources); err != nil {
+		return nil, err
+	}
+
+	if t.config.ThreatIntel.ReloadInterval > 0 {
+		t.stopReload = make(chan struct{})
+		go t.reloadPeriodically(t.config.ThreatIntel.Sources, time.Duration(t.config.ThreatIntel.ReloadInterval)*time.Second, t.stopReload)
+	}
+
+	subtransforms = append(subtransforms, Subtransform{name: "threat-intel:match", processFunc: t.matchIndicators})
+	return subtransforms, nil
+}
+
+func (t *ThreatIntelTransform) Reset() {
+	t.stopReloader()
+}
+
+func (t *ThreatIntelTransform) stopReloader() {
+	if t.stopReload != nil {
+		close(t.stopReload)
+		t.stopReload = nil
+	}
+}
+
+func (t *ThreatIntelTransform) reloadPeriodically(sources []pkgconfig.ThreatIntelSource, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// the previous indicators are kept on error
+			if err := t.LoadSources(sources); err != nil {
+				t.LogError("reload failed: %v", err)
+			}
+		}
+	}
+}
+
+// LoadSources reads all the sources and replaces the current indicators
+func (t *ThreatIntelTransform) LoadSources(sources []pkgconfig.ThreatIntelSource) error {
+	index := NewThreatIntelIndex(sources)
+
+	for i, source := range sources {
+		data, err := t.readSource(source)
+		if err != nil {
+			return fmt.Errorf("unable to read source %s: %w", source.Name, err)
+		}
+
+		var read int
+		var invalid []string
+		switch source.Format {
+		case dnsutils.ThreatIntelFormatRPZ:
+			read, invalid, err = loadRPZ(index, i, data)
+		case dnsutils.ThreatIntelFormatDomains:
+			read, err = loadDomainsList(index, i, data)
+		case dnsutils.ThreatIntelFormatIPs:
+			read, err = loadIPsList(index, i, data)
+		default:
+			err = fmt.Errorf("invalid format: %s", source.Format)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to load source %s: %w", source.Name, err)
+		}
+		for _, trigger := range invalid {
+			t.LogError("source %s: invalid trigger %s ignored", source.Name, trigger)
+		}
+		t.LogInfo("source %s loaded with %d indicators", source.Name, read)
+	}
+
+	t.Lock()
+	t.index = index
+	t.Unlock()
+	return nil
+}
+
+func (t *ThreatIntelTransform) readSource(source pkgconfig.ThreatIntelSource) ([]byte, error) {
+	if len(source.URL) > 0 {
+		resp, err := t.httpclient.Get(source.URL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("invalid HTTP status code: %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+	return os.ReadFile(source.File)
+}
+
+// listEntries returns the last field of each line, comments and empty lines are ignored
+// to support hosts files
+func listEntries(data []byte) []string {
+	entries := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entries = append(entries, fields[len(fields)-1])
+	}
+	return entries
+}
+
+// plain domains lists, the domain and its subdomains are matched
+func loadDomainsList(index *ThreatIntelIndex, source int, data []byte) (int, error) {
+	entries := listEntries(data)
+	for _, domain := range entries {
+		domain = strings.TrimPrefix(domain, "*.")
+		index.AddDomain(domain, source, false, "")
+		index.AddDomain(domain, source, true, "")
+	}
+	return len(entries), nil
+}
+
+func loadIPsList(index *ThreatIntelIndex, source int, data []byte) (int, error) {
+	read := 0
+	for _, entry := range listEntries(data) {
+		prefix, err := parseIPOrPrefix(entry)
+		if err != nil {
+			return read, err
+		}
+		index.AddPrefix(prefix, source, "")
+		read++
+	}
+	return read, nil
+}
+
+func parseIPOrPrefix(value string) (netaddr.IPPrefix, error) {
+	if prefix, err := netaddr.ParseIPPrefix(value); err == nil {
+		return prefix, nil
+	}
+	ip, err := netaddr.ParseIP(value)
+	if err != nil {
+		return netaddr.IPPrefix{}, fmt.Errorf("%s is neither an IP address nor a prefix", value)
+	}
+	return netaddr.IPPrefixFrom(ip, ip.BitLen()), nil
+}
+
+// rpzAction returns the action of a CNAME trigger, the target of the legacy passthru is the trigger itself
+func rpzAction(target, trigger string) string {
+	switch target {
+	case ".":
+		return dnsutils.ThreatIntelActionNXDomain
+	case "*.":
+		return dnsutils.ThreatIntelActionNoData
+	case "rpz-passthru.", trigger + ".":
+		return dnsutils.ThreatIntelActionPassthru
+	case "rpz-drop.":
+		return dnsutils.ThreatIntelActionDrop
+	case "rpz-tcp-only.":
+		return dnsutils.ThreatIntelActionTCPOnly
+	}
+	return dnsutils.ThreatIntelActionLocalData
+}
+
+// RPZ zones, QNAME and response IP triggers are loaded, other triggers are ignored,
+// returns the invalid triggers ignored
+func loadRPZ(index *ThreatIntelIndex, source int, data []byte) (int, []string, error) {
+	zone := ""
+	owners := []string{}
+	targets := make(map[string]string)
+
+	zp := dns.NewZoneParser(bytes.NewReader(data), ".", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := strings.ToLower(rr.Header().Name)
+		if rr.Header().Rrtype == dns.TypeSOA && len(zone) == 0 {
+			zone = owner
+			continue
+		}
+		if owner == zone {
+			continue
+		}
+		if _, found := targets[owner]; !found {
+			owners = append(owners, owner)
+			targets[owner] = ""
+		}
+		// the other records are local data
+		if cname, ok := rr.(*dns.CNAME); ok {
+			targets[owner] = strings.ToLower(cname.Target)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	read := 0
+	invalid := []string{}
+	for _, owner := range owners {
+		trigger := strings.TrimSuffix(strings.TrimSuffix(owner, zone), ".")
+		action := dnsutils.ThreatIntelActionLocalData
+		if target := targets[owner]; len(target) > 0 {
+			action = rpzAction(target, trigger)
+		}
+
+		switch {
+		case strings.HasSuffix(trigger, ".rpz-ip"):
+			prefix, err := parseRPZIP(strings.TrimSuffix(trigger, ".rpz-ip"))
+			if err != nil {
+				invalid = append(invalid, trigger)
+				continue
+			}
+			index.AddPrefix(prefix, source, action)
+		case strings.HasSuffix(trigger, ".rpz-nsip"), strings.HasSuffix(trigger, ".rpz-nsdname"),
+			strings.HasSuffix(trigger, ".rpz-client-ip"):
+			continue
+		case strings.HasPrefix(trigger, "*."):
+			index.AddDomain(strings.TrimPrefix(trigger, "*."), source, true, action)
+		default:
+			index.AddDomain(trigger, source, false, action)
+		}
+		// the passthru triggers are exemptions, not indicators
+		if action != dnsutils.ThreatIntelActionPassthru {
+			read++
+		}
+	}
+	return read, invalid, nil
+}
+
+// parseRPZIP decodes the reversed notation of the rpz-ip triggers,
+// 24.0.2.0.192 for 192.0.2.0/24 or 48.zz.db8.2001 for 2001:db8::/48
+func parseRPZIP(trigger string) (netaddr.IPPrefix, error) {
+	labels := strings.Split(trigger, ".")
+	if len(labels) < 2 {
+		return netaddr.IPPrefix{}, fmt.Errorf("invalid rpz-ip trigger: %s", trigger)
+	}
+	bits, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return netaddr.IPPrefix{}, fmt.Errorf("invalid rpz-ip trigger: %s", trigger)
+	}
+
+	parts := labels[1:]
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	var address string
+	if len(parts) == 4 && !strings.Contains(trigger, "zz") {
+		address = strings.Join(parts, ".")
+	} else {
+		address = strings.Join(parts, ":")
+		switch {
+		case strings.Contains(address, ":zz:"):
+			address = strings.Replace(address, ":zz:", "::", 1)
+		case strings.HasPrefix(address, "zz:"):
+			address = "::" + strings.TrimPrefix(address, "zz:")
+		case strings.HasSuffix(address, ":zz"):
+			address = strings.TrimSuffix(address, ":zz") + "::"
+		}
+	}
+
+	return netaddr.ParseIPPrefix(address + "/" + strconv.Itoa(bits))
+}
+
+func (t *ThreatIntelTransform) addMatches(dm *dnsutils.DNSMessage, hits []threatIntelHit, field string, index *ThreatIntelIndex) {
+	for _, hit := range hits {
+		source := index.sources[hit.source]
+		dm.ThreatIntel.Matches = append(dm.ThreatIntel.Matches, dnsutils.ThreatIntelMatch{
+			List:      source.Name,
+			Category:  source.Category,
+			Severity:  source.Severity,
+			Field:     field,
+			Indicator: hit.indicator,
+			Action:    hit.action,
+		})
+	}
+}
+
+func (t *ThreatIntelTransform) matchIndicators(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.ThreatIntel == nil {
+		dm.ThreatIntel = &dnsutils.TransformThreatIntel{Matches: []dnsutils.ThreatIntelMatch{}}
+	}
+
+	t.RLock()
+	index := t.index
+	t.RUnlock()
+
+	// qname
+	t.addMatches(dm, index.LookupDomain(dm.DNS.Qname), dnsutils.ThreatIntelFieldQname, index)
+
+	// cname targets and answers rdata
+	for _, answer := range dm.DNS.DNSRRs.Answers {
+		switch answer.Rdatatype {
+		case "CNAME":
+			t.addMatches(dm, index.LookupDomain(answer.Rdata), dnsutils.ThreatIntelFieldCNAME, index)
+		case "A", "AAAA":
+			t.addMatches(dm, index.LookupIP(answer.Rdata), dnsutils.ThreatIntelFieldRdata, index)
+		}
+	}
+	return ReturnKeep, nil
+}
@@ -0,0 +1,208 @@
+package transformers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+const testRPZZone = `$TTL 300
+$ORIGIN rpz.local.
+@ IN SOA localhost. root.localhost. 1 3600 600 86400 300
+@ IN NS localhost.
+malware.example.com CNAME .
+*.phishing.example CNAME .
+login.phishing.example CNAME rpz-passthru.
+legacy.phishing.example CNAME legacy.phishing.example.
+tracker.example.com CNAME rpz-drop.
+big.example.com CNAME rpz-tcp-only.
+redirect.example.com CNAME walled.garden.example.
+local.example.com A 192.0.2.53
+32.1.2.0.192.rpz-ip CNAME .
+24.0.100.51.198.rpz-ip CNAME *.
+32.7.100.51.198.rpz-ip CNAME rpz-passthru.
+48.zz.db8.2001.rpz-ip CNAME .
+bad.rpz-ip CNAME .
+ns.bad.example.rpz-nsdname CNAME .
+`
+
+func writeThreatIntelFile(t *testing.T, name, content string) string {
+	fname := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fname, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func TestThreatIntel_RPZ(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ThreatIntel.Enable = true
+	config.ThreatIntel.Sources = []pkgconfig.ThreatIntelSource{
+		{Name: "rpz", Category: "malware", Severity: "high", Format: dnsutils.ThreatIntelFormatRPZ, File: writeThreatIntelFile(t, "rpz.zone", testRPZZone)},
+	}
+
+	threat := NewThreatIntelTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := threat.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer threat.Reset()
+
+	testcases := []struct {
+		qname     string
+		answers   []dnsutils.DNSAnswer
+		field     string
+		indicator string
+		action    string
+	}{
+		{qname: "malware.example.com", field: dnsutils.ThreatIntelFieldQname, indicator: "malware.example.com", action: dnsutils.ThreatIntelActionNXDomain},
+		{qname: "www.phishing.example", field: dnsutils.ThreatIntelFieldQname, indicator: "*.phishing.example", action: dnsutils.ThreatIntelActionNXDomain},
+		{qname: "tracker.example.com", field: dnsutils.ThreatIntelFieldQname, indicator: "tracker.example.com", action: dnsutils.ThreatIntelActionDrop},
+		{qname: "big.example.com", field: dnsutils.ThreatIntelFieldQname, indicator: "big.example.com", action: dnsutils.ThreatIntelActionTCPOnly},
+		{qname: "redirect.example.com", field: dnsutils.ThreatIntelFieldQname, indicator: "redirect.example.com", action: dnsutils.ThreatIntelActionLocalData},
+		{qname: "local.example.com", field: dnsutils.ThreatIntelFieldQname, indicator: "local.example.com", action: dnsutils.ThreatIntelActionLocalData},
+		{qname: "www.example.org", answers: []dnsutils.DNSAnswer{{Rdatatype: "A", Rdata: "192.0.2.1"}},
+			field: dnsutils.ThreatIntelFieldRdata, indicator: "192.0.2.1/32", action: dnsutils.ThreatIntelActionNXDomain},
+		{qname: "www.example.org", answers: []dnsutils.DNSAnswer{{Rdatatype: "A", Rdata: "198.51.100.8"}},
+			field: dnsutils.ThreatIntelFieldRdata, indicator: "198.51.100.0/24", action: dnsutils.ThreatIntelActionNoData},
+		{qname: "www.example.org", answers: []dnsutils.DNSAnswer{{Rdatatype: "AAAA", Rdata: "2001:db8::1"}},
+			field: dnsutils.ThreatIntelFieldRdata, indicator: "2001:db8::/48", action: dnsutils.ThreatIntelActionNXDomain},
+		{qname: "www.example.org", answers: []dnsutils.DNSAnswer{{Rdatatype: "CNAME", Rdata: "malware.example.com"}},
+			field: dnsutils.ThreatIntelFieldCNAME, indicator: "malware.example.com", action: dnsutils.ThreatIntelActionNXDomain},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.qname+"/"+tc.field, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = tc.qname
+			dm.DNS.DNSRRs.Answers = tc.answers
+
+			threat.matchIndicators(&dm)
+
+			if len(dm.ThreatIntel.Matches) != 1 {
+				t.Fatalf("want 1 match, got %v", dm.ThreatIntel.Matches)
+			}
+			match := dm.ThreatIntel.Matches[0]
+			if match.List != "rpz" || match.Category != "malware" || match.Severity != "high" {
+				t.Errorf("invalid source: %+v", match)
+			}
+			if match.Field != tc.field || match.Indicator != tc.indicator || match.Action != tc.action {
+				t.Errorf("want %s/%s/%s, got %s/%s/%s", tc.field, tc.indicator, tc.action, match.Field, match.Indicator, match.Action)
+			}
+		})
+	}
+
+	// the apex of the wildcard, the nsdname triggers and the passthru exemptions are not matched
+	for _, qname := range []string{"phishing.example", "ns.bad.example", "example.com", "login.phishing.example", "legacy.phishing.example"} {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = qname
+		threat.matchIndicators(&dm)
+		if len(dm.ThreatIntel.Matches) != 0 {
+			t.Errorf("%s: unexpected matches %v", qname, dm.ThreatIntel.Matches)
+		}
+	}
+
+	// the passthru prefix overrides the larger one
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{{Rdatatype: "A", Rdata: "198.51.100.7"}}
+	threat.matchIndicators(&dm)
+	if len(dm.ThreatIntel.Matches) != 0 {
+		t.Errorf("198.51.100.7: unexpected matches %v", dm.ThreatIntel.Matches)
+	}
+}
+
+func TestThreatIntel_Lists(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ThreatIntel.Enable = true
+	config.ThreatIntel.Sources = []pkgconfig.ThreatIntelSource{
+		{Name: "hosts", Category: "ads", Severity: "low", Format: dnsutils.ThreatIntelFormatDomains,
+			File: writeThreatIntelFile(t, "hosts.txt", "# comment\n0.0.0.0 tracker.example\n\nads.example # inline\n")},
+		{Name: "c2", Category: "c2", Severity: "critical", Format: dnsutils.ThreatIntelFormatIPs,
+			File: writeThreatIntelFile(t, "ips.txt", "198.51.100.0/24\n198.51.100.7\n")},
+	}
+
+	threat := NewThreatIntelTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := threat.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	// subdomains of a listed domain are matched
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "cdn.tracker.example"
+	dm.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{{Rdatatype: "A", Rdata: "198.51.100.7"}, {Rdatatype: "A", Rdata: "198.51.100.8"}}
+	threat.matchIndicators(&dm)
+
+	want := []dnsutils.ThreatIntelMatch{
+		{List: "hosts", Category: "ads", Severity: "low", Field: dnsutils.ThreatIntelFieldQname, Indicator: "*.tracker.example"},
+		{List: "c2", Category: "c2", Severity: "critical", Field: dnsutils.ThreatIntelFieldRdata, Indicator: "198.51.100.7/32"},
+		{List: "c2", Category: "c2", Severity: "critical", Field: dnsutils.ThreatIntelFieldRdata, Indicator: "198.51.100.0/24"},
+	}
+	if len(dm.ThreatIntel.Matches) != len(want) {
+		t.Fatalf("want %v, got %v", want, dm.ThreatIntel.Matches)
+	}
+	for i := range want {
+		if dm.ThreatIntel.Matches[i] != want[i] {
+			t.Errorf("want %+v, got %+v", want[i], dm.ThreatIntel.Matches[i])
+		}
+	}
+}
+
+func TestThreatIntel_ReloadHTTP(t *testing.T) {
+	var content atomic.Value
+	content.Store("first.example\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content.Load().(string)))
+	}))
+	defer server.Close()
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ThreatIntel.Enable = true
+	config.ThreatIntel.ReloadInterval = 1
+	config.ThreatIntel.Sources = []pkgconfig.ThreatIntelSource{
+		{Name: "feed", Category: "malware", Severity: "medium", Format: dnsutils.ThreatIntelFormatDomains, URL: server.URL},
+	}
+
+	threat := NewThreatIntelTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := threat.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	defer threat.Reset()
+
+	matches := func(qname string) int {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = qname
+		threat.matchIndicators(&dm)
+		return len(dm.ThreatIntel.Matches)
+	}
+
+	if matches("first.example") != 1 || matches("second.example") != 0 {
+		t.Fatal("invalid initial indicators")
+	}
+
+	content.Store("second.example\n")
+	time.Sleep(1500 * time.Millisecond)
+
+	if matches("first.example") != 0 || matches("second.example") != 1 {
+		t.Error("indicators not reloaded")
+	}
+}
+
+func TestThreatIntel_InvalidFormat(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ThreatIntel.Enable = true
+	config.ThreatIntel.Sources = []pkgconfig.ThreatIntelSource{
+		{Name: "bad", Format: "csv", File: writeThreatIntelFile(t, "bad.txt", "x\n")},
+	}
+
+	threat := NewThreatIntelTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := threat.GetTransforms(); err == nil {
+		t.Error("error expected on invalid format")
+	}
+}
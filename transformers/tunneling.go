@@ -0,0 +1,201 @@
+package transformers
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	lru "github.com/hashicorp/golang-lru/v2"
+	publicsuffixlist "golang.org/x/net/publicsuffix"
+)
+
+// the sliding window is divided in slots, the oldest slot is reused when the window moves
+const tunnelingSlots = 6
+
+type tunnelingSlot struct {
+	epoch      int64
+	queries    int
+	bytes      int
+	entropy    float64
+	subdomains map[string]struct{}
+}
+
+// sliding window counters per (client, eTLD+1)
+type TunnelingStats struct {
+	slots [tunnelingSlots]tunnelingSlot
+}
+
+func (s *TunnelingStats) slot(epoch int64) *tunnelingSlot {
+	slot := &s.slots[epoch%tunnelingSlots]
+	if slot.epoch != epoch {
+		*slot = tunnelingSlot{epoch: epoch, subdomains: make(map[string]struct{})}
+	}
+	return slot
+}
+
+// aggregate returns the counters of the window ending with the epoch,
+// unique subdomains are counted up to the limit
+func (s *TunnelingStats) aggregate(epoch int64, limit int) (queries, bytes, unique int, entropy float64) {
+	seen := make(map[string]struct{})
+	for i := range s.slots {
+		slot := &s.slots[i]
+		if slot.epoch <= epoch-tunnelingSlots || slot.epoch > epoch {
+			continue
+		}
+		queries += slot.queries
+		bytes += slot.bytes
+		entropy += slot.entropy
+		for subdomain := range slot.subdomains {
+			if len(seen) > limit {
+				break
+			}
+			seen[subdomain] = struct{}{}
+		}
+	}
+	return queries, bytes, len(seen), entropy
+}
+
+type TunnelingTransform struct {
+	GenericTransformer
+	stats                 *lru.Cache[string, *TunnelingStats]
+	slotDuration          int64
+	whitelistDomainsRegex []*regexp.Regexp
+}
+
+func NewTunnelingTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *TunnelingTransform {
+	t := &TunnelingTransform{GenericTransformer: NewTransformer(config, logger, "tunneling", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *TunnelingTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if !t.config.Tunneling.Enable {
+		return subtransforms, nil
+	}
+
+	stats, err := lru.New[string, *TunnelingStats](t.config.Tunneling.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	t.stats = stats
+	t.slotDuration = int64(time.Duration(t.config.Tunneling.Window) * time.Second / tunnelingSlots)
+	if t.slotDuration <= 0 {
+		t.slotDuration = 1
+	}
+
+	t.whitelistDomainsRegex = t.whitelistDomainsRegex[:0]
+	for _, v := range t.config.Tunneling.WhitelistDomains {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		t.whitelistDomainsRegex = append(t.whitelistDomainsRegex, re)
+	}
+
+	subtransforms = append(subtransforms, Subtransform{name: "tunneling:detect", processFunc: t.detectTunneling})
+	return subtransforms, nil
+}
+
+// subdomainEntropy returns the shannon entropy of the subdomain without the dots
+func subdomainEntropy(subdomain string) float64 {
+	uniq := make(map[rune]int)
+	n := 0
+	for _, c := range subdomain {
+		if c == '.' {
+			continue
+		}
+		uniq[c]++
+		n++
+	}
+
+	var entropy float64
+	for _, count := range uniq {
+		prob := float64(count) / float64(n)
+		entropy -= prob * math.Log2(prob)
+	}
+	return entropy
+}
+
+// answersSize returns the size of the TXT and NULL records of the answers
+func answersSize(dm *dnsutils.DNSMessage) int {
+	size := 0
+	for _, answer := range dm.DNS.DNSRRs.Answers {
+		if answer.Rdatatype == "TXT" || answer.Rdatatype == "NULL" {
+			size += len(answer.Rdata)
+		}
+	}
+	return size
+}
+
+func (t *TunnelingTransform) detectTunneling(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.Tunneling == nil {
+		dm.Tunneling = &dnsutils.TransformTunneling{Reasons: []string{}, Domain: "-"}
+	}
+
+	qname := strings.ToLower(strings.TrimSuffix(dm.DNS.Qname, "."))
+	etld1, err := publicsuffixlist.EffectiveTLDPlusOne(qname)
+	if err != nil {
+		return ReturnKeep, nil
+	}
+	for _, d := range t.whitelistDomainsRegex {
+		if d.MatchString(qname) {
+			return ReturnKeep, nil
+		}
+	}
+	dm.Tunneling.Domain = etld1
+
+	// update the counters of the client for the domain
+	timestamp := dm.DNSTap.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano()
+	}
+	epoch := timestamp / t.slotDuration
+
+	key := dm.NetworkInfo.QueryIP + "|" + etld1
+	stats, ok := t.stats.Get(key)
+	if !ok {
+		stats = &TunnelingStats{}
+		t.stats.Add(key, stats)
+	}
+
+	slot := stats.slot(epoch)
+	slot.bytes += dm.DNS.Length
+	if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
+		subdomain := strings.TrimSuffix(strings.TrimSuffix(qname, etld1), ".")
+		slot.queries++
+		slot.entropy += subdomainEntropy(subdomain)
+		if len(subdomain) > 0 && len(slot.subdomains) <= t.config.Tunneling.ThresholdUniqueSubdomains {
+			slot.subdomains[subdomain] = struct{}{}
+		}
+	}
+
+	queries, bytes, unique, entropy := stats.aggregate(epoch, t.config.Tunneling.ThresholdUniqueSubdomains)
+	dm.Tunneling.UniqueSubdomains = unique
+	dm.Tunneling.Bytes = bytes
+	if queries > 0 {
+		dm.Tunneling.Entropy = entropy / float64(queries)
+	}
+
+	// score the message
+	if unique > t.config.Tunneling.ThresholdUniqueSubdomains {
+		dm.Tunneling.Score += 1.0
+		dm.Tunneling.Reasons = append(dm.Tunneling.Reasons, dnsutils.TunnelingReasonUniqueSubdomains)
+	}
+	if queries >= t.config.Tunneling.MinQueries && dm.Tunneling.Entropy >= t.config.Tunneling.ThresholdEntropy {
+		dm.Tunneling.Score += 1.0
+		dm.Tunneling.Reasons = append(dm.Tunneling.Reasons, dnsutils.TunnelingReasonEntropy)
+	}
+	if answersSize(dm) > t.config.Tunneling.ThresholdAnswerSize {
+		dm.Tunneling.Score += 1.0
+		dm.Tunneling.Reasons = append(dm.Tunneling.Reasons, dnsutils.TunnelingReasonLargeAnswers)
+	}
+	if bytes > t.config.Tunneling.ThresholdBytes {
+		dm.Tunneling.Score += 1.0
+		dm.Tunneling.Reasons = append(dm.Tunneling.Reasons, dnsutils.TunnelingReasonVolume)
+	}
+	return ReturnKeep, nil
+}
@@ -0,0 +1,154 @@
+package transformers
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+// dnscatMessages generates dnscat-like traffic, queries with hex encoded payloads
+// in the subdomain and TXT answers
+func dnscatMessages(n int, clientIP string, start int64) []dnsutils.DNSMessage {
+	rnd := rand.New(rand.NewSource(1))
+	messages := []dnsutils.DNSMessage{}
+	for i := 0; i < n; i++ {
+		payload := make([]byte, 30)
+		rnd.Read(payload)
+		qname := hex.EncodeToString(payload[:15]) + "." + hex.EncodeToString(payload[15:]) + ".tunnel.example.com"
+
+		query := dnsutils.GetFakeDNSMessage()
+		query.NetworkInfo.QueryIP = clientIP
+		query.DNS.Qname = qname
+		query.DNS.Qtype = "TXT"
+		query.DNS.Length = 90
+		query.DNSTap.Timestamp = start + int64(i)*100000000
+
+		answer := make([]byte, 120)
+		rnd.Read(answer)
+		reply := query
+		reply.DNS.Type = dnsutils.DNSReply
+		reply.DNS.Length = 350
+		reply.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{{Name: qname, Rdatatype: "TXT", Rdata: hex.EncodeToString(answer)}}
+
+		messages = append(messages, query, reply)
+	}
+	return messages
+}
+
+func TestTunneling_DnscatTraffic(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Tunneling.Enable = true
+
+	tunneling := NewTunnelingTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := tunneling.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	var last dnsutils.DNSMessage
+	for _, dm := range dnscatMessages(100, "10.0.0.1", 1704486841000000000) {
+		tunneling.detectTunneling(&dm)
+		last = dm
+	}
+
+	if last.Tunneling.Domain != "example.com" {
+		t.Errorf("want domain example.com, got %s", last.Tunneling.Domain)
+	}
+	if last.Tunneling.Score != 4 {
+		t.Errorf("want score 4, got %f (%v)", last.Tunneling.Score, last.Tunneling.Reasons)
+	}
+	want := []string{
+		dnsutils.TunnelingReasonUniqueSubdomains,
+		dnsutils.TunnelingReasonEntropy,
+		dnsutils.TunnelingReasonLargeAnswers,
+		dnsutils.TunnelingReasonVolume,
+	}
+	for i, reason := range want {
+		if i >= len(last.Tunneling.Reasons) || last.Tunneling.Reasons[i] != reason {
+			t.Errorf("want reasons %v, got %v", want, last.Tunneling.Reasons)
+			break
+		}
+	}
+}
+
+func TestTunneling_NormalTraffic(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Tunneling.Enable = true
+
+	tunneling := NewTunnelingTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := tunneling.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	qnames := []string{"www.example.com", "mail.example.com", "cdn.example.com", "example.com", "api.example.com"}
+	for i := 0; i < 100; i++ {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = qnames[i%len(qnames)]
+		dm.DNS.Length = 50
+		dm.DNSTap.Timestamp = 1704486841000000000 + int64(i)*100000000
+		tunneling.detectTunneling(&dm)
+
+		if dm.Tunneling.Score != 0 {
+			t.Fatalf("%s: unexpected score %f (%v)", dm.DNS.Qname, dm.Tunneling.Score, dm.Tunneling.Reasons)
+		}
+	}
+}
+
+func TestTunneling_PerClientAndWindow(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Tunneling.Enable = true
+	config.Tunneling.Window = 6
+
+	tunneling := NewTunnelingTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := tunneling.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := int64(1704486841000000000)
+	for _, dm := range dnscatMessages(60, "10.0.0.1", start) {
+		tunneling.detectTunneling(&dm)
+	}
+
+	// another client querying the same domain is not impacted
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "10.0.0.2"
+	dm.DNS.Qname = "www.tunnel.example.com"
+	dm.DNSTap.Timestamp = start + 6000000000
+	tunneling.detectTunneling(&dm)
+	if dm.Tunneling.UniqueSubdomains != 1 || dm.Tunneling.Score != 0 {
+		t.Errorf("unexpected stats for another client: %+v", dm.Tunneling)
+	}
+
+	// the counters of the client expire with the window
+	dm = dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "10.0.0.1"
+	dm.DNS.Qname = "www.tunnel.example.com"
+	dm.DNSTap.Timestamp = start + 30000000000
+	tunneling.detectTunneling(&dm)
+	if dm.Tunneling.UniqueSubdomains != 1 || dm.Tunneling.Score != 0 {
+		t.Errorf("counters not expired: %+v", dm.Tunneling)
+	}
+}
+
+func TestTunneling_CacheSize(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Tunneling.Enable = true
+	config.Tunneling.CacheSize = 10
+
+	tunneling := NewTunnelingTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := tunneling.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = "www.domain" + hex.EncodeToString([]byte{byte(i)}) + ".com"
+		tunneling.detectTunneling(&dm)
+	}
+	if n := tunneling.stats.Len(); n != 10 {
+		t.Errorf("want 10 tracked keys, got %d", n)
+	}
+}
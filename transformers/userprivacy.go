@@ -4,9 +4,11 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
@@ -37,6 +39,7 @@ func HashIP(ip string, algo string) string {
 type UserPrivacyTransform struct {
 	GenericTransformer
 	v4Mask, v6Mask net.IPMask
+	keys           PseudonymizationKeys
 }
 
 func NewUserPrivacyTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *UserPrivacyTransform {
@@ -76,6 +79,34 @@ func (t *UserPrivacyTransform) GetTransforms() ([]Subtransform, error) {
 		subprocessors = append(subprocessors, Subtransform{name: "userprivacy:hash-reply-ip", processFunc: t.hashReplyIP})
 	}
 
+	if t.config.UserPrivacy.AnonymizeECS {
+		subprocessors = append(subprocessors, Subtransform{name: "userprivacy:anonymize-ecs", processFunc: t.anonymizeECS})
+	}
+	if t.config.UserPrivacy.HashECS {
+		subprocessors = append(subprocessors, Subtransform{name: "userprivacy:hash-ecs", processFunc: t.hashECS})
+	}
+	if t.config.UserPrivacy.RemoveCookie || t.config.UserPrivacy.RemovePadding {
+		subprocessors = append(subprocessors, Subtransform{name: "userprivacy:remove-edns-options", processFunc: t.removeEDNSOptions})
+	}
+	if t.config.UserPrivacy.AnonymizePTRQname {
+		subprocessors = append(subprocessors, Subtransform{name: "userprivacy:anonymize-ptr-qname", processFunc: t.anonymizePTRQname})
+	}
+
+	t.keys = nil
+	if t.config.UserPrivacy.PseudonymizeQueryIP || t.config.UserPrivacy.PseudonymizeReplyIP ||
+		t.config.UserPrivacy.PseudonymizeECS || t.config.UserPrivacy.PseudonymizeAnswers {
+		mode := t.config.UserPrivacy.PseudonymizeMode
+		if mode != dnsutils.PseudonymizeModeHMAC && mode != dnsutils.PseudonymizeModeCryptoPAn {
+			return nil, fmt.Errorf("invalid pseudonymize mode %s", mode)
+		}
+		t.keys, err = LoadPseudonymizationKeys(t.config.UserPrivacy.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load keys: %w", err)
+		}
+		t.LogInfo("%d pseudonymization key(s) loaded", len(t.keys))
+		subprocessors = append(subprocessors, Subtransform{name: "userprivacy:pseudonymize-ip", processFunc: t.pseudonymizeIP})
+	}
+
 	return subprocessors, nil
 }
 
@@ -105,6 +136,212 @@ func (t *UserPrivacyTransform) hashReplyIP(dm *dnsutils.DNSMessage) (int, error)
 	return ReturnKeep, nil
 }
 
+// keyAt returns the pseudonymization key in use at the date of the message
+func (t *UserPrivacyTransform) keyAt(dm *dnsutils.DNSMessage) *PseudonymizationKey {
+	date := time.Now()
+	if dm.DNSTap.TimeSec > 0 {
+		date = time.Unix(int64(dm.DNSTap.TimeSec), 0)
+	}
+	return t.keys.At(date)
+}
+
+// pseudonymizeIP replaces the addresses with the key in use at the date of the message
+func (t *UserPrivacyTransform) pseudonymizeIP(dm *dnsutils.DNSMessage) (int, error) {
+	key := t.keyAt(dm)
+
+	if t.config.UserPrivacy.PseudonymizeQueryIP {
+		ip := net.ParseIP(dm.NetworkInfo.QueryIP)
+		if ip == nil {
+			return ReturnKeep, fmt.Errorf("not a valid query ip: %v", dm.NetworkInfo.QueryIP)
+		}
+		dm.NetworkInfo.QueryIP = t.pseudonymize(key, ip)
+	}
+
+	if t.config.UserPrivacy.PseudonymizeReplyIP {
+		if ip := net.ParseIP(dm.NetworkInfo.ResponseIP); ip != nil {
+			dm.NetworkInfo.ResponseIP = t.pseudonymize(key, ip)
+		}
+	}
+
+	if t.config.UserPrivacy.PseudonymizeECS {
+		for i := range dm.EDNS.Options {
+			if dm.EDNS.Options[i].Code == 8 {
+				dm.EDNS.Options[i].Data = t.pseudonymizeSubnet(key, dm.EDNS.Options[i].Data)
+			}
+		}
+	}
+
+	if t.config.UserPrivacy.PseudonymizeAnswers {
+		for i, answer := range dm.DNS.DNSRRs.Answers {
+			if answer.Rdatatype != "A" && answer.Rdatatype != "AAAA" {
+				continue
+			}
+			if ip := net.ParseIP(answer.Rdata); ip != nil {
+				dm.DNS.DNSRRs.Answers[i].Rdata = t.pseudonymize(key, ip)
+			}
+		}
+	}
+	return ReturnKeep, nil
+}
+
+func (t *UserPrivacyTransform) pseudonymize(key *PseudonymizationKey, ip net.IP) string {
+	if t.config.UserPrivacy.PseudonymizeMode == dnsutils.PseudonymizeModeHMAC {
+		return key.HMAC(ip.String())
+	}
+	return key.CryptoPAn(ip).String()
+}
+
+// pseudonymizeSubnet keeps the source prefix length of the client subnet
+func (t *UserPrivacyTransform) pseudonymizeSubnet(key *PseudonymizationKey, subnet string) string {
+	network, bracketed, ok := parseECSSubnet(subnet)
+	if !ok {
+		return subnet
+	}
+
+	if t.config.UserPrivacy.PseudonymizeMode == dnsutils.PseudonymizeModeHMAC {
+		return key.HMAC(network.String())
+	}
+	// the first bits of the pseudonym only depend on the first bits of the address
+	network.IP = key.CryptoPAn(network.IP).Mask(network.Mask)
+	return formatECSSubnet(network, bracketed)
+}
+
+// parseECSSubnet reads the client subnet option, 1.2.3.0/24 or [2001:db8::]/56
+func parseECSSubnet(subnet string) (*net.IPNet, bool, bool) {
+	addr, length, found := strings.Cut(subnet, "/")
+	if !found {
+		return nil, false, false
+	}
+	_, network, err := net.ParseCIDR(strings.Trim(addr, "[]") + "/" + length)
+	if err != nil {
+		return nil, false, false
+	}
+	return network, strings.HasPrefix(addr, "["), true
+}
+
+func formatECSSubnet(network *net.IPNet, bracketed bool) string {
+	ones, _ := network.Mask.Size()
+	if bracketed {
+		return fmt.Sprintf("[%s]/%d", network.IP, ones)
+	}
+	return fmt.Sprintf("%s/%d", network.IP, ones)
+}
+
+// anonymizeECS truncates the client subnet with the configured masks
+func (t *UserPrivacyTransform) anonymizeECS(dm *dnsutils.DNSMessage) (int, error) {
+	for i := range dm.EDNS.Options {
+		if dm.EDNS.Options[i].Code != 8 {
+			continue
+		}
+		network, bracketed, ok := parseECSSubnet(dm.EDNS.Options[i].Data)
+		if !ok {
+			continue
+		}
+
+		mask := t.v6Mask
+		if network.IP.To4() != nil {
+			mask = t.v4Mask
+		}
+		// the source prefix length can't be longer than the mask
+		ones, bits := network.Mask.Size()
+		if maskOnes, _ := mask.Size(); maskOnes < ones {
+			network.Mask = net.CIDRMask(maskOnes, bits)
+		}
+		network.IP = network.IP.Mask(network.Mask)
+		dm.EDNS.Options[i].Data = formatECSSubnet(network, bracketed)
+	}
+	return ReturnKeep, nil
+}
+
+// hashECS hashes the client subnet, with the secret key when the pseudonymization is enabled
+// because the unsalted hash of a subnet is easy to reverse
+func (t *UserPrivacyTransform) hashECS(dm *dnsutils.DNSMessage) (int, error) {
+	var key *PseudonymizationKey
+	if len(t.keys) > 0 {
+		key = t.keyAt(dm)
+	}
+	for i := range dm.EDNS.Options {
+		if dm.EDNS.Options[i].Code != 8 {
+			continue
+		}
+		if key != nil {
+			dm.EDNS.Options[i].Data = key.HMAC(dm.EDNS.Options[i].Data)
+		} else {
+			dm.EDNS.Options[i].Data = HashIP(dm.EDNS.Options[i].Data, t.config.UserPrivacy.HashIPAlgo)
+		}
+	}
+	return ReturnKeep, nil
+}
+
+// removeEDNSOptions drops the cookies (10) and the padding (12)
+func (t *UserPrivacyTransform) removeEDNSOptions(dm *dnsutils.DNSMessage) (int, error) {
+	options := dm.EDNS.Options[:0]
+	for _, opt := range dm.EDNS.Options {
+		if (opt.Code == 10 && t.config.UserPrivacy.RemoveCookie) || (opt.Code == 12 && t.config.UserPrivacy.RemovePadding) {
+			continue
+		}
+		options = append(options, opt)
+	}
+	dm.EDNS.Options = options
+	return ReturnKeep, nil
+}
+
+// anonymizePTRQname masks the address of the reverse lookups, 4.3.2.1.in-addr.arpa becomes 0.0.2.1.in-addr.arpa with /16,
+// the partial reverse names are not updated
+func (t *UserPrivacyTransform) anonymizePTRQname(dm *dnsutils.DNSMessage) (int, error) {
+	qname := strings.TrimSuffix(dm.DNS.Qname, ".")
+	lowerQname := strings.ToLower(qname)
+
+	var labels []string
+	var suffix string
+	switch {
+	case strings.HasSuffix(lowerQname, ".in-addr.arpa"):
+		suffix = qname[len(qname)-len(".in-addr.arpa"):]
+		labels = strings.Split(qname[:len(qname)-len(suffix)], ".")
+		if len(labels) != net.IPv4len {
+			return ReturnKeep, nil
+		}
+		ip := net.ParseIP(strings.Join(reverseLabels(labels), "."))
+		if ip == nil {
+			return ReturnKeep, nil
+		}
+		masked := ip.To4().Mask(t.v4Mask)
+		for i := range labels {
+			labels[i] = fmt.Sprintf("%d", masked[net.IPv4len-1-i])
+		}
+
+	case strings.HasSuffix(lowerQname, ".ip6.arpa"):
+		suffix = qname[len(qname)-len(".ip6.arpa"):]
+		labels = strings.Split(qname[:len(qname)-len(suffix)], ".")
+		if len(labels) != net.IPv6len*2 {
+			return ReturnKeep, nil
+		}
+		addr, err := hex.DecodeString(strings.Join(reverseLabels(labels), ""))
+		if err != nil {
+			return ReturnKeep, nil
+		}
+		masked := net.IP(addr).Mask(t.v6Mask)
+		nibbles := hex.EncodeToString(masked)
+		for i := range labels {
+			labels[i] = nibbles[len(nibbles)-1-i : len(nibbles)-i]
+		}
+
+	default:
+		return ReturnKeep, nil
+	}
+
+	dm.DNS.Qname = strings.Join(labels, ".") + suffix + dm.DNS.Qname[len(qname):]
+	return ReturnKeep, nil
+}
+
+func reverseLabels(labels []string) []string {
+	reversed := make([]string, len(labels))
+	for i, label := range labels {
+		reversed[len(labels)-1-i] = label
+	}
+	return reversed
+}
+
 func (t *UserPrivacyTransform) minimizeQname(dm *dnsutils.DNSMessage) (int, error) {
 	if etpo, err := publicsuffix.EffectiveTLDPlusOne(dm.DNS.Qname); err == nil {
 		dm.DNS.Qname = etpo
@@ -0,0 +1,156 @@
+package transformers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// size of the secrets, crypto-pan uses the first half as the aes key and the second half for the pad
+const pseudonymizationKeySize = 32
+
+// CryptoPAn is the prefix-preserving anonymization scheme of Xu, Fan, Ammar and Moon,
+// two addresses sharing a prefix of n bits are mapped to addresses sharing a prefix of n bits
+type CryptoPAn struct {
+	block cipher.Block
+	pad   [aes.BlockSize]byte
+}
+
+func NewCryptoPAn(key []byte) (*CryptoPAn, error) {
+	if len(key) != pseudonymizationKeySize {
+		return nil, fmt.Errorf("crypto-pan key must be %d bytes", pseudonymizationKeySize)
+	}
+	block, err := aes.NewCipher(key[:aes.BlockSize])
+	if err != nil {
+		return nil, err
+	}
+	c := &CryptoPAn{block: block}
+	block.Encrypt(c.pad[:], key[aes.BlockSize:])
+	return c, nil
+}
+
+// Anonymize returns the pseudonymized address, an ipv4 stays an ipv4
+func (c *CryptoPAn) Anonymize(ip net.IP) net.IP {
+	addr := ip.To4()
+	if addr == nil {
+		addr = ip.To16()
+	}
+
+	var input, output [aes.BlockSize]byte
+	result := make(net.IP, len(addr))
+	for pos := 0; pos < len(addr)*8; pos++ {
+		// the first bits of the address followed by the pad
+		copy(input[:], c.pad[:])
+		copy(input[:pos/8], addr[:pos/8])
+		if bits := pos % 8; bits != 0 {
+			mask := byte(0xff << (8 - bits))
+			input[pos/8] = addr[pos/8]&mask | c.pad[pos/8]&^mask
+		}
+		c.block.Encrypt(output[:], input[:])
+		result[pos/8] |= (output[0] >> 7) << (7 - pos%8)
+	}
+
+	for i := range result {
+		result[i] ^= addr[i]
+	}
+	return result
+}
+
+// PseudonymizationKey is a secret used from a date
+type PseudonymizationKey struct {
+	From   time.Time
+	secret []byte
+	pan    *CryptoPAn
+}
+
+func NewPseudonymizationKey(from time.Time, secret []byte) (*PseudonymizationKey, error) {
+	pan, err := NewCryptoPAn(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &PseudonymizationKey{From: from, secret: secret, pan: pan}, nil
+}
+
+// HMAC returns the hex encoded hmac-sha256 of the value
+func (k *PseudonymizationKey) HMAC(value string) string {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CryptoPAn returns the prefix-preserving pseudonym of the address
+func (k *PseudonymizationKey) CryptoPAn(ip net.IP) net.IP {
+	return k.pan.Anonymize(ip)
+}
+
+// PseudonymizationKeys are sorted by date
+type PseudonymizationKeys []*PseudonymizationKey
+
+// LoadPseudonymizationKeys reads one hex encoded key per line, optionally preceded by the date
+// from which the key is used (YYYY-MM-DD), comments start with #
+func LoadPseudonymizationKeys(file string) (PseudonymizationKeys, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := PseudonymizationKeys{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var from time.Time
+		switch len(fields) {
+		case 1:
+		case 2:
+			from, err = time.Parse(time.DateOnly, fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid date %s", line, fields[0])
+			}
+		default:
+			return nil, fmt.Errorf("line %d: expected [date] key", line)
+		}
+
+		secret, err := hex.DecodeString(fields[len(fields)-1])
+		if err != nil || len(secret) != pseudonymizationKeySize {
+			return nil, fmt.Errorf("line %d: the key must be %d hex encoded bytes", line, pseudonymizationKeySize)
+		}
+		key, err := NewPseudonymizationKey(from, secret)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no key found")
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].From.Before(keys[j].From) })
+	return keys, nil
+}
+
+// At returns the most recent key valid at the date, the oldest key is used before its date
+func (keys PseudonymizationKeys) At(date time.Time) *PseudonymizationKey {
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].From.After(date) })
+	if i == 0 {
+		return keys[0]
+	}
+	return keys[i-1]
+}
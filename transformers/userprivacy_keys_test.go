@@ -0,0 +1,114 @@
+package transformers
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// key and addresses of the reference implementation sample
+var cryptoPAnTestKey = []byte{21, 34, 23, 141, 51, 164, 207, 128, 19, 10, 91, 22, 73, 144, 125, 16,
+	216, 152, 143, 131, 121, 121, 101, 39, 98, 87, 76, 45, 42, 132, 34, 2}
+
+func TestCryptoPAn_Reference(t *testing.T) {
+	pan, err := NewCryptoPAn(cryptoPAnTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]string{
+		"128.11.68.132":   "135.242.180.132",
+		"129.118.74.4":    "134.136.186.123",
+		"130.132.252.244": "133.68.164.234",
+		"141.223.7.43":    "141.167.8.160",
+		"141.233.145.108": "141.129.237.235",
+		"152.163.225.39":  "151.140.114.167",
+		"156.29.3.236":    "147.225.12.42",
+		"165.247.96.84":   "162.9.99.234",
+		"166.107.77.190":  "160.132.178.185",
+		"192.102.249.13":  "252.138.62.131",
+	}
+	for ip, want := range testcases {
+		if got := pan.Anonymize(net.ParseIP(ip)).String(); got != want {
+			t.Errorf("%s: want %s got %s", ip, want, got)
+		}
+	}
+}
+
+func TestCryptoPAn_PrefixPreserving(t *testing.T) {
+	pan, _ := NewCryptoPAn(cryptoPAnTestKey)
+
+	testcases := []struct {
+		a, b   string
+		prefix int
+	}{
+		{"192.168.1.2", "192.168.1.200", 24},
+		{"10.0.0.1", "10.0.255.1", 16},
+		{"2001:db8:1:2::1", "2001:db8:1:2::ffff", 64},
+		{"2001:db8:aaaa::1", "2001:db8:bbbb::1", 32},
+	}
+	for _, tc := range testcases {
+		a, b := pan.Anonymize(net.ParseIP(tc.a)), pan.Anonymize(net.ParseIP(tc.b))
+		if (a.To4() == nil) != (net.ParseIP(tc.a).To4() == nil) {
+			t.Errorf("%s: address family changed %s", tc.a, a)
+		}
+		bits := len(a) * 8
+		if len(a) == net.IPv6len && a.To4() != nil {
+			bits = 32
+		}
+		mask := net.CIDRMask(tc.prefix, bits)
+		if !a.Mask(mask).Equal(b.Mask(mask)) {
+			t.Errorf("%s and %s: /%d prefix not preserved, %s %s", tc.a, tc.b, tc.prefix, a, b)
+		}
+		if a.Equal(b) {
+			t.Errorf("%s and %s: same pseudonym", tc.a, tc.b)
+		}
+	}
+}
+
+func TestPseudonymizationKeys_Load(t *testing.T) {
+	key0 := strings.Repeat("00", pseudonymizationKeySize)
+	key1 := strings.Repeat("11", pseudonymizationKeySize)
+	key2 := strings.Repeat("22", pseudonymizationKeySize)
+
+	file := filepath.Join(t.TempDir(), "keys")
+	content := "# rotated every semester\n" +
+		"2024-07-01 " + key2 + "\n" +
+		key0 + "\n" +
+		"2024-01-01 " + key1 + "\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadPseudonymizationKeys(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("3 keys expected, got %d", len(keys))
+	}
+
+	testcases := map[string]byte{
+		"2023-06-01": 0x00,
+		"2024-01-01": 0x11,
+		"2024-06-30": 0x11,
+		"2025-01-01": 0x22,
+	}
+	for date, want := range testcases {
+		d, _ := time.Parse(time.DateOnly, date)
+		if got := keys.At(d).secret[0]; got != want {
+			t.Errorf("%s: key %x expected, got %x", date, want, got)
+		}
+	}
+
+	// invalid files
+	for _, content := range []string{"", "abcd\n", "2024-13-01 " + key0 + "\n", "2024-01-01 " + key0 + " extra\n"} {
+		os.WriteFile(file, []byte(content), 0o600)
+		if _, err := LoadPseudonymizationKeys(file); err == nil {
+			t.Errorf("error expected for %q", content)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package transformers
 
 import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
@@ -268,3 +272,159 @@ func TestUserPrivacy_AnonymizeIPRemove(t *testing.T) {
 		})
 	}
 }
+
+func TestUserPrivacy_PseudonymizeIP(t *testing.T) {
+	// the key of the crypto-pan sample is used from 2024, a null key before
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	content := hex.EncodeToString(make([]byte, 32)) + "\n2024-01-01 " + hex.EncodeToString(cryptoPAnTestKey) + "\n"
+	if err := os.WriteFile(keyFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.UserPrivacy.Enable = true
+	config.UserPrivacy.PseudonymizeQueryIP = true
+	config.UserPrivacy.PseudonymizeReplyIP = true
+	config.UserPrivacy.PseudonymizeECS = true
+	config.UserPrivacy.PseudonymizeAnswers = true
+	config.UserPrivacy.KeyFile = keyFile
+
+	userPrivacy := NewUserPrivacyTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := userPrivacy.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	newMessage := func(date string) dnsutils.DNSMessage {
+		dm := dnsutils.GetFakeDNSMessage()
+		d, _ := time.Parse(time.DateOnly, date)
+		dm.DNSTap.TimeSec = int(d.Unix())
+		dm.NetworkInfo.QueryIP = "128.11.68.132"
+		dm.NetworkInfo.ResponseIP = "129.118.74.4"
+		dm.EDNS.Options = []dnsutils.DNSOption{{Code: 8, Name: "CSUBNET", Data: "128.11.68.0/24"}}
+		dm.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{
+			{Rdatatype: "A", Rdata: "141.223.7.43"},
+			{Rdatatype: "CNAME", Rdata: "141.223.7.43"},
+		}
+		return dm
+	}
+
+	// crypto-pan
+	dm := newMessage("2024-03-01")
+	if _, err := userPrivacy.pseudonymizeIP(&dm); err != nil {
+		t.Fatal(err)
+	}
+	if dm.NetworkInfo.QueryIP != "135.242.180.132" || dm.NetworkInfo.ResponseIP != "134.136.186.123" {
+		t.Errorf("invalid pseudonyms %s %s", dm.NetworkInfo.QueryIP, dm.NetworkInfo.ResponseIP)
+	}
+	if dm.EDNS.Options[0].Data != "135.242.180.0/24" {
+		t.Errorf("ecs subnet not pseudonymized: %s", dm.EDNS.Options[0].Data)
+	}
+	if dm.DNS.DNSRRs.Answers[0].Rdata != "141.167.8.160" || dm.DNS.DNSRRs.Answers[1].Rdata != "141.223.7.43" {
+		t.Errorf("invalid answers %v", dm.DNS.DNSRRs.Answers)
+	}
+
+	// previous key
+	dm = newMessage("2023-12-31")
+	userPrivacy.pseudonymizeIP(&dm)
+	if dm.NetworkInfo.QueryIP == "135.242.180.132" || dm.NetworkInfo.QueryIP == "128.11.68.132" {
+		t.Errorf("the key is not rotated: %s", dm.NetworkInfo.QueryIP)
+	}
+
+	// hmac
+	config.UserPrivacy.PseudonymizeMode = dnsutils.PseudonymizeModeHMAC
+	dm = newMessage("2024-03-01")
+	userPrivacy.pseudonymizeIP(&dm)
+	if len(dm.NetworkInfo.QueryIP) != 64 || dm.NetworkInfo.QueryIP == HashIP("128.11.68.132", "sha256") {
+		t.Errorf("invalid hmac %s", dm.NetworkInfo.QueryIP)
+	}
+	if len(dm.EDNS.Options[0].Data) != 64 {
+		t.Errorf("invalid hmac for the ecs subnet %s", dm.EDNS.Options[0].Data)
+	}
+
+	// the hashed subnet uses the secret key
+	dm = newMessage("2024-03-01")
+	userPrivacy.hashECS(&dm)
+	if dm.EDNS.Options[0].Data == HashIP("128.11.68.0/24", "sha1") || dm.EDNS.Options[0].Data != userPrivacy.keys.At(time.Now()).HMAC("128.11.68.0/24") {
+		t.Errorf("ecs not hashed with the key: %s", dm.EDNS.Options[0].Data)
+	}
+
+	// the key file is required
+	config.UserPrivacy.KeyFile = ""
+	if _, err := userPrivacy.GetTransforms(); err == nil {
+		t.Errorf("error expected without key file")
+	}
+}
+
+func TestUserPrivacy_ScrubEDNS(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.UserPrivacy.Enable = true
+	config.UserPrivacy.AnonymizeECS = true
+	config.UserPrivacy.RemoveCookie = true
+	config.UserPrivacy.RemovePadding = true
+
+	userPrivacy := NewUserPrivacyTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := userPrivacy.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.EDNS.Options = []dnsutils.DNSOption{
+		{Code: 8, Name: "CSUBNET", Data: "192.168.1.0/24"},
+		{Code: 10, Name: "COOKIE", Data: "-"},
+		{Code: 8, Name: "CSUBNET", Data: "[2001:db8:1:2:3::]/96"},
+		{Code: 12, Name: "PADDING", Data: "-"},
+		{Code: 8, Name: "CSUBNET", Data: "10.1.0.0/8"},
+		{Code: 3, Name: "NSID", Data: "-"},
+	}
+	userPrivacy.anonymizeECS(&dm)
+	userPrivacy.removeEDNSOptions(&dm)
+
+	want := []string{"192.168.0.0/16", "[2001:db8:1:2::]/64", "10.0.0.0/8", "-"}
+	if len(dm.EDNS.Options) != len(want) {
+		t.Fatalf("cookie and padding not removed: %v", dm.EDNS.Options)
+	}
+	for i, data := range want {
+		if dm.EDNS.Options[i].Data != data {
+			t.Errorf("option %d: want %s got %s", i, data, dm.EDNS.Options[i].Data)
+		}
+	}
+
+	// hashed subnet
+	dm.EDNS.Options = []dnsutils.DNSOption{{Code: 8, Name: "CSUBNET", Data: "192.168.1.0/24"}}
+	userPrivacy.hashECS(&dm)
+	if dm.EDNS.Options[0].Data != HashIP("192.168.1.0/24", "sha1") {
+		t.Errorf("ecs not hashed: %s", dm.EDNS.Options[0].Data)
+	}
+}
+
+func TestUserPrivacy_AnonymizePTRQname(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.UserPrivacy.Enable = true
+	config.UserPrivacy.AnonymizePTRQname = true
+
+	userPrivacy := NewUserPrivacyTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := userPrivacy.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		qname, want string
+	}{
+		{"2.1.168.192.in-addr.arpa", "0.0.168.192.in-addr.arpa"},
+		{"2.1.168.192.IN-ADDR.ARPA.", "0.0.168.192.IN-ADDR.ARPA."},
+		{"3.5.2.2.2.b.1.c.6.2.6.0.1.1.1.6.2.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+			"0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.2.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+		// partial or invalid reverse names are kept
+		{"168.192.in-addr.arpa", "168.192.in-addr.arpa"},
+		{"x.1.168.192.in-addr.arpa", "x.1.168.192.in-addr.arpa"},
+		{"www.google.com", "www.google.com"},
+	}
+	for _, tc := range testcases {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = tc.qname
+		userPrivacy.anonymizePTRQname(&dm)
+		if dm.DNS.Qname != tc.want {
+			t.Errorf("%s: want %s got %s", tc.qname, tc.want, dm.DNS.Qname)
+		}
+	}
+}
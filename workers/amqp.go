@@ -0,0 +1,460 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPConfirmation is the broker acknowledgement of a published message
+type AMQPConfirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// AMQPChannel is the subset of the amqp channel used by the logger
+type AMQPChannel interface {
+	Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (AMQPConfirmation, error)
+	NotifyClose() <-chan *amqp.Error
+	Close() error
+}
+
+// amqpChannelPublisher wraps the connection and the channel of the amqp091 client
+type amqpChannelPublisher struct {
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	closed  chan *amqp.Error
+}
+
+func (p *amqpChannelPublisher) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (AMQPConfirmation, error) {
+	dc, err := p.channel.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, false, false, msg)
+	if err != nil || dc == nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+func (p *amqpChannelPublisher) NotifyClose() <-chan *amqp.Error { return p.closed }
+
+func (p *amqpChannelPublisher) Close() error {
+	p.channel.Close()
+	return p.conn.Close()
+}
+
+type AMQPPublisher struct {
+	*GenericWorker
+	textFormat                        []string
+	routingKey                        *dnsutils.FieldTemplate
+	publisher                         AMQPChannel
+	newPublisher                      func() (AMQPChannel, error)
+	transportReady                    chan AMQPChannel
+	transportReconnect, stopReconnect chan bool
+	writerReady                       bool
+}
+
+func NewAMQPPublisher(config *pkgconfig.Config, logger *logger.Logger, name string) *AMQPPublisher {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Loggers.AMQP.ChannelBufferSize > 0 {
+		bufSize = config.Loggers.AMQP.ChannelBufferSize
+	}
+	w := &AMQPPublisher{GenericWorker: NewGenericWorker(config, logger, name, "amqp", bufSize, pkgconfig.DefaultMonitor)}
+	w.transportReady = make(chan AMQPChannel)
+	w.transportReconnect = make(chan bool)
+	w.stopReconnect = make(chan bool)
+	w.newPublisher = w.defaultNewPublisher
+	w.ReadConfig()
+	return w
+}
+
+func (w *AMQPPublisher) ReadConfig() {
+	if !pkgconfig.IsValidMode(w.GetConfig().Loggers.AMQP.Mode) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid mode text, json or flat-json expected")
+	}
+
+	if !netutils.IsValidTLS(w.GetConfig().Loggers.AMQP.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid tls min version")
+	}
+
+	routingKey, err := dnsutils.NewFieldTemplate(w.GetConfig().Loggers.AMQP.RoutingKey)
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"invalid routing key: ", err)
+	}
+	w.routingKey = routingKey
+
+	if len(w.GetConfig().Loggers.AMQP.TextFormat) > 0 {
+		w.textFormat = strings.Fields(w.GetConfig().Loggers.AMQP.TextFormat)
+	} else {
+		w.textFormat = strings.Fields(w.GetConfig().Global.TextFormat)
+	}
+}
+
+func (w *AMQPPublisher) defaultNewPublisher() (AMQPChannel, error) {
+	cfg := w.GetConfig().Loggers.AMQP
+
+	scheme := "amqp"
+	amqpConfig := amqp.Config{
+		Vhost: cfg.VHost,
+		Dial:  amqp.DefaultDial(time.Duration(cfg.ConnectTimeout) * time.Second),
+	}
+	if cfg.TLSSupport {
+		scheme = "amqps"
+		tlsOptions := netutils.TLSOptions{
+			InsecureSkipVerify: cfg.TLSInsecure,
+			MinVersion:         cfg.TLSMinVersion,
+			CAFile:             cfg.CAFile,
+			CertFile:           cfg.CertFile,
+			KeyFile:            cfg.KeyFile,
+		}
+		tlsConfig, err := netutils.TLSClientConfig(tlsOptions)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ServerName = cfg.RemoteAddress
+		amqpConfig.TLSClientConfig = tlsConfig
+	}
+
+	uri := url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(cfg.Username, cfg.Password),
+		Host:   net.JoinHostPort(cfg.RemoteAddress, strconv.Itoa(cfg.RemotePort)),
+	}
+
+	conn, err := amqp.DialConfig(uri.String(), amqpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if cfg.ExchangeDeclare {
+		if err := channel.ExchangeDeclare(cfg.Exchange, cfg.ExchangeType, true, false, false, false, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("exchange declare: %w", err)
+		}
+	}
+
+	if cfg.PublisherConfirms {
+		if err := channel.Confirm(false); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("confirm mode: %w", err)
+		}
+	}
+
+	// the channel is closed on connection or channel errors
+	closed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	return &amqpChannelPublisher{conn: conn, channel: channel, closed: closed}, nil
+}
+
+// Reconnect asks the connection goroutine to open a new channel, the
+// request is ignored if a reconnection is already in progress
+func (w *AMQPPublisher) Reconnect() {
+	select {
+	case w.transportReconnect <- true:
+	default:
+	}
+}
+
+func (w *AMQPPublisher) Disconnect() {
+	if w.publisher != nil {
+		w.LogInfo("closing amqp connection")
+		w.publisher.Close()
+	}
+}
+
+// AMQPNextBackoff doubles the retry interval until the max interval
+func AMQPNextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		return max
+	}
+	return next
+}
+
+func (w *AMQPPublisher) ConnectToRemote() {
+	retryInterval := time.Duration(w.GetConfig().Loggers.AMQP.RetryInterval) * time.Second
+	retryMaxInterval := time.Duration(w.GetConfig().Loggers.AMQP.RetryMaxInterval) * time.Second
+	backoff := retryInterval
+
+	var publisher AMQPChannel
+	for {
+		if publisher != nil {
+			publisher.Close()
+			publisher = nil
+		}
+
+		address := net.JoinHostPort(w.GetConfig().Loggers.AMQP.RemoteAddress, strconv.Itoa(w.GetConfig().Loggers.AMQP.RemotePort))
+		w.LogInfo("connecting to amqp broker %s", address)
+
+		var err error
+		publisher, err = w.newPublisher()
+		if err != nil {
+			w.LogError("%s", err)
+			w.LogInfo("retry to connect in %s", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-w.stopReconnect:
+				return
+			}
+			backoff = AMQPNextBackoff(backoff, retryMaxInterval)
+			continue
+		}
+		backoff = retryInterval
+
+		// hand over the channel to the logger
+		select {
+		case w.transportReady <- publisher:
+		case <-w.stopReconnect:
+			publisher.Close()
+			return
+		}
+
+		// block until the channel is closed by the broker or a publish error occurred
+		select {
+		case amqpErr := <-publisher.NotifyClose():
+			if amqpErr != nil {
+				w.LogError("amqp channel closed: %s", amqpErr)
+			}
+		case <-w.transportReconnect:
+		case <-w.stopReconnect:
+			return
+		}
+	}
+}
+
+func (w *AMQPPublisher) encode(dm *dnsutils.DNSMessage, buffer *bytes.Buffer) (string, []byte, error) {
+	buffer.Reset()
+	switch w.GetConfig().Loggers.AMQP.Mode {
+	case pkgconfig.ModeText:
+		err := dm.ToTextLine(
+			w.textFormat,
+			w.GetConfig().Global.TextFormatDelimiter,
+			w.GetConfig().Global.TextFormatBoundary,
+			buffer,
+		)
+		return "text/plain", buffer.Bytes(), err
+	case pkgconfig.ModeJSON:
+		err := json.NewEncoder(buffer).Encode(dm)
+		return "application/json", buffer.Bytes(), err
+	case pkgconfig.ModeFlatJSON:
+		flat, err := dm.Flatten()
+		if err != nil {
+			return "", nil, err
+		}
+		err = json.NewEncoder(buffer).Encode(flat)
+		return "application/json", buffer.Bytes(), err
+	}
+	return "", nil, errors.New("unsupported mode")
+}
+
+func (w *AMQPPublisher) FlushBuffer(buf *[]dnsutils.DNSMessage) {
+	buffer := new(bytes.Buffer)
+
+	deliveryMode := amqp.Transient
+	if w.GetConfig().Loggers.AMQP.Persistent {
+		deliveryMode = amqp.Persistent
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.GetConfig().Loggers.AMQP.ConfirmTimeout)*time.Second)
+	defer cancel()
+
+	confirms := []AMQPConfirmation{}
+	for i, dm := range *buf {
+		contentType, payload, err := w.encode(&dm, buffer)
+		if err != nil {
+			w.CountEgressDiscarded()
+			w.LogError("could not encode dns message: %s", err)
+			continue
+		}
+
+		// the body is copied, the buffer is reused for the next message
+		body := make([]byte, len(payload))
+		copy(body, payload)
+
+		confirm, err := w.publisher.Publish(ctx,
+			w.GetConfig().Loggers.AMQP.Exchange,
+			w.routingKey.Execute(&dm),
+			amqp.Publishing{
+				ContentType:  contentType,
+				DeliveryMode: deliveryMode,
+				Timestamp:    time.Now(),
+				Body:         body,
+			},
+		)
+		if err != nil {
+			w.LogError("publish error: %s", err)
+			for range (*buf)[i:] {
+				w.CountEgressDiscarded()
+			}
+			w.writerReady = false
+			break
+		}
+		if confirm != nil {
+			confirms = append(confirms, confirm)
+		}
+	}
+
+	// wait for publisher confirms
+	for _, confirm := range confirms {
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil {
+			w.LogError("publisher confirm error: %s", err)
+			w.CountEgressDiscarded()
+			continue
+		}
+		if !acked {
+			w.LogError("message not acknowledged by the broker")
+			w.CountEgressDiscarded()
+		}
+	}
+
+	// reset buffer
+	*buf = nil
+}
+
+func (w *AMQPPublisher) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	// prepare next channels
+	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
+	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+
+	// prepare transforms
+	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
+
+	// goroutine to process transformed dns messages
+	go w.StartLogging()
+
+	// loop to process incoming messages
+	for {
+		select {
+		case <-w.OnStop():
+			w.StopLogger()
+			subprocessors.Reset()
+			close(w.stopReconnect)
+			return
+
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.ReadConfig()
+			subprocessors.ReloadConfig(&cfg.OutgoingTransformers)
+
+		case dm, opened := <-w.GetInputChannel():
+			if !opened {
+				w.LogInfo("input channel closed!")
+				return
+			}
+			// count global messages
+			w.CountIngressTraffic()
+
+			// apply transforms, init dns message with additional parts if necessary
+			transformResult, err := subprocessors.ProcessMessage(&dm)
+			if err != nil {
+				w.LogError(err.Error())
+			}
+			if transformResult == transformers.ReturnDrop {
+				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				continue
+			}
+
+			// send to output channel
+			w.CountEgressTraffic()
+			w.GetOutputChannel() <- dm
+
+			// send to next ?
+			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+		}
+	}
+}
+
+func (w *AMQPPublisher) StartLogging() {
+	w.LogInfo("logging has started")
+	defer w.LoggingDone()
+
+	// init buffer
+	bufferDm := []dnsutils.DNSMessage{}
+
+	// init flush timer for buffer
+	flushInterval := time.Duration(w.GetConfig().Loggers.AMQP.FlushInterval) * time.Second
+	flushTimer := time.NewTimer(flushInterval)
+
+	// init remote conn
+	go w.ConnectToRemote()
+
+	w.LogInfo("ready to process")
+	for {
+		select {
+		case <-w.OnLoggerStopped():
+			// closing remote connection if exist
+			w.Disconnect()
+			return
+
+		case publisher := <-w.transportReady:
+			w.LogInfo("amqp channel ready")
+			w.publisher = publisher
+			w.writerReady = true
+
+		// incoming dns message to process
+		case dm, opened := <-w.GetOutputChannel():
+			if !opened {
+				w.LogInfo("output channel closed!")
+				return
+			}
+
+			// drop dns message if the connection is not ready to avoid memory leak or
+			// to block the channel
+			if !w.writerReady {
+				w.CountEgressDiscarded()
+				continue
+			}
+
+			// append dns message to buffer
+			bufferDm = append(bufferDm, dm)
+
+			// buffer is full ?
+			if len(bufferDm) >= w.GetConfig().Loggers.AMQP.BufferSize {
+				w.FlushBuffer(&bufferDm)
+				if !w.writerReady {
+					w.Reconnect()
+				}
+			}
+
+		// flush the buffer
+		case <-flushTimer.C:
+			if !w.writerReady && len(bufferDm) > 0 {
+				for range bufferDm {
+					w.CountEgressDiscarded()
+				}
+				bufferDm = nil
+			}
+
+			if len(bufferDm) > 0 {
+				w.FlushBuffer(&bufferDm)
+				if !w.writerReady {
+					w.Reconnect()
+				}
+			}
+
+			// restart timer
+			flushTimer.Reset(flushInterval)
+		}
+	}
+}
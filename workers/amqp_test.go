@@ -0,0 +1,131 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type mockAMQPConfirmation struct {
+	acked bool
+}
+
+func (c *mockAMQPConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	return c.acked, nil
+}
+
+type amqpPublishedMessage struct {
+	exchange, routingKey string
+	msg                  amqp.Publishing
+}
+
+type mockAMQPChannel struct {
+	sync.Mutex
+	acked     bool
+	published []amqpPublishedMessage
+	closed    chan *amqp.Error
+}
+
+func (m *mockAMQPChannel) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (AMQPConfirmation, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.published = append(m.published, amqpPublishedMessage{exchange: exchange, routingKey: routingKey, msg: msg})
+	return &mockAMQPConfirmation{acked: m.acked}, nil
+}
+
+func (m *mockAMQPChannel) NotifyClose() <-chan *amqp.Error { return m.closed }
+
+func (m *mockAMQPChannel) Close() error { return nil }
+
+func (m *mockAMQPChannel) messages() []amqpPublishedMessage {
+	m.Lock()
+	defer m.Unlock()
+	return append([]amqpPublishedMessage{}, m.published...)
+}
+
+func createMockAMQPPublisher(cfg *pkgconfig.Config, acked bool) (*AMQPPublisher, *mockAMQPChannel) {
+	w := NewAMQPPublisher(cfg, logger.New(false), "test")
+	mockChannel := &mockAMQPChannel{acked: acked, closed: make(chan *amqp.Error)}
+	w.newPublisher = func() (AMQPChannel, error) {
+		return mockChannel, nil
+	}
+	return w, mockChannel
+}
+
+func Test_AMQPPublisher(t *testing.T) {
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.AMQP.BufferSize = 1
+
+	w, mockChannel := createMockAMQPPublisher(cfg, true)
+	go w.StartCollect()
+
+	// wait the channel to be ready
+	time.Sleep(200 * time.Millisecond)
+
+	w.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+	time.Sleep(200 * time.Millisecond)
+	w.Stop()
+
+	published := mockChannel.messages()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 published message, got %d", len(published))
+	}
+
+	msg := published[0]
+	if msg.exchange != "dnscollector" {
+		t.Errorf("invalid exchange: %s", msg.exchange)
+	}
+	if msg.routingKey != "dns.collector.NOERROR" {
+		t.Errorf("invalid routing key: %s", msg.routingKey)
+	}
+	if msg.msg.DeliveryMode != amqp.Persistent {
+		t.Errorf("expected persistent delivery mode, got %d", msg.msg.DeliveryMode)
+	}
+	if msg.msg.ContentType != "application/json" {
+		t.Errorf("invalid content type: %s", msg.msg.ContentType)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(msg.msg.Body, &body); err != nil {
+		t.Fatalf("invalid flat json body: %s", err)
+	}
+	if body["dns.qname"] != pkgconfig.ProgQname {
+		t.Errorf("invalid qname in body: %v", body["dns.qname"])
+	}
+}
+
+func Test_AMQPPublisher_Nack(t *testing.T) {
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.AMQP.BufferSize = 1
+
+	w, mockChannel := createMockAMQPPublisher(cfg, false)
+	go w.StartCollect()
+	time.Sleep(200 * time.Millisecond)
+
+	// messages rejected by the broker are discarded, the logger keeps running
+	for i := 0; i < 2; i++ {
+		w.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+		time.Sleep(200 * time.Millisecond)
+	}
+	w.Stop()
+
+	if n := len(mockChannel.messages()); n != 2 {
+		t.Fatalf("expected 2 published messages, got %d", n)
+	}
+}
+
+func Test_AMQPNextBackoff(t *testing.T) {
+	if got := AMQPNextBackoff(time.Second, time.Minute); got != 2*time.Second {
+		t.Errorf("expected 2s, got %s", got)
+	}
+	if got := AMQPNextBackoff(40*time.Second, time.Minute); got != time.Minute {
+		t.Errorf("expected backoff capped to 1m, got %s", got)
+	}
+}
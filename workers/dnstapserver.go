@@ -339,221 +339,250 @@ func (w *DNSTapProcessor) StartCollect() {
 			// count global messages
 			w.CountIngressTraffic()
 
-			err := proto.Unmarshal(data, dt)
+			dm, err := DecodeDnstap(w.GenericWorker, data, dt, edt, DnstapDecoderOptions{
+				PeerName:         w.PeerName,
+				ExtendedSupport:  w.GetConfig().Collectors.Dnstap.ExtendedSupport,
+				DisableDNSParser: w.GetConfig().Collectors.Dnstap.DisableDNSParser,
+			})
 			if err != nil {
 				continue
 			}
 
-			// init dns message
-			dm := dnsutils.DNSMessage{}
-			dm.Init()
-
-			dm.DNSTap.PeerName = w.PeerName
+			// count output packets
+			w.CountEgressTraffic()
 
-			// init dns message with additional parts
-			identity := dt.GetIdentity()
-			if len(identity) > 0 {
-				dm.DNSTap.Identity = string(identity)
+			// apply all enabled transformers
+			transformResult, err := transforms.ProcessMessage(&dm)
+			if err != nil {
+				w.LogError(err.Error())
 			}
-			version := dt.GetVersion()
-			if len(version) > 0 {
-				dm.DNSTap.Version = string(version)
+			if transformResult == transformers.ReturnDrop {
+				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				continue
 			}
-			dm.DNSTap.Operation = dt.GetMessage().GetType().String()
 
-			// extended extra field ?
-			if w.GetConfig().Collectors.Dnstap.ExtendedSupport {
-				err := proto.Unmarshal(dt.GetExtra(), edt)
-				if err != nil {
-					continue
-				}
+			// dispatch dns message to connected routes
+			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+		}
+	}
+}
 
-				// get original extra value
-				originalExtra := string(edt.GetOriginalDnstapExtra())
-				if len(originalExtra) > 0 {
-					dm.DNSTap.Extra = originalExtra
-				}
+// DnstapDecoderOptions controls the decoding of dnstap frames
+type DnstapDecoderOptions struct {
+	PeerName         string
+	ExtendedSupport  bool
+	DisableDNSParser bool
+}
 
-				// get atags
-				atags := edt.GetAtags()
-				if atags != nil {
-					dm.ATags = &dnsutils.TransformATags{
-						Tags: atags.GetTags(),
-					}
-				}
+// DecodeDnstap converts a dnstap protobuf frame to a dns message, the worker is used
+// to read the global config and to log malformed packets
+func DecodeDnstap(w *GenericWorker, data []byte, dt *dnstap.Dnstap, edt *dnsutils.ExtendedDnstap, opts DnstapDecoderOptions) (dnsutils.DNSMessage, error) {
+	// init dns message
+	dm := dnsutils.DNSMessage{}
+	dm.Init()
 
-				// get public suffix
-				norm := edt.GetNormalize()
-				if norm != nil {
-					dm.PublicSuffix = &dnsutils.TransformPublicSuffix{}
-					if len(norm.GetTld()) > 0 {
-						dm.PublicSuffix.QnamePublicSuffix = norm.GetTld()
-					}
-					if len(norm.GetEtldPlusOne()) > 0 {
-						dm.PublicSuffix.QnameEffectiveTLDPlusOne = norm.GetEtldPlusOne()
-					}
-				}
+	err := proto.Unmarshal(data, dt)
+	if err != nil {
+		return dm, err
+	}
 
-				// filtering
-				sampleRate := edt.GetFiltering()
-				if sampleRate != nil {
-					dm.Filtering = &dnsutils.TransformFiltering{}
-					dm.Filtering.SampleRate = int(sampleRate.SampleRate)
-				}
-			} else {
-				extra := string(dt.GetExtra())
-				if len(extra) > 0 {
-					dm.DNSTap.Extra = extra
-				}
-			}
+	dm.DNSTap.PeerName = opts.PeerName
 
-			if ipVersion, valid := netutils.IPVersion[dt.GetMessage().GetSocketFamily().String()]; valid {
-				dm.NetworkInfo.Family = ipVersion
-			} else {
-				dm.NetworkInfo.Family = pkgconfig.StrUnknown
-			}
+	// init dns message with additional parts
+	identity := dt.GetIdentity()
+	if len(identity) > 0 {
+		dm.DNSTap.Identity = string(identity)
+	}
+	version := dt.GetVersion()
+	if len(version) > 0 {
+		dm.DNSTap.Version = string(version)
+	}
+	dm.DNSTap.Operation = dt.GetMessage().GetType().String()
+
+	// extended extra field ?
+	if opts.ExtendedSupport {
+		err := proto.Unmarshal(dt.GetExtra(), edt)
+		if err != nil {
+			return dm, err
+		}
 
-			dm.NetworkInfo.Protocol = dt.GetMessage().GetSocketProtocol().String()
+		// get original extra value
+		originalExtra := string(edt.GetOriginalDnstapExtra())
+		if len(originalExtra) > 0 {
+			dm.DNSTap.Extra = originalExtra
+		}
 
-			// decode query address and port
-			queryip := dt.GetMessage().GetQueryAddress()
-			if len(queryip) > 0 {
-				dm.NetworkInfo.QueryIP = net.IP(queryip).String()
-			}
-			queryport := dt.GetMessage().GetQueryPort()
-			if queryport > 0 {
-				dm.NetworkInfo.QueryPort = strconv.FormatUint(uint64(queryport), 10)
+		// get atags
+		atags := edt.GetAtags()
+		if atags != nil {
+			dm.ATags = &dnsutils.TransformATags{
+				Tags: atags.GetTags(),
 			}
+		}
 
-			// decode response address and port
-			responseip := dt.GetMessage().GetResponseAddress()
-			if len(responseip) > 0 {
-				dm.NetworkInfo.ResponseIP = net.IP(responseip).String()
+		// get public suffix
+		norm := edt.GetNormalize()
+		if norm != nil {
+			dm.PublicSuffix = &dnsutils.TransformPublicSuffix{}
+			if len(norm.GetTld()) > 0 {
+				dm.PublicSuffix.QnamePublicSuffix = norm.GetTld()
 			}
-			responseport := dt.GetMessage().GetResponsePort()
-			if responseport > 0 {
-				dm.NetworkInfo.ResponsePort = strconv.FormatUint(uint64(responseport), 10)
+			if len(norm.GetEtldPlusOne()) > 0 {
+				dm.PublicSuffix.QnameEffectiveTLDPlusOne = norm.GetEtldPlusOne()
 			}
+		}
 
-			// get dns payload and timestamp according to the type (query or response)
-			op := dnstap.Message_Type_value[dm.DNSTap.Operation]
-			if op%2 == 1 {
-				dnsPayload := dt.GetMessage().GetQueryMessage()
-				dm.DNS.Payload = dnsPayload
-				dm.DNS.Length = len(dnsPayload)
-				dm.DNS.Type = dnsutils.DNSQuery
-				dm.DNSTap.TimeSec = int(dt.GetMessage().GetQueryTimeSec())
-				dm.DNSTap.TimeNsec = int(dt.GetMessage().GetQueryTimeNsec())
-			} else {
-				dnsPayload := dt.GetMessage().GetResponseMessage()
-				dm.DNS.Payload = dnsPayload
-				dm.DNS.Length = len(dnsPayload)
-				dm.DNS.Type = dnsutils.DNSReply
-				dm.DNSTap.TimeSec = int(dt.GetMessage().GetResponseTimeSec())
-				dm.DNSTap.TimeNsec = int(dt.GetMessage().GetResponseTimeNsec())
-
-				tsQuery := float64(dt.GetMessage().GetQueryTimeSec()) + float64(dt.GetMessage().GetQueryTimeNsec())/1e9
-				tsReply := float64(dt.GetMessage().GetResponseTimeSec()) + float64(dt.GetMessage().GetResponseTimeNsec())/1e9
-
-				// compute latency
-				if tsQuery != 0 && tsReply >= tsQuery {
-					dm.DNSTap.Latency = tsReply - tsQuery
-					dm.DNSTap.LatencyMs = int((tsReply - tsQuery) * 1000)
-				}
+		// filtering
+		sampleRate := edt.GetFiltering()
+		if sampleRate != nil {
+			dm.Filtering = &dnsutils.TransformFiltering{}
+			dm.Filtering.SampleRate = int(sampleRate.GetSampleRate())
+			// the fraction is missing in the messages of the previous versions
+			switch {
+			case sampleRate.GetSampleFraction() > 0:
+				dm.Filtering.SampleFraction = sampleRate.GetSampleFraction()
+			case sampleRate.GetSampleRate() > 0:
+				dm.Filtering.SampleFraction = 1 / float64(sampleRate.GetSampleRate())
 			}
+		}
+	} else {
+		extra := string(dt.GetExtra())
+		if len(extra) > 0 {
+			dm.DNSTap.Extra = extra
+		}
+	}
 
-			// policy
-			policyType := dt.GetMessage().GetPolicy().GetType()
-			if len(policyType) > 0 {
-				dm.DNSTap.PolicyType = policyType
-			}
+	if ipVersion, valid := netutils.IPVersion[dt.GetMessage().GetSocketFamily().String()]; valid {
+		dm.NetworkInfo.Family = ipVersion
+	} else {
+		dm.NetworkInfo.Family = pkgconfig.StrUnknown
+	}
 
-			policyRule := string(dt.GetMessage().GetPolicy().GetRule())
-			if len(policyRule) > 0 {
-				dm.DNSTap.PolicyRule = policyRule
-			}
+	dm.NetworkInfo.Protocol = dt.GetMessage().GetSocketProtocol().String()
 
-			policyAction := dt.GetMessage().GetPolicy().GetAction().String()
-			if len(policyAction) > 0 {
-				dm.DNSTap.PolicyAction = policyAction
-			}
+	// decode query address and port
+	queryip := dt.GetMessage().GetQueryAddress()
+	if len(queryip) > 0 {
+		dm.NetworkInfo.QueryIP = net.IP(queryip).String()
+	}
+	queryport := dt.GetMessage().GetQueryPort()
+	if queryport > 0 {
+		dm.NetworkInfo.QueryPort = strconv.FormatUint(uint64(queryport), 10)
+	}
 
-			policyMatch := dt.GetMessage().GetPolicy().GetMatch().String()
-			if len(policyMatch) > 0 {
-				dm.DNSTap.PolicyMatch = policyMatch
-			}
+	// decode response address and port
+	responseip := dt.GetMessage().GetResponseAddress()
+	if len(responseip) > 0 {
+		dm.NetworkInfo.ResponseIP = net.IP(responseip).String()
+	}
+	responseport := dt.GetMessage().GetResponsePort()
+	if responseport > 0 {
+		dm.NetworkInfo.ResponsePort = strconv.FormatUint(uint64(responseport), 10)
+	}
 
-			policyValue := string(dt.GetMessage().GetPolicy().GetValue())
-			if len(policyValue) > 0 {
-				dm.DNSTap.PolicyValue = policyValue
-			}
+	// get dns payload and timestamp according to the type (query or response)
+	op := dnstap.Message_Type_value[dm.DNSTap.Operation]
+	if op%2 == 1 {
+		dnsPayload := dt.GetMessage().GetQueryMessage()
+		dm.DNS.Payload = dnsPayload
+		dm.DNS.Length = len(dnsPayload)
+		dm.DNS.Type = dnsutils.DNSQuery
+		dm.DNSTap.TimeSec = int(dt.GetMessage().GetQueryTimeSec())
+		dm.DNSTap.TimeNsec = int(dt.GetMessage().GetQueryTimeNsec())
+	} else {
+		dnsPayload := dt.GetMessage().GetResponseMessage()
+		dm.DNS.Payload = dnsPayload
+		dm.DNS.Length = len(dnsPayload)
+		dm.DNS.Type = dnsutils.DNSReply
+		dm.DNSTap.TimeSec = int(dt.GetMessage().GetResponseTimeSec())
+		dm.DNSTap.TimeNsec = int(dt.GetMessage().GetResponseTimeNsec())
+
+		tsQuery := float64(dt.GetMessage().GetQueryTimeSec()) + float64(dt.GetMessage().GetQueryTimeNsec())/1e9
+		tsReply := float64(dt.GetMessage().GetResponseTimeSec()) + float64(dt.GetMessage().GetResponseTimeNsec())/1e9
+
+		// compute latency
+		if tsQuery != 0 && tsReply >= tsQuery {
+			dm.DNSTap.Latency = tsReply - tsQuery
+			dm.DNSTap.LatencyMs = int((tsReply - tsQuery) * 1000)
+		}
+	}
 
-			// get http protocol
-			httpProtocol := dt.GetMessage().GetHttpProtocol().String()
-			if len(httpProtocol) > 0 {
-				dm.DNSTap.HttpProtocol = httpProtocol
-			}
+	// policy
+	policyType := dt.GetMessage().GetPolicy().GetType()
+	if len(policyType) > 0 {
+		dm.DNSTap.PolicyType = policyType
+	}
 
-			// decode query zone if provided
-			queryZone := dt.GetMessage().GetQueryZone()
-			if len(queryZone) > 0 {
-				qz, _, err := dnsutils.ParseLabels(0, queryZone)
-				if err != nil {
-					w.LogError("invalid query zone: %v - %v", err, queryZone)
-				}
-				dm.DNSTap.QueryZone = qz
-			}
+	policyRule := string(dt.GetMessage().GetPolicy().GetRule())
+	if len(policyRule) > 0 {
+		dm.DNSTap.PolicyRule = policyRule
+	}
 
-			// compute timestamp
-			ts := time.Unix(int64(dm.DNSTap.TimeSec), int64(dm.DNSTap.TimeNsec))
-			dm.DNSTap.Timestamp = ts.UnixNano()
-			dm.DNSTap.TimestampRFC3339 = ts.UTC().Format(time.RFC3339Nano)
+	policyAction := dt.GetMessage().GetPolicy().GetAction().String()
+	if len(policyAction) > 0 {
+		dm.DNSTap.PolicyAction = policyAction
+	}
 
-			// decode payload if provided
-			if !w.GetConfig().Collectors.Dnstap.DisableDNSParser && len(dm.DNS.Payload) > 0 {
-				// decode the dns payload to get id, rcode and the number of question
-				// number of answer, ignore invalid packet
-				dnsHeader, err := dnsutils.DecodeDNS(dm.DNS.Payload)
-				if err != nil {
-					dm.DNS.MalformedPacket = true
-					if w.GetConfig().Global.Trace.LogMalformed {
-						w.LogWarning("dns header parser stopped: %s", err)
-						w.LogWarning("dump dns packet: %v", dm)
-						w.LogWarning("dump dns payload: %v", dm.DNS.Payload)
-					}
-				}
+	policyMatch := dt.GetMessage().GetPolicy().GetMatch().String()
+	if len(policyMatch) > 0 {
+		dm.DNSTap.PolicyMatch = policyMatch
+	}
 
-				// get number of questions
-				dm.DNS.QdCount = dnsHeader.Qdcount
-				dm.DNS.AnCount = dnsHeader.Ancount
-				dm.DNS.ArCount = dnsHeader.Arcount
-				dm.DNS.NsCount = dnsHeader.Nscount
-
-				if err = dnsutils.DecodePayload(&dm, &dnsHeader, w.GetConfig()); err != nil {
-					dm.DNS.MalformedPacket = true
-					if w.GetConfig().Global.Trace.LogMalformed {
-						w.LogWarning("dns payload parser stopped: %s", err)
-						w.LogWarning("dump dns packet: %v", dm)
-						w.LogWarning("dump dns payload: %v", dm.DNS.Payload)
-					}
-				}
-			}
+	policyValue := string(dt.GetMessage().GetPolicy().GetValue())
+	if len(policyValue) > 0 {
+		dm.DNSTap.PolicyValue = policyValue
+	}
 
-			// count output packets
-			w.CountEgressTraffic()
+	// get http protocol
+	httpProtocol := dt.GetMessage().GetHttpProtocol().String()
+	if len(httpProtocol) > 0 {
+		dm.DNSTap.HttpProtocol = httpProtocol
+	}
 
-			// apply all enabled transformers
-			transformResult, err := transforms.ProcessMessage(&dm)
-			if err != nil {
-				w.LogError(err.Error())
-			}
-			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
-				continue
+	// decode query zone if provided
+	queryZone := dt.GetMessage().GetQueryZone()
+	if len(queryZone) > 0 {
+		qz, _, err := dnsutils.ParseLabels(0, queryZone)
+		if err != nil {
+			w.LogError("invalid query zone: %v - %v", err, queryZone)
+		}
+		dm.DNSTap.QueryZone = qz
+	}
+
+	// compute timestamp
+	ts := time.Unix(int64(dm.DNSTap.TimeSec), int64(dm.DNSTap.TimeNsec))
+	dm.DNSTap.Timestamp = ts.UnixNano()
+	dm.DNSTap.TimestampRFC3339 = ts.UTC().Format(time.RFC3339Nano)
+
+	// decode payload if provided
+	if !opts.DisableDNSParser && len(dm.DNS.Payload) > 0 {
+		// decode the dns payload to get id, rcode and the number of question
+		// number of answer, ignore invalid packet
+		dnsHeader, err := dnsutils.DecodeDNS(dm.DNS.Payload)
+		if err != nil {
+			dm.DNS.MalformedPacket = true
+			if w.GetConfig().Global.Trace.LogMalformed {
+				w.LogWarning("dns header parser stopped: %s", err)
+				w.LogWarning("dump dns packet: %v", dm)
+				w.LogWarning("dump dns payload: %v", dm.DNS.Payload)
 			}
+		}
 
-			// dispatch dns message to connected routes
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+		// get number of questions
+		dm.DNS.QdCount = dnsHeader.Qdcount
+		dm.DNS.AnCount = dnsHeader.Ancount
+		dm.DNS.ArCount = dnsHeader.Arcount
+		dm.DNS.NsCount = dnsHeader.Nscount
+
+		if err = dnsutils.DecodePayload(&dm, &dnsHeader, w.GetConfig()); err != nil {
+			dm.DNS.MalformedPacket = true
+			if w.GetConfig().Global.Trace.LogMalformed {
+				w.LogWarning("dns payload parser stopped: %s", err)
+				w.LogWarning("dump dns packet: %v", dm)
+				w.LogWarning("dump dns payload: %v", dm.DNS.Payload)
+			}
 		}
 	}
+
+	return dm, nil
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-dnscollector/telemetry"
+	"github.com/dmachard/go-dnscollector/transformers"
 	"github.com/dmachard/go-dnstap-protobuf"
 	"github.com/dmachard/go-framestream"
 	"github.com/dmachard/go-logger"
@@ -546,6 +547,57 @@ func Test_DnstapProcessor_Extended(t *testing.T) {
 	}
 }
 
+func Test_DnstapProcessor_ExtendedSampleFraction(t *testing.T) {
+	// sample the messages with the hash of the client ip
+	tcfg := pkgconfig.GetFakeConfigTransformers()
+	tcfg.Filtering.Enable = true
+	tcfg.Filtering.SampleFraction = 0.7
+	tcfg.Filtering.SampleFields = []string{"query-ip"}
+	transforms := transformers.NewTransforms(tcfg, logger.New(false), "test", []chan dnsutils.DNSMessage{}, 0)
+
+	var sampled *dnsutils.DNSMessage
+	for i := 0; i < 100 && sampled == nil; i++ {
+		dm := dnsutils.GetFakeDNSMessageWithPayload()
+		dm.NetworkInfo.QueryIP = fmt.Sprintf("10.0.0.%d", i)
+		if result, err := transforms.ProcessMessage(&dm); err != nil {
+			t.Fatal(err)
+		} else if result == transformers.ReturnKeep {
+			sampled = &dm
+		}
+	}
+	if sampled == nil {
+		t.Fatal("no message sampled")
+	}
+
+	// encode to extended dnstap
+	data, err := sampled.ToDNSTap(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// decode with the dnstap consumer
+	fl := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Collectors.Dnstap.ExtendedSupport = true
+
+	consumer := NewDNSTapProcessor(0, "peertest", cfg, logger.New(false), "test", 512)
+	consumer.AddDefaultRoute(fl)
+	consumer.AddDroppedRoute(fl)
+	go consumer.StartCollect()
+
+	consumer.GetDataChannel() <- data
+	dm := <-fl.GetInputChannel()
+	if dm.Filtering == nil {
+		t.Fatal("filtering expected")
+	}
+	if dm.Filtering.SampleFraction != 0.7 {
+		t.Errorf("invalid sample fraction: %v", dm.Filtering.SampleFraction)
+	}
+	if dm.Filtering.SampleRate != 1 {
+		t.Errorf("invalid sample rate: %d", dm.Filtering.SampleRate)
+	}
+}
+
 // test for issue https://github.com/dmachard/go-dnscollector/issues/568
 func Test_DnstapProcessor_BufferLoggerIsFull(t *testing.T) {
 	// run the consumer with a fake logger
@@ -0,0 +1,449 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+)
+
+const (
+	gelfVersion      = "1.1"
+	gelfLevelInfo    = 6
+	gelfChunkHeader  = 12
+	gelfMaxChunks    = 128
+	gelfMinChunkSize = gelfChunkHeader + 1
+	gelfReservedID   = "_id"
+)
+
+var (
+	gelfChunkMagic       = []byte{0x1e, 0x0f}
+	ErrGELFTooManyChunks = errors.New("gelf message too large, more than 128 chunks needed")
+)
+
+type GELFClient struct {
+	*GenericWorker
+	textFormat                         []string
+	transport, hostname                string
+	transportWriter                    *bufio.Writer
+	transportConn                      net.Conn
+	transportReady, transportReconnect chan bool
+	writerReady                        bool
+}
+
+func NewGELFClient(config *pkgconfig.Config, logger *logger.Logger, name string) *GELFClient {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Loggers.GELF.ChannelBufferSize > 0 {
+		bufSize = config.Loggers.GELF.ChannelBufferSize
+	}
+	w := &GELFClient{GenericWorker: NewGenericWorker(config, logger, name, "gelf", bufSize, pkgconfig.DefaultMonitor)}
+	w.transportReady = make(chan bool)
+	w.transportReconnect = make(chan bool)
+	w.ReadConfig()
+	return w
+}
+
+func (w *GELFClient) ReadConfig() {
+	w.transport = w.GetConfig().Loggers.GELF.Transport
+	switch w.transport {
+	case netutils.SocketUDP, netutils.SocketTCP, netutils.SocketTLS:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid transport, udp, tcp or tcp+tls expected")
+	}
+
+	switch w.GetConfig().Loggers.GELF.Compression {
+	case pkgconfig.CompressGzip, pkgconfig.CompressZlib, pkgconfig.CompressNone:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid compression, gzip, zlib or none expected")
+	}
+
+	if w.GetConfig().Loggers.GELF.ChunkSize < gelfMinChunkSize {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid chunk size, too small")
+	}
+
+	if !netutils.IsValidTLS(w.GetConfig().Loggers.GELF.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid tls min version")
+	}
+
+	w.hostname = w.GetConfig().Loggers.GELF.Hostname
+	if len(w.hostname) == 0 {
+		w.hostname = w.GetConfig().GetServerIdentity()
+	}
+
+	if len(w.GetConfig().Loggers.GELF.TextFormat) > 0 {
+		w.textFormat = strings.Fields(w.GetConfig().Loggers.GELF.TextFormat)
+	} else {
+		w.textFormat = strings.Fields(w.GetConfig().Global.TextFormat)
+	}
+}
+
+func (w *GELFClient) Disconnect() {
+	if w.transportConn != nil {
+		w.LogInfo("closing gelf connection")
+		w.transportConn.Close()
+	}
+}
+
+func (w *GELFClient) ConnectToRemote() {
+	for {
+		if w.transportConn != nil {
+			w.transportConn.Close()
+			w.transportConn = nil
+		}
+
+		address := net.JoinHostPort(w.GetConfig().Loggers.GELF.RemoteAddress, strconv.Itoa(w.GetConfig().Loggers.GELF.RemotePort))
+		connTimeout := time.Duration(w.GetConfig().Loggers.GELF.ConnectTimeout) * time.Second
+
+		// make the connection
+		var conn net.Conn
+		var err error
+
+		switch w.transport {
+		case netutils.SocketUDP, netutils.SocketTCP:
+			w.LogInfo("connecting to %s://%s", w.transport, address)
+			conn, err = net.DialTimeout(w.transport, address, connTimeout)
+
+		case netutils.SocketTLS:
+			w.LogInfo("connecting to %s://%s", w.transport, address)
+
+			var tlsConfig *tls.Config
+
+			tlsOptions := netutils.TLSOptions{
+				InsecureSkipVerify: w.GetConfig().Loggers.GELF.TLSInsecure,
+				MinVersion:         w.GetConfig().Loggers.GELF.TLSMinVersion,
+				CAFile:             w.GetConfig().Loggers.GELF.CAFile,
+				CertFile:           w.GetConfig().Loggers.GELF.CertFile,
+				KeyFile:            w.GetConfig().Loggers.GELF.KeyFile,
+			}
+
+			tlsConfig, err = netutils.TLSClientConfig(tlsOptions)
+			if err == nil {
+				dialer := &net.Dialer{Timeout: connTimeout}
+				conn, err = tls.DialWithDialer(dialer, netutils.SocketTCP, address, tlsConfig)
+			}
+		}
+
+		// something is wrong during connection ?
+		if err != nil {
+			w.LogError("%s", err)
+			w.LogInfo("retry to connect in %d seconds", w.GetConfig().Loggers.GELF.RetryInterval)
+			time.Sleep(time.Duration(w.GetConfig().Loggers.GELF.RetryInterval) * time.Second)
+			continue
+		}
+
+		w.transportConn = conn
+
+		// block until the transport is ready
+		w.transportReady <- true
+
+		// block until an error occurred, need to reconnect
+		w.transportReconnect <- true
+	}
+}
+
+// GELFFieldName converts a flattened key to a GELF additional field name
+// dns.qname => _dns_qname
+func GELFFieldName(key string) string {
+	var b strings.Builder
+	b.Grow(len(key) + 1)
+	b.WriteByte('_')
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// EncodeGELF returns the GELF 1.1 json payload of the dns message
+func (w *GELFClient) EncodeGELF(dm *dnsutils.DNSMessage) ([]byte, error) {
+	flat, err := dm.Flatten()
+	if err != nil {
+		return nil, err
+	}
+
+	textBuf := w.GetTextBuffer()
+	defer w.PutTextBuffer(textBuf)
+	if err := dm.ToTextLine(w.textFormat, w.GetConfig().Global.TextFormatDelimiter, w.GetConfig().Global.TextFormatBoundary, textBuf); err != nil {
+		return nil, err
+	}
+
+	msg := make(map[string]interface{}, len(flat)+5)
+	for k, v := range flat {
+		name := GELFFieldName(k)
+		if name == gelfReservedID {
+			continue
+		}
+		msg[name] = v
+	}
+	msg["version"] = gelfVersion
+	msg["host"] = w.hostname
+	msg["short_message"] = textBuf.String()
+	msg["level"] = gelfLevelInfo
+	if dm.DNSTap.Timestamp > 0 {
+		msg["timestamp"] = float64(dm.DNSTap.Timestamp) / 1e9
+	} else {
+		msg["timestamp"] = float64(time.Now().UnixNano()) / 1e9
+	}
+
+	return json.Marshal(msg)
+}
+
+func (w *GELFClient) compress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch w.GetConfig().Loggers.GELF.Compression {
+	case pkgconfig.CompressGzip:
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	case pkgconfig.CompressZlib:
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return payload, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// GELFChunks splits the payload into GELF UDP chunks
+// magic bytes (2) + message id (8) + sequence number (1) + sequence count (1) + data
+func GELFChunks(payload []byte, chunkSize int) ([][]byte, error) {
+	if len(payload) <= chunkSize {
+		return [][]byte{payload}, nil
+	}
+
+	dataSize := chunkSize - gelfChunkHeader
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, ErrGELFTooManyChunks
+	}
+
+	msgID := make([]byte, 8)
+	if _, err := rand.Read(msgID); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * dataSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk := make([]byte, 0, gelfChunkHeader+end-i*dataSize)
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, msgID...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload[i*dataSize:end]...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+func (w *GELFClient) sendUDP(payload []byte) error {
+	data, err := w.compress(payload)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := GELFChunks(data, w.GetConfig().Loggers.GELF.ChunkSize)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, err := w.transportConn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *GELFClient) FlushBuffer(buf *[]dnsutils.DNSMessage) {
+	for _, dm := range *buf {
+		payload, err := w.EncodeGELF(&dm)
+		if err != nil {
+			w.CountEgressDiscarded()
+			w.LogError("could not encode to gelf format: %s", err)
+			continue
+		}
+
+		// udp: compressed and chunked datagrams
+		if w.transport == netutils.SocketUDP {
+			if err := w.sendUDP(payload); err != nil {
+				if errors.Is(err, ErrGELFTooManyChunks) {
+					w.CountEgressDiscarded()
+					w.LogError("%s", err)
+					continue
+				}
+				w.LogError("send error: %s", err)
+				w.writerReady = false
+				<-w.transportReconnect
+				break
+			}
+			continue
+		}
+
+		// tcp: uncompressed and null byte delimited frames
+		w.transportWriter.Write(payload)
+		w.transportWriter.WriteByte(0)
+
+		// flush the transport buffer
+		if err := w.transportWriter.Flush(); err != nil {
+			w.LogError("send frame error: %s", err)
+			w.writerReady = false
+			<-w.transportReconnect
+			break
+		}
+	}
+
+	// reset buffer
+	*buf = nil
+}
+
+func (w *GELFClient) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	// prepare next channels
+	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
+	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+
+	// prepare transforms
+	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
+
+	// goroutine to process transformed dns messages
+	go w.StartLogging()
+
+	// loop to process incoming messages
+	for {
+		select {
+		case <-w.OnStop():
+			w.StopLogger()
+			subprocessors.Reset()
+			return
+
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.ReadConfig()
+			subprocessors.ReloadConfig(&cfg.OutgoingTransformers)
+
+		case dm, opened := <-w.GetInputChannel():
+			if !opened {
+				w.LogInfo("input channel closed!")
+				return
+			}
+			// count global messages
+			w.CountIngressTraffic()
+
+			// apply transforms, init dns message with additional parts if necessary
+			transformResult, err := subprocessors.ProcessMessage(&dm)
+			if err != nil {
+				w.LogError(err.Error())
+			}
+			if transformResult == transformers.ReturnDrop {
+				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				continue
+			}
+
+			// send to output channel
+			w.CountEgressTraffic()
+			w.GetOutputChannel() <- dm
+
+			// send to next ?
+			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+		}
+	}
+}
+
+func (w *GELFClient) StartLogging() {
+	w.LogInfo("logging has started")
+	defer w.LoggingDone()
+
+	// init buffer
+	bufferDm := []dnsutils.DNSMessage{}
+
+	// init flush timer for buffer
+	flushInterval := time.Duration(w.GetConfig().Loggers.GELF.FlushInterval) * time.Second
+	flushTimer := time.NewTimer(flushInterval)
+
+	// init remote conn
+	go w.ConnectToRemote()
+
+	w.LogInfo("ready to process")
+	for {
+		select {
+		case <-w.OnLoggerStopped():
+			// closing remote connection if exist
+			w.Disconnect()
+			return
+
+		case <-w.transportReady:
+			w.LogInfo("transport connected with success")
+			w.transportWriter = bufio.NewWriter(w.transportConn)
+			w.writerReady = true
+
+		// incoming dns message to process
+		case dm, opened := <-w.GetOutputChannel():
+			if !opened {
+				w.LogInfo("output channel closed!")
+				return
+			}
+
+			// drop dns message if the connection is not ready to avoid memory leak or
+			// to block the channel
+			if !w.writerReady {
+				w.CountEgressDiscarded()
+				continue
+			}
+
+			// append dns message to buffer
+			bufferDm = append(bufferDm, dm)
+
+			// buffer is full ?
+			if len(bufferDm) >= w.GetConfig().Loggers.GELF.BufferSize {
+				w.FlushBuffer(&bufferDm)
+			}
+
+		// flush the buffer
+		case <-flushTimer.C:
+			if !w.writerReady && len(bufferDm) > 0 {
+				for range bufferDm {
+					w.CountEgressDiscarded()
+				}
+				bufferDm = nil
+			}
+
+			if len(bufferDm) > 0 {
+				w.FlushBuffer(&bufferDm)
+			}
+
+			// restart timer
+			flushTimer.Reset(flushInterval)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+)
+
+func Test_GELFFieldName(t *testing.T) {
+	testcases := []struct {
+		key, want string
+	}{
+		{key: "dns.qname", want: "_dns_qname"},
+		{key: "network.query-ip", want: "_network_query-ip"},
+		{key: "publicsuffix.etld+1", want: "_publicsuffix_etld_1"},
+	}
+	for _, tc := range testcases {
+		if got := GELFFieldName(tc.key); got != tc.want {
+			t.Errorf("field name for %s, want %s, got %s", tc.key, tc.want, got)
+		}
+	}
+}
+
+func Test_GELFChunks(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 100)
+
+	// no chunking needed
+	chunks, err := GELFChunks(payload, 1420)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 || !bytes.Equal(chunks[0], payload) {
+		t.Errorf("expected one unchunked datagram")
+	}
+
+	// 100 bytes with 20 bytes of data per chunk
+	chunks, err = GELFChunks(payload, gelfChunkHeader+20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 5 {
+		t.Fatalf("expected 5 chunks, got %d", len(chunks))
+	}
+
+	var reassembled []byte
+	for i, chunk := range chunks {
+		if !bytes.Equal(chunk[:2], gelfChunkMagic) {
+			t.Errorf("invalid magic bytes in chunk %d", i)
+		}
+		if !bytes.Equal(chunk[2:10], chunks[0][2:10]) {
+			t.Errorf("message id differs in chunk %d", i)
+		}
+		if int(chunk[10]) != i || int(chunk[11]) != len(chunks) {
+			t.Errorf("invalid sequence in chunk %d: %d/%d", i, chunk[10], chunk[11])
+		}
+		reassembled = append(reassembled, chunk[gelfChunkHeader:]...)
+	}
+	if !bytes.Equal(reassembled, payload) {
+		t.Errorf("reassembled payload mismatch")
+	}
+
+	// too many chunks
+	if _, err := GELFChunks(bytes.Repeat([]byte("a"), 129), gelfChunkHeader+1); err != ErrGELFTooManyChunks {
+		t.Errorf("expected too many chunks error, got %v", err)
+	}
+}
+
+func Test_GELFClientRunUDP(t *testing.T) {
+	testcases := []struct {
+		compression string
+		decompress  func(r io.Reader) (io.Reader, error)
+	}{
+		{
+			compression: pkgconfig.CompressGzip,
+			decompress:  func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		},
+		{
+			compression: pkgconfig.CompressZlib,
+			decompress:  func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		},
+		{
+			compression: pkgconfig.CompressNone,
+			decompress:  func(r io.Reader) (io.Reader, error) { return r, nil },
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.compression, func(t *testing.T) {
+			// init logger
+			cfg := pkgconfig.GetDefaultConfig()
+			cfg.Loggers.GELF.FlushInterval = 1
+			cfg.Loggers.GELF.BufferSize = 0
+			cfg.Loggers.GELF.Transport = netutils.SocketUDP
+			cfg.Loggers.GELF.RemotePort = 12201
+			cfg.Loggers.GELF.Compression = tc.compression
+			cfg.Loggers.GELF.Hostname = "dnscollector-test"
+
+			g := NewGELFClient(cfg, logger.New(false), "test")
+
+			// fake gelf receiver
+			fakeRcvr, err := net.ListenPacket(netutils.SocketUDP, "127.0.0.1:12201")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fakeRcvr.Close()
+
+			// start the logger
+			go g.StartCollect()
+
+			// send fake dns message to logger
+			time.Sleep(time.Second)
+			dm := dnsutils.GetFakeDNSMessage()
+			g.GetInputChannel() <- dm
+
+			// read data on fake server side and reassemble chunks if any
+			var payload []byte
+			buf := make([]byte, 65536)
+			fakeRcvr.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for {
+				n, _, err := fakeRcvr.ReadFrom(buf)
+				if err != nil {
+					t.Fatalf("error to read data: %s", err)
+				}
+				if !bytes.HasPrefix(buf[:n], gelfChunkMagic) {
+					payload = append(payload, buf[:n]...)
+					break
+				}
+				payload = append(payload, buf[gelfChunkHeader:n]...)
+				if buf[10] == buf[11]-1 {
+					break
+				}
+			}
+
+			r, err := tc.decompress(bytes.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg map[string]interface{}
+			if err := json.NewDecoder(r).Decode(&msg); err != nil {
+				t.Fatalf("invalid gelf payload: %s", err)
+			}
+
+			if msg["version"] != "1.1" || msg["host"] != "dnscollector-test" {
+				t.Errorf("invalid gelf headers: %v", msg)
+			}
+			if msg["_dns_qname"] != pkgconfig.ProgQname {
+				t.Errorf("invalid qname additional field: %v", msg["_dns_qname"])
+			}
+			if _, ok := msg["short_message"]; !ok {
+				t.Errorf("short_message is missing")
+			}
+
+			g.Stop()
+		})
+	}
+}
+
+func Test_GELFClientRunTCP(t *testing.T) {
+	// init logger
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.GELF.FlushInterval = 1
+	cfg.Loggers.GELF.BufferSize = 0
+	cfg.Loggers.GELF.Transport = netutils.SocketTCP
+	cfg.Loggers.GELF.RemotePort = 12202
+
+	g := NewGELFClient(cfg, logger.New(false), "test")
+
+	// fake gelf receiver
+	fakeRcvr, err := net.Listen(netutils.SocketTCP, "127.0.0.1:12202")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeRcvr.Close()
+
+	// start the logger
+	go g.StartCollect()
+
+	// accept conn from logger
+	conn, err := fakeRcvr.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// wait connection on logger
+	time.Sleep(time.Second)
+
+	// send fake dns message to logger
+	dm := dnsutils.GetFakeDNSMessage()
+	g.GetInputChannel() <- dm
+
+	// read null delimited frame
+	reader := bufio.NewReader(conn)
+	frame, err := reader.ReadBytes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(frame[:len(frame)-1], &msg); err != nil {
+		t.Fatalf("invalid gelf payload: %s", err)
+	}
+	if msg["_dns_qname"] != pkgconfig.ProgQname {
+		t.Errorf("invalid qname additional field: %v", msg["_dns_qname"])
+	}
+
+	g.Stop()
+}
@@ -0,0 +1,283 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-dnstap-protobuf"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	KafkaOffsetEarliest = "earliest"
+	KafkaOffsetLatest   = "latest"
+)
+
+// KafkaReader is the subset of the kafka-go reader used by the consumer
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type KafkaConsumer struct {
+	*GenericWorker
+	newReader func() (KafkaReader, error)
+	dt        *dnstap.Dnstap
+	edt       *dnsutils.ExtendedDnstap
+}
+
+func NewKafkaConsumer(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *KafkaConsumer {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Collectors.KafkaConsumer.ChannelBufferSize > 0 {
+		bufSize = config.Collectors.KafkaConsumer.ChannelBufferSize
+	}
+	w := &KafkaConsumer{
+		GenericWorker: NewGenericWorker(config, logger, name, "kafka consumer", bufSize, pkgconfig.DefaultMonitor),
+		dt:            &dnstap.Dnstap{},
+		edt:           &dnsutils.ExtendedDnstap{},
+	}
+	w.newReader = w.defaultNewReader
+	w.SetDefaultRoutes(next)
+	w.ReadConfig()
+	return w
+}
+
+func (w *KafkaConsumer) ReadConfig() {
+	kafkaConfig := w.GetConfig().Collectors.KafkaConsumer
+
+	switch kafkaConfig.Mode {
+	case pkgconfig.ModeJSON, pkgconfig.ModeFlatJSON, pkgconfig.ModeDNSTap:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] kafka consumer - invalid mode: ", kafkaConfig.Mode)
+	}
+
+	switch kafkaConfig.StartOffset {
+	case KafkaOffsetEarliest, KafkaOffsetLatest:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] kafka consumer - invalid start offset: ", kafkaConfig.StartOffset)
+	}
+
+	if len(kafkaConfig.GroupID) == 0 {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] kafka consumer - group id is required")
+	}
+}
+
+func (w *KafkaConsumer) createDialer() (*kafka.Dialer, error) {
+	kafkaConfig := w.GetConfig().Collectors.KafkaConsumer
+	dialer := &kafka.Dialer{
+		Timeout:   time.Duration(kafkaConfig.ConnectTimeout) * time.Second,
+		DualStack: true,
+		ClientID:  kafkaConfig.ClientID,
+	}
+
+	// TLS Support
+	if kafkaConfig.TLSSupport {
+		tlsOptions := netutils.TLSOptions{
+			InsecureSkipVerify: kafkaConfig.TLSInsecure,
+			MinVersion:         kafkaConfig.TLSMinVersion,
+			CAFile:             kafkaConfig.CAFile,
+			CertFile:           kafkaConfig.CertFile,
+			KeyFile:            kafkaConfig.KeyFile,
+		}
+
+		tlsConfig, err := netutils.TLSClientConfig(tlsOptions)
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLS = tlsConfig
+	}
+
+	// SASL Support
+	if kafkaConfig.SaslSupport {
+		username, password := kafkaConfig.SaslUsername, kafkaConfig.SaslPassword
+
+		switch kafkaConfig.SaslMechanism {
+		case pkgconfig.SASLMechanismPlain:
+			dialer.SASLMechanism = plain.Mechanism{Username: username, Password: password}
+		case pkgconfig.SASLMechanismSha512, pkgconfig.SASLMechanismSha256:
+			algo := scram.SHA512
+			if kafkaConfig.SaslMechanism == pkgconfig.SASLMechanismSha256 {
+				algo = scram.SHA256
+			}
+			mechanism, err := scram.Mechanism(algo, username, password)
+			if err != nil {
+				return nil, err
+			}
+			dialer.SASLMechanism = mechanism
+		}
+	}
+
+	return dialer, nil
+}
+
+func (w *KafkaConsumer) defaultNewReader() (KafkaReader, error) {
+	kafkaConfig := w.GetConfig().Collectors.KafkaConsumer
+
+	dialer, err := w.createDialer()
+	if err != nil {
+		return nil, err
+	}
+
+	// list of brokers to dial to
+	brokers := []string{}
+	for _, broker := range strings.Split(kafkaConfig.RemoteAddress, ",") {
+		brokers = append(brokers, strings.TrimSpace(broker)+":"+strconv.Itoa(kafkaConfig.RemotePort))
+	}
+
+	startOffset := kafka.LastOffset
+	if kafkaConfig.StartOffset == KafkaOffsetEarliest {
+		startOffset = kafka.FirstOffset
+	}
+
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        brokers,
+		GroupID:        kafkaConfig.GroupID,
+		GroupTopics:    strings.Split(kafkaConfig.Topics, ","),
+		Dialer:         dialer,
+		StartOffset:    startOffset,
+		CommitInterval: time.Duration(kafkaConfig.CommitInterval) * time.Second,
+	}), nil
+}
+
+// Decode converts the value of a kafka message to a dns message according to the mode
+func (w *KafkaConsumer) Decode(data []byte) (dnsutils.DNSMessage, error) {
+	kafkaConfig := w.GetConfig().Collectors.KafkaConsumer
+
+	switch kafkaConfig.Mode {
+	case pkgconfig.ModeDNSTap:
+		return DecodeDnstap(w.GenericWorker, data, w.dt, w.edt, DnstapDecoderOptions{
+			ExtendedSupport:  kafkaConfig.ExtendedSupport,
+			DisableDNSParser: kafkaConfig.DisableDNSParser,
+		})
+
+	case pkgconfig.ModeJSON:
+		dm := dnsutils.DNSMessage{}
+		dm.Init()
+		err := json.Unmarshal(data, &dm)
+		return dm, err
+
+	case pkgconfig.ModeFlatJSON:
+		dm := dnsutils.DNSMessage{}
+		dm.Init()
+		flat := map[string]interface{}{}
+		if err := json.Unmarshal(data, &flat); err != nil {
+			return dm, err
+		}
+		err := dm.Unflatten(flat)
+		return dm, err
+	}
+	return dnsutils.DNSMessage{}, errors.New("unsupported mode")
+}
+
+// Fetch reads messages from the consumer group until the context is cancelled
+func (w *KafkaConsumer) Fetch(ctx context.Context, reader KafkaReader, fetched chan<- kafka.Message) {
+	backoff := 1 * time.Second
+	maxBackoff := 30 * time.Second
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.LogError("fetch error: %s, retrying in %v", err, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+			}
+			continue
+		}
+		backoff = 1 * time.Second
+
+		select {
+		case fetched <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *KafkaConsumer) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	// prepare next channels
+	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
+	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+	subprocessors := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
+
+	kafkaConfig := w.GetConfig().Collectors.KafkaConsumer
+	w.LogInfo("joining consumer group %s on topics %s", kafkaConfig.GroupID, kafkaConfig.Topics)
+
+	reader, err := w.newReader()
+	if err != nil {
+		w.LogFatal("collector kafka consumer - unable to create reader: ", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fetched := make(chan kafka.Message)
+	go w.Fetch(ctx, reader, fetched)
+
+	for {
+		select {
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.ReadConfig()
+			subprocessors.ReloadConfig(&cfg.IngoingTransformers)
+
+		case <-w.OnStop():
+			w.LogInfo("stopping...")
+			cancel()
+			subprocessors.Reset()
+			reader.Close()
+			return
+
+		case msg := <-fetched:
+			w.CountIngressTraffic()
+
+			dm, err := w.Decode(msg.Value)
+			if err != nil {
+				// invalid messages are committed to not block the partition
+				w.LogError("[topic=%s partition=%d offset=%d] unable to decode: %s", msg.Topic, msg.Partition, msg.Offset, err)
+			} else {
+				// apply all enabled transformers
+				transformResult, err := subprocessors.ProcessMessage(&dm)
+				if err != nil {
+					w.LogError(err.Error())
+				}
+				if transformResult == transformers.ReturnDrop {
+					w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				} else {
+					// count output packets
+					w.CountEgressTraffic()
+
+					// send to next
+					w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+				}
+			}
+
+			// commit the offset once the message is forwarded
+			if err := reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+				w.LogError("[topic=%s partition=%d] commit failed: %s", msg.Topic, msg.Partition, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/segmentio/kafka-go"
+)
+
+type mockKafkaReader struct {
+	sync.Mutex
+	messages  chan kafka.Message
+	committed []kafka.Message
+}
+
+func (m *mockKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-m.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (m *mockKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	m.Lock()
+	defer m.Unlock()
+	m.committed = append(m.committed, msgs...)
+	return nil
+}
+
+func (m *mockKafkaReader) Close() error { return nil }
+
+func (m *mockKafkaReader) commits() []kafka.Message {
+	m.Lock()
+	defer m.Unlock()
+	return append([]kafka.Message{}, m.committed...)
+}
+
+func Test_KafkaConsumer(t *testing.T) {
+	dmRef := dnsutils.GetFakeDNSMessageWithPayload()
+	dmRef.DNSTap.Identity = "edge"
+	// same qname as the payload, decoded in dnstap mode
+	dmRef.DNS.Qname = "dnscollector.dev"
+
+	flatJSON, err := dmRef.ToFlatJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnstapFrame, err := dmRef.ToDNSTap(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		mode  string
+		value []byte
+	}{
+		{mode: pkgconfig.ModeJSON, value: []byte(dmRef.ToJSON())},
+		{mode: pkgconfig.ModeFlatJSON, value: []byte(flatJSON)},
+		{mode: pkgconfig.ModeDNSTap, value: dnstapFrame},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.mode, func(t *testing.T) {
+			cfg := pkgconfig.GetDefaultConfig()
+			cfg.Collectors.KafkaConsumer.Mode = tc.mode
+
+			g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+			c := NewKafkaConsumer([]Worker{g}, cfg, logger.New(false), "test")
+
+			reader := &mockKafkaReader{messages: make(chan kafka.Message, 2)}
+			c.newReader = func() (KafkaReader, error) { return reader, nil }
+
+			go c.StartCollect()
+			defer c.Stop()
+
+			reader.messages <- kafka.Message{Topic: "dnscollector", Partition: 1, Offset: 42, Value: tc.value}
+
+			select {
+			case dm := <-g.GetInputChannel():
+				if dm.DNS.Qname != dmRef.DNS.Qname {
+					t.Errorf("want qname %s, got %s", dmRef.DNS.Qname, dm.DNS.Qname)
+				}
+				if dm.DNSTap.Identity != "edge" {
+					t.Errorf("want identity edge, got %s", dm.DNSTap.Identity)
+				}
+				if dm.NetworkInfo.QueryIP != dmRef.NetworkInfo.QueryIP {
+					t.Errorf("want query ip %s, got %s", dmRef.NetworkInfo.QueryIP, dm.NetworkInfo.QueryIP)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no dns message forwarded")
+			}
+
+			// offset committed after forwarding
+			time.Sleep(100 * time.Millisecond)
+			commits := reader.commits()
+			if len(commits) != 1 || commits[0].Offset != 42 {
+				t.Errorf("expected offset 42 committed, got %v", commits)
+			}
+		})
+	}
+}
+
+func Test_KafkaConsumer_InvalidMessage(t *testing.T) {
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Collectors.KafkaConsumer.Mode = pkgconfig.ModeJSON
+
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	c := NewKafkaConsumer([]Worker{g}, cfg, logger.New(false), "test")
+
+	reader := &mockKafkaReader{messages: make(chan kafka.Message, 2)}
+	c.newReader = func() (KafkaReader, error) { return reader, nil }
+
+	go c.StartCollect()
+	defer c.Stop()
+
+	// invalid messages are skipped but committed to not block the partition
+	reader.messages <- kafka.Message{Offset: 1, Value: []byte("not a json")}
+	time.Sleep(200 * time.Millisecond)
+
+	if n := len(g.GetInputChannel()); n != 0 {
+		t.Errorf("expected no forwarded message, got %d", n)
+	}
+	if commits := reader.commits(); len(commits) != 1 {
+		t.Errorf("expected invalid message to be committed, got %v", commits)
+	}
+}
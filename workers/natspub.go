@@ -0,0 +1,331 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSConnOptions are the connection settings shared by the nats logger and collector
+type NATSConnOptions struct {
+	Name                      string
+	Servers                   string
+	Username, Password, Token string
+	ConnectTimeout            time.Duration
+	ReconnectWait             time.Duration
+	TLSSupport                bool
+	TLSOptions                netutils.TLSOptions
+}
+
+// NATSConnect opens a connection to the nats servers, the client reconnects
+// in background if the servers are not reachable
+func NATSConnect(opts NATSConnOptions) (*nats.Conn, error) {
+	natsOpts := []nats.Option{
+		nats.Name(opts.Name),
+		nats.Timeout(opts.ConnectTimeout),
+		nats.ReconnectWait(opts.ReconnectWait),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+	}
+	if len(opts.Username) > 0 {
+		natsOpts = append(natsOpts, nats.UserInfo(opts.Username, opts.Password))
+	}
+	if len(opts.Token) > 0 {
+		natsOpts = append(natsOpts, nats.Token(opts.Token))
+	}
+	if opts.TLSSupport {
+		tlsConfig, err := netutils.TLSClientConfig(opts.TLSOptions)
+		if err != nil {
+			return nil, err
+		}
+		natsOpts = append(natsOpts, nats.Secure(tlsConfig))
+	}
+	return nats.Connect(opts.Servers, natsOpts...)
+}
+
+type NATSPublisher struct {
+	*GenericWorker
+	textFormat []string
+	subject    *dnsutils.FieldTemplate
+	nc         *nats.Conn
+	js         jetstream.JetStream
+}
+
+func NewNATSPublisher(config *pkgconfig.Config, logger *logger.Logger, name string) *NATSPublisher {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Loggers.NATS.ChannelBufferSize > 0 {
+		bufSize = config.Loggers.NATS.ChannelBufferSize
+	}
+	w := &NATSPublisher{GenericWorker: NewGenericWorker(config, logger, name, "nats", bufSize, pkgconfig.DefaultMonitor)}
+	w.ReadConfig()
+	return w
+}
+
+func (w *NATSPublisher) ReadConfig() {
+	if !pkgconfig.IsValidMode(w.GetConfig().Loggers.NATS.Mode) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid mode text, json or flat-json expected")
+	}
+
+	if !netutils.IsValidTLS(w.GetConfig().Loggers.NATS.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid tls min version")
+	}
+
+	subject, err := dnsutils.NewFieldTemplate(w.GetConfig().Loggers.NATS.Subject)
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"invalid subject: ", err)
+	}
+	w.subject = subject
+
+	if len(w.GetConfig().Loggers.NATS.TextFormat) > 0 {
+		w.textFormat = strings.Fields(w.GetConfig().Loggers.NATS.TextFormat)
+	} else {
+		w.textFormat = strings.Fields(w.GetConfig().Global.TextFormat)
+	}
+}
+
+func (w *NATSPublisher) Connect() error {
+	cfg := w.GetConfig().Loggers.NATS
+	w.LogInfo("connecting to nats servers %s", cfg.Servers)
+
+	nc, err := NATSConnect(NATSConnOptions{
+		Name:           w.GetName(),
+		Servers:        cfg.Servers,
+		Username:       cfg.Username,
+		Password:       cfg.Password,
+		Token:          cfg.Token,
+		ConnectTimeout: time.Duration(cfg.ConnectTimeout) * time.Second,
+		ReconnectWait:  time.Duration(cfg.ReconnectWait) * time.Second,
+		TLSSupport:     cfg.TLSSupport,
+		TLSOptions: netutils.TLSOptions{
+			InsecureSkipVerify: cfg.TLSInsecure,
+			MinVersion:         cfg.TLSMinVersion,
+			CAFile:             cfg.CAFile,
+			CertFile:           cfg.CertFile,
+			KeyFile:            cfg.KeyFile,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.JetStream {
+		js, err := jetstream.New(nc)
+		if err != nil {
+			nc.Close()
+			return err
+		}
+		w.js = js
+	}
+	w.nc = nc
+	return nil
+}
+
+func (w *NATSPublisher) Disconnect() {
+	if w.nc != nil {
+		w.LogInfo("closing nats connection")
+		w.nc.Close()
+	}
+}
+
+func (w *NATSPublisher) encode(dm *dnsutils.DNSMessage, buffer *bytes.Buffer) ([]byte, error) {
+	buffer.Reset()
+	switch w.GetConfig().Loggers.NATS.Mode {
+	case pkgconfig.ModeText:
+		err := dm.ToTextLine(
+			w.textFormat,
+			w.GetConfig().Global.TextFormatDelimiter,
+			w.GetConfig().Global.TextFormatBoundary,
+			buffer,
+		)
+		return buffer.Bytes(), err
+	case pkgconfig.ModeJSON:
+		err := json.NewEncoder(buffer).Encode(dm)
+		return buffer.Bytes(), err
+	case pkgconfig.ModeFlatJSON:
+		flat, err := dm.Flatten()
+		if err != nil {
+			return nil, err
+		}
+		err = json.NewEncoder(buffer).Encode(flat)
+		return buffer.Bytes(), err
+	}
+	return nil, errors.New("unsupported mode")
+}
+
+func (w *NATSPublisher) FlushBuffer(buf *[]dnsutils.DNSMessage) {
+	buffer := new(bytes.Buffer)
+
+	acks := []jetstream.PubAckFuture{}
+	for _, dm := range *buf {
+		payload, err := w.encode(&dm, buffer)
+		if err != nil {
+			w.CountEgressDiscarded()
+			w.LogError("could not encode dns message: %s", err)
+			continue
+		}
+
+		// the payload is copied, the buffer is reused for the next message
+		data := make([]byte, len(payload))
+		copy(data, payload)
+
+		subject := w.subject.Execute(&dm)
+		if w.js != nil {
+			ack, err := w.js.PublishAsync(subject, data)
+			if err != nil {
+				w.CountEgressDiscarded()
+				w.LogError("jetstream publish error: %s", err)
+				continue
+			}
+			acks = append(acks, ack)
+			continue
+		}
+
+		if err := w.nc.Publish(subject, data); err != nil {
+			w.CountEgressDiscarded()
+			w.LogError("publish error: %s", err)
+		}
+	}
+
+	// wait for jetstream acknowledgements
+	if len(acks) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.GetConfig().Loggers.NATS.AckTimeout)*time.Second)
+		for _, ack := range acks {
+			select {
+			case <-ack.Ok():
+			case err := <-ack.Err():
+				w.CountEgressDiscarded()
+				w.LogError("jetstream ack error: %s", err)
+			case <-ctx.Done():
+				w.CountEgressDiscarded()
+				w.LogError("jetstream ack timeout on subject %s", ack.Msg().Subject)
+			}
+		}
+		cancel()
+	}
+
+	// reset buffer
+	*buf = nil
+}
+
+func (w *NATSPublisher) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	// prepare next channels
+	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
+	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+
+	// prepare transforms
+	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
+
+	// goroutine to process transformed dns messages
+	go w.StartLogging()
+
+	// loop to process incoming messages
+	for {
+		select {
+		case <-w.OnStop():
+			w.StopLogger()
+			subprocessors.Reset()
+			return
+
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.ReadConfig()
+			subprocessors.ReloadConfig(&cfg.OutgoingTransformers)
+
+		case dm, opened := <-w.GetInputChannel():
+			if !opened {
+				w.LogInfo("input channel closed!")
+				return
+			}
+			// count global messages
+			w.CountIngressTraffic()
+
+			// apply transforms, init dns message with additional parts if necessary
+			transformResult, err := subprocessors.ProcessMessage(&dm)
+			if err != nil {
+				w.LogError(err.Error())
+			}
+			if transformResult == transformers.ReturnDrop {
+				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				continue
+			}
+
+			// send to output channel
+			w.CountEgressTraffic()
+			w.GetOutputChannel() <- dm
+
+			// send to next ?
+			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+		}
+	}
+}
+
+func (w *NATSPublisher) StartLogging() {
+	w.LogInfo("logging has started")
+	defer w.LoggingDone()
+
+	// init buffer
+	bufferDm := []dnsutils.DNSMessage{}
+
+	// init flush timer for buffer
+	flushInterval := time.Duration(w.GetConfig().Loggers.NATS.FlushInterval) * time.Second
+	flushTimer := time.NewTimer(flushInterval)
+
+	// init connection, the nats client handles the reconnections
+	if err := w.Connect(); err != nil {
+		w.LogError("unable to connect: %s", err)
+	}
+
+	w.LogInfo("ready to process")
+	for {
+		select {
+		case <-w.OnLoggerStopped():
+			// closing remote connection if exist
+			w.Disconnect()
+			return
+
+		// incoming dns message to process
+		case dm, opened := <-w.GetOutputChannel():
+			if !opened {
+				w.LogInfo("output channel closed!")
+				return
+			}
+
+			// drop dns message if the connection can not be initialized
+			if w.nc == nil {
+				w.CountEgressDiscarded()
+				continue
+			}
+
+			// append dns message to buffer
+			bufferDm = append(bufferDm, dm)
+
+			// buffer is full ?
+			if len(bufferDm) >= w.GetConfig().Loggers.NATS.BufferSize {
+				w.FlushBuffer(&bufferDm)
+			}
+
+		// flush the buffer
+		case <-flushTimer.C:
+			if len(bufferDm) > 0 {
+				w.FlushBuffer(&bufferDm)
+			}
+
+			// restart timer
+			flushTimer.Reset(flushInterval)
+		}
+	}
+}
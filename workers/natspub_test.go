@@ -0,0 +1,129 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func runNATSServerForTest(t *testing.T) *server.Server {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+func Test_NATSPublisher(t *testing.T) {
+	ns := runNATSServerForTest(t)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("dnscollector.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.NATS.Servers = ns.ClientURL()
+	cfg.Loggers.NATS.Subject = "dnscollector.{dnstap.identity}.{dns.qtype}"
+	cfg.Loggers.NATS.BufferSize = 1
+
+	w := NewNATSPublisher(cfg, logger.New(false), "test")
+	go w.StartCollect()
+	defer w.Stop()
+
+	time.Sleep(500 * time.Millisecond)
+	w.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "dnscollector.collector.A" {
+		t.Errorf("invalid subject: %s", msg.Subject)
+	}
+
+	var dm dnsutils.DNSMessage
+	if err := json.Unmarshal(msg.Data, &dm); err != nil {
+		t.Fatalf("invalid json payload: %s", err)
+	}
+	if dm.DNS.Qname != pkgconfig.ProgQname {
+		t.Errorf("invalid qname: %s", dm.DNS.Qname)
+	}
+}
+
+func Test_NATSPublisher_JetStream(t *testing.T) {
+	ns := runNATSServerForTest(t)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "dnscollector", Subjects: []string{"dnscollector.>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.NATS.Servers = ns.ClientURL()
+	cfg.Loggers.NATS.JetStream = true
+	cfg.Loggers.NATS.BufferSize = 2
+
+	w := NewNATSPublisher(cfg, logger.New(false), "test")
+	go w.StartCollect()
+	defer w.Stop()
+
+	time.Sleep(500 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		w.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+	}
+
+	// messages are stored in the stream once acked
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := stream.Info(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.State.Msgs == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 messages in stream, got %d", info.State.Msgs)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,226 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsInbound is a message received from nats, acked once forwarded
+type natsInbound struct {
+	data []byte
+	ack  func() error
+	term func() error
+}
+
+type NATSSubscriber struct {
+	*GenericWorker
+	nc       *nats.Conn
+	inbound  chan natsInbound
+	stopRecv chan bool
+}
+
+func NewNATSSubscriber(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *NATSSubscriber {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Collectors.NATS.ChannelBufferSize > 0 {
+		bufSize = config.Collectors.NATS.ChannelBufferSize
+	}
+	w := &NATSSubscriber{GenericWorker: NewGenericWorker(config, logger, name, "nats", bufSize, pkgconfig.DefaultMonitor)}
+	w.inbound = make(chan natsInbound, bufSize)
+	w.stopRecv = make(chan bool)
+	w.SetDefaultRoutes(next)
+	w.ReadConfig()
+	return w
+}
+
+func (w *NATSSubscriber) ReadConfig() {
+	if !netutils.IsValidTLS(w.GetConfig().Collectors.NATS.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "invalid tls min version")
+	}
+	if w.GetConfig().Collectors.NATS.JetStream && len(w.GetConfig().Collectors.NATS.Stream) == 0 {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "stream name is required with jetstream")
+	}
+}
+
+func (w *NATSSubscriber) Connect() error {
+	cfg := w.GetConfig().Collectors.NATS
+	w.LogInfo("connecting to nats servers %s", cfg.Servers)
+
+	nc, err := NATSConnect(NATSConnOptions{
+		Name:           w.GetName(),
+		Servers:        cfg.Servers,
+		Username:       cfg.Username,
+		Password:       cfg.Password,
+		Token:          cfg.Token,
+		ConnectTimeout: time.Duration(cfg.ConnectTimeout) * time.Second,
+		ReconnectWait:  time.Duration(cfg.ReconnectWait) * time.Second,
+		TLSSupport:     cfg.TLSSupport,
+		TLSOptions: netutils.TLSOptions{
+			InsecureSkipVerify: cfg.TLSInsecure,
+			MinVersion:         cfg.TLSMinVersion,
+			CAFile:             cfg.CAFile,
+			CertFile:           cfg.CertFile,
+			KeyFile:            cfg.KeyFile,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	w.nc = nc
+	return nil
+}
+
+// receive pushes the message to the collector loop, the nats dispatcher is
+// blocked while the collector is busy
+func (w *NATSSubscriber) receive(in natsInbound) {
+	select {
+	case w.inbound <- in:
+	case <-w.stopRecv:
+	}
+}
+
+func (w *NATSSubscriber) Subscribe() (*nats.Subscription, error) {
+	cfg := w.GetConfig().Collectors.NATS
+	handler := func(msg *nats.Msg) {
+		w.receive(natsInbound{data: msg.Data})
+	}
+	if len(cfg.QueueGroup) > 0 {
+		return w.nc.QueueSubscribe(cfg.Subject, cfg.QueueGroup, handler)
+	}
+	return w.nc.Subscribe(cfg.Subject, handler)
+}
+
+// ConsumeJetStream attaches to a durable pull consumer, the consumer is created if needed
+// and messages are acknowledged after forwarding
+func (w *NATSSubscriber) ConsumeJetStream() (jetstream.ConsumeContext, error) {
+	cfg := w.GetConfig().Collectors.NATS
+
+	js, err := jetstream.New(w.nc)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ConnectTimeout)*time.Second)
+	defer cancel()
+	consumer, err := js.CreateOrUpdateConsumer(ctx, cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       cfg.Consumer,
+		FilterSubject: cfg.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return consumer.Consume(func(msg jetstream.Msg) {
+		w.receive(natsInbound{data: msg.Data(), ack: msg.Ack, term: msg.Term})
+	})
+}
+
+func (w *NATSSubscriber) StartReceiving() {
+	reconnectWait := time.Duration(w.GetConfig().Collectors.NATS.ReconnectWait) * time.Second
+
+	if !w.GetConfig().Collectors.NATS.JetStream {
+		sub, err := w.Subscribe()
+		if err != nil {
+			w.LogError("unable to subscribe: %s", err)
+			return
+		}
+		w.LogInfo("subscribed to %s", sub.Subject)
+		<-w.stopRecv
+		sub.Unsubscribe()
+		return
+	}
+
+	// the stream can be unavailable at startup, retry until success
+	for {
+		cc, err := w.ConsumeJetStream()
+		if err == nil {
+			w.LogInfo("consuming jetstream stream %s", w.GetConfig().Collectors.NATS.Stream)
+			<-w.stopRecv
+			cc.Stop()
+			return
+		}
+		w.LogError("unable to consume jetstream: %s", err)
+
+		select {
+		case <-time.After(reconnectWait):
+		case <-w.stopRecv:
+			return
+		}
+	}
+}
+
+func (w *NATSSubscriber) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	// prepare next channels
+	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
+	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+	subprocessors := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
+
+	if err := w.Connect(); err != nil {
+		w.LogFatal("collector nats - unable to connect: ", err)
+	}
+	go w.StartReceiving()
+
+	for {
+		select {
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.ReadConfig()
+			subprocessors.ReloadConfig(&cfg.IngoingTransformers)
+
+		case <-w.OnStop():
+			w.LogInfo("stopping...")
+			close(w.stopRecv)
+			subprocessors.Reset()
+			w.nc.Close()
+			return
+
+		case in := <-w.inbound:
+			w.CountIngressTraffic()
+
+			dm := dnsutils.DNSMessage{}
+			dm.Init()
+			if err := json.Unmarshal(in.data, &dm); err != nil {
+				w.LogError("invalid dns message: %s", err)
+				// do not redeliver malformed messages
+				if in.term != nil {
+					in.term()
+				}
+				continue
+			}
+
+			// apply all enabled transformers
+			transformResult, err := subprocessors.ProcessMessage(&dm)
+			if err != nil {
+				w.LogError(err.Error())
+			}
+			if transformResult == transformers.ReturnDrop {
+				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+			} else {
+				// count output packets
+				w.CountEgressTraffic()
+
+				// send to next
+				w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			}
+
+			if in.ack != nil {
+				if err := in.ack(); err != nil {
+					w.LogError("jetstream ack error: %s", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func Test_NATSSubscriber(t *testing.T) {
+	ns := runNATSServerForTest(t)
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Collectors.NATS.Servers = ns.ClientURL()
+
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	c := NewNATSSubscriber([]Worker{g}, cfg, logger.New(false), "test")
+	go c.StartCollect()
+	defer c.Stop()
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	// wait subscription and publish a dns message from an edge collector
+	time.Sleep(500 * time.Millisecond)
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "edge.collector"
+	if err := nc.Publish("dnscollector.edge", []byte(dm.ToJSON())); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-g.GetInputChannel():
+		if msg.DNS.Qname != "edge.collector" {
+			t.Errorf("want edge.collector, got %s", msg.DNS.Qname)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no dns message received")
+	}
+}
+
+func Test_NATSSubscriber_JetStream(t *testing.T) {
+	ns := runNATSServerForTest(t)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "dnscollector", Subjects: []string{"dnscollector.>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// messages published before the collector starts are delivered
+	dm := dnsutils.GetFakeDNSMessage()
+	if _, err := js.Publish(ctx, "dnscollector.edge", []byte(dm.ToJSON())); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Collectors.NATS.Servers = ns.ClientURL()
+	cfg.Collectors.NATS.JetStream = true
+
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	c := NewNATSSubscriber([]Worker{g}, cfg, logger.New(false), "test")
+	go c.StartCollect()
+	defer c.Stop()
+
+	select {
+	case msg := <-g.GetInputChannel():
+		if msg.DNS.Qname != pkgconfig.ProgQname {
+			t.Errorf("want %s, got %s", pkgconfig.ProgQname, msg.DNS.Qname)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no dns message received")
+	}
+
+	// the message is acknowledged after forwarding
+	consumer, err := js.Consumer(ctx, "dnscollector", "dnscollector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := consumer.Info(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.AckFloor.Consumer == 1 && info.NumAckPending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message not acked, ack floor %d, pending %d", info.AckFloor.Consumer, info.NumAckPending)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -15,6 +15,12 @@ import (
 	"github.com/dmachard/go-dnscollector/transformers"
 	"github.com/dmachard/go-logger"
 	"github.com/dmachard/go-netutils"
+	"github.com/prometheus/common/version"
+)
+
+const (
+	syslogFormatterCEF  = "cef"
+	syslogFormatterLEEF = "leef"
 )
 
 type Syslog struct {
@@ -24,6 +30,7 @@ type Syslog struct {
 	syslogReady                        bool
 	transportReady, transportReconnect chan bool
 	textFormat                         []string
+	siemFormat, productVersion         string
 }
 
 func NewSyslog(config *pkgconfig.Config, console *logger.Logger, name string) *Syslog {
@@ -63,6 +70,18 @@ func (w *Syslog) ReadConfig() {
 	} else {
 		w.textFormat = strings.Fields(w.GetConfig().Global.TextFormat)
 	}
+
+	// cef and leef formatters replace the configured mode for the message body
+	w.siemFormat = ""
+	switch formatter := strings.ToLower(w.GetConfig().Loggers.Syslog.Formatter); formatter {
+	case syslogFormatterCEF, syslogFormatterLEEF:
+		w.siemFormat = formatter
+	}
+
+	w.productVersion = w.GetConfig().Loggers.Syslog.ProductVersion
+	if len(w.productVersion) == 0 {
+		w.productVersion = version.Version
+	}
 }
 
 func (w *Syslog) ConnectToRemote() {
@@ -132,7 +151,7 @@ func (w *Syslog) ConnectToRemote() {
 		switch strings.ToLower(w.GetConfig().Loggers.Syslog.Formatter) {
 		case "unix":
 			w.syslogWriter.SetFormatter(syslog.UnixFormatter)
-		case "rfc3164":
+		case "rfc3164", syslogFormatterCEF, syslogFormatterLEEF:
 			w.syslogWriter.SetFormatter(syslog.RFC3164Formatter)
 		case "rfc5424", "":
 			w.syslogWriter.SetFormatter(syslog.RFC5424Formatter)
@@ -226,7 +245,27 @@ func (w *Syslog) FlushBuffer(buf *[]dnsutils.DNSMessage) {
 	var err error
 
 	for _, dm := range *buf {
-		switch w.GetConfig().Loggers.Syslog.Mode {
+		mode := w.GetConfig().Loggers.Syslog.Mode
+		if len(w.siemFormat) > 0 {
+			mode = w.siemFormat
+		}
+
+		switch mode {
+		case syslogFormatterCEF, syslogFormatterLEEF:
+			buf := w.GetTextBuffer()
+			buf.Reset()
+
+			// encode the dns message to a single CEF or LEEF event
+			if mode == syslogFormatterCEF {
+				dm.ToCEF(w.GetConfig().Loggers.Syslog.Vendor, w.GetConfig().Loggers.Syslog.Product, w.productVersion, buf)
+			} else {
+				dm.ToLEEF(w.GetConfig().Loggers.Syslog.Vendor, w.GetConfig().Loggers.Syslog.Product, w.productVersion, buf)
+			}
+			buf.WriteByte('\n')
+
+			_, err = buf.WriteTo(w.syslogWriter)
+			w.PutTextBuffer(buf)
+
 		case pkgconfig.ModeText:
 			buf := w.GetTextBuffer()
 			buf.Reset()
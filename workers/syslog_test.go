@@ -59,6 +59,24 @@ func Test_SyslogRunUdp(t *testing.T) {
 			pattern:    `\d+ \<30\>1 \d+-\d+-\d+.*`,
 			listenAddr: ":4000",
 		},
+		{
+			name:       "cef_format",
+			transport:  netutils.SocketUDP,
+			mode:       pkgconfig.ModeText,
+			formatter:  "cef",
+			framer:     "",
+			pattern:    `<30>\D+ \d+ \d+:\d+:\d+ .*CEF:0\|dmachard\|DNScollector\|.*\|QUERY\|DNS query\|0\|src=1\.2\.3\.4 spt=1234 .*request=dns\.collector outcome=NOERROR`,
+			listenAddr: ":4000",
+		},
+		{
+			name:       "leef_format",
+			transport:  netutils.SocketUDP,
+			mode:       pkgconfig.ModeJSON,
+			formatter:  "leef",
+			framer:     "",
+			pattern:    `<30>\D+ \d+ \d+:\d+:\d+ .*LEEF:1\.0\|dmachard\|DNScollector\|.*\|QUERY\|src=1\.2\.3\.4\tsrcPort=1234\t.*qname=dns\.collector`,
+			listenAddr: ":4000",
+		},
 	}
 
 	for _, tc := range testcases {